@@ -5,11 +5,13 @@ import (
 	"flag"
 	"fmt"
 	"image"
+	"io"
 	"log"
 	"os"
 	"path/filepath"
 
 	"github.com/DMarby/picsum-photos/internal/database"
+	"github.com/DMarby/picsum-photos/internal/exif"
 
 	_ "image/jpeg"
 )
@@ -39,25 +41,15 @@ func main() {
 		log.Fatal(err)
 	}
 
-	for i, img := range images {
-		resolvedImagePath, err := filepath.Abs(filepath.Join(*imagePath, fmt.Sprintf("%s.jpg", img.ID)))
+	for i := range images {
+		resolvedImagePath, err := filepath.Abs(filepath.Join(*imagePath, fmt.Sprintf("%s.jpg", images[i].ID)))
 		if err != nil {
 			log.Fatal(err)
 		}
 
-		reader, err := os.Open(resolvedImagePath)
-		if err != nil {
-			log.Fatal(err)
-		}
-		defer reader.Close()
-
-		imageMetadata, _, err := image.DecodeConfig(reader)
-		if err != nil {
-			log.Fatal(err)
+		if err := updateImage(resolvedImagePath, &images[i]); err != nil {
+			log.Fatalf("%s: %s", resolvedImagePath, err)
 		}
-
-		images[i].Width = imageMetadata.Width
-		images[i].Height = imageMetadata.Height
 	}
 
 	file, _ := os.OpenFile(resolvedManifestPath, os.O_WRONLY, 0644)
@@ -71,3 +63,55 @@ func main() {
 		log.Fatal(err)
 	}
 }
+
+// updateImage updates the dimensions of an image, and the metadata from its EXIF metadata
+// Metadata missing from the EXIF metadata, like the source URL, is kept from the manifest
+func updateImage(path string, img *database.Image) error {
+	reader, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	imageMetadata, _, err := image.DecodeConfig(reader)
+	if err != nil {
+		return err
+	}
+
+	img.Width = imageMetadata.Width
+	img.Height = imageMetadata.Height
+
+	if _, err := reader.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	exifMetadata, err := exif.Decode(reader)
+	if err == exif.ErrNoEXIF {
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	setIfPresent(&img.Title, exifMetadata.Title)
+	setIfPresent(&img.Description, exifMetadata.Description)
+	setIfPresent(&img.CameraModel, exifMetadata.CameraModel)
+
+	if exifMetadata.FocalLength != 0 {
+		img.FocalLength = exifMetadata.FocalLength
+	}
+
+	if !exifMetadata.CapturedAt.IsZero() {
+		img.CapturedAt = &exifMetadata.CapturedAt
+	}
+
+	return nil
+}
+
+// setIfPresent sets the field to the value, unless the value is empty
+func setIfPresent(field *string, value string) {
+	if value != "" {
+		*field = value
+	}
+}
@@ -9,8 +9,11 @@ import (
 	"os/signal"
 	"syscall"
 
+	"github.com/DMarby/picsum-photos/internal/cache/lru"
 	"github.com/DMarby/picsum-photos/internal/cache/memory"
 	"github.com/DMarby/picsum-photos/internal/cmd"
+	"github.com/DMarby/picsum-photos/internal/database"
+	"github.com/DMarby/picsum-photos/internal/handler"
 	"github.com/DMarby/picsum-photos/internal/health"
 	"github.com/DMarby/picsum-photos/internal/hmac"
 	"github.com/DMarby/picsum-photos/internal/image"
@@ -20,6 +23,7 @@ import (
 	"github.com/DMarby/picsum-photos/internal/storage/file"
 	"github.com/DMarby/picsum-photos/internal/tracing/test"
 
+	fileDatabase "github.com/DMarby/picsum-photos/internal/database/file"
 	api "github.com/DMarby/picsum-photos/internal/imageapi"
 
 	"github.com/jamiealquiza/envy"
@@ -37,11 +41,22 @@ var (
 	// Storage - File
 	storagePath = flag.String("storage-path", "", "path to the storage directory")
 
+	// Database - File
+	databaseFilePath = flag.String("database-file-path", "", "path to the database file, to set the attribution headers of images from")
+
+	// Rate limiting
+	trustedProxies      = flag.String("trusted-proxies", "", "comma separated IPs and CIDR prefixes of proxies trusted to set the client IP in the X-Forwarded-For header")
+	rateLimitImages     = flag.Float64("rate-limit-images", 0, "requests per second each client can make, or 0 to not limit them")
+	rateLimitImageBurst = flag.Int("rate-limit-image-burst", 20, "how many requests each client can make at once")
+
 	// HMAC
-	hmacKey = flag.String("hmac-key", "", "hmac key to use for authentication between services")
+	hmacKey           = flag.String("hmac-key", "", "hmac key to use for authentication between services, for urls without a key id")
+	hmacKeys          = flag.String("hmac-keys", "", "comma separated {key id}:{key} hmac keys, for rotating the hmac key")
+	hmacRetiredKeyIDs = flag.String("hmac-retired-key-ids", "", "comma separated ids of the hmac keys that are no longer accepted, with none for -hmac-key")
 
 	// Image processor
-	workers = flag.Int("workers", 3, "worker queue concurrency")
+	workers       = flag.Int("workers", 3, "worker queue concurrency")
+	tileCacheSize = flag.Int64("tile-cache-size", 256<<20, "max bytes of processed tiles to cache in memory")
 )
 
 func main() {
@@ -81,12 +96,25 @@ func main() {
 		log.Fatalf("error initializing storage: %s", err)
 	}
 
+	// Initialize the database, which is optional as it's only used for the attribution headers
+	var db database.Provider
+	if *databaseFilePath != "" {
+		db, err = fileDatabase.New(*databaseFilePath)
+		if err != nil {
+			log.Fatalf("error initializing database: %s", err)
+		}
+	}
+
 	// Initialize the cache
 	cache := memory.New()
 	defer cache.Shutdown()
 
+	// Tiles are cached after processing, as they're requested repeatedly when zooming, in a bounded cache to limit the memory usage
+	tileCache := lru.New(*tileCacheSize)
+	defer tileCache.Shutdown()
+
 	// Initialize the image processor
-	imageProcessor, err := vips.New(shutdownCtx, log, tracer, *workers, image.NewCache(tracer, cache, storage))
+	imageProcessor, err := vips.New(shutdownCtx, log, tracer, *workers, image.NewCache(tracer, cache, storage), tileCache)
 	if err != nil {
 		log.Fatalf("error initializing image processor %s", err.Error())
 	}
@@ -100,15 +128,38 @@ func main() {
 	}
 	go checker.Run()
 
+	// Initialize the rate limiting
+	trustedProxyPrefixes, err := handler.ParseTrustedProxies(*trustedProxies)
+	if err != nil {
+		log.Fatalf("error parsing trusted proxies: %s", err)
+	}
+
+	rateLimits := &handler.RateLimits{
+		Limiter: handler.NewRateLimiter(trustedProxyPrefixes),
+		Images:  handler.NewBudget("images", *rateLimitImages, *rateLimitImageBurst),
+	}
+
+	// Initialize the hmac keyring
+	keys, err := hmac.ParseKeys(*hmacKeys)
+	if err != nil {
+		log.Fatalf("error parsing hmac keys: %s", err)
+	}
+
+	// The image service only validates urls, so it doesn't have an active key
+	hmacKeyring, err := hmac.NewValidator([]byte(*hmacKey), keys, hmac.ParseKeyIDs(*hmacRetiredKeyIDs))
+	if err != nil {
+		log.Fatalf("error initializing hmac keyring: %s", err)
+	}
+
 	// Start and listen on http
 	api := &api.API{
 		ImageProcessor: imageProcessor,
 		Log:            log,
 		Tracer:         tracer,
 		HandlerTimeout: cmd.HandlerTimeout,
-		HMAC: &hmac.HMAC{
-			Key: []byte(*hmacKey),
-		},
+		HMAC:           hmacKeyring,
+		Database:       db,
+		RateLimits:     rateLimits,
 	}
 	server := &http.Server{
 		Handler:      api.Router(),
@@ -10,7 +10,9 @@ import (
 	"syscall"
 
 	"github.com/DMarby/picsum-photos/internal/api"
+	"github.com/DMarby/picsum-photos/internal/apikey"
 	"github.com/DMarby/picsum-photos/internal/cmd"
+	"github.com/DMarby/picsum-photos/internal/handler"
 	"github.com/DMarby/picsum-photos/internal/hmac"
 	"github.com/DMarby/picsum-photos/internal/metrics"
 	"github.com/DMarby/picsum-photos/internal/tracing/test"
@@ -27,17 +29,33 @@ import (
 // Comandline flags
 var (
 	// Global
-	listen          = flag.String("listen", "", "unix socket path")
-	metricsListen   = flag.String("metrics-listen", "127.0.0.1:8082", "metrics listen address")
-	rootURL         = flag.String("root-url", "https://picsum.photos", "root url")
-	imageServiceURL = flag.String("image-service-url", "https://fastly.picsum.photos", "image service url")
-	loglevel        = zap.LevelFlag("log-level", zap.InfoLevel, "log level (default \"info\") (debug, info, warn, error, dpanic, panic, fatal)")
+	listen              = flag.String("listen", "", "unix socket path")
+	metricsListen       = flag.String("metrics-listen", "127.0.0.1:8082", "metrics listen address")
+	rootURL             = flag.String("root-url", "https://picsum.photos", "root url")
+	imageServiceURL     = flag.String("image-service-url", "https://fastly.picsum.photos", "image service url")
+	imageServiceSocket  = flag.String("image-service-socket", "", "unix socket path of the image service, to serve images through instead of redirecting to the image service url")
+	metadataCacheMaxAge = flag.Duration("metadata-cache-max-age", 0, "how long image metadata can be cached publicly, or 0 to always revalidate")
+	signedURLMaxAge     = flag.Duration("signed-url-max-age", 0, "how long signed image service urls can be used for, or 0 for them to never expire")
+	loglevel            = zap.LevelFlag("log-level", zap.InfoLevel, "log level (default \"info\") (debug, info, warn, error, dpanic, panic, fatal)")
 
 	// Database - File
 	databaseFilePath = flag.String("database-file-path", "./test/fixtures/file/metadata.json", "path to the database file")
 
+	// Rate limiting
+	trustedProxies         = flag.String("trusted-proxies", "", "comma separated IPs and CIDR prefixes of proxies trusted to set the client IP in the X-Forwarded-For header")
+	rateLimitRedirects     = flag.Float64("rate-limit-redirects", 0, "requests per second each client can make to routes that redirect or return metadata, or 0 to not limit them")
+	rateLimitRedirectBurst = flag.Int("rate-limit-redirect-burst", 100, "how many requests each client can make at once to routes that redirect or return metadata")
+	rateLimitImages        = flag.Float64("rate-limit-images", 0, "requests per second each client can make to routes that process images through the image service socket, or 0 to not limit them")
+	rateLimitImageBurst    = flag.Int("rate-limit-image-burst", 20, "how many requests each client can make at once to routes that process images")
+
+	// API keys
+	apiKeysPath = flag.String("api-keys-path", "", "path to the API key file, for clients with their own rate limits, max image size and features")
+
 	// HMAC
-	hmacKey = flag.String("hmac-key", "", "hmac key to use for authentication between services")
+	hmacKey           = flag.String("hmac-key", "", "hmac key to use for authentication between services, for urls without a key id")
+	hmacKeys          = flag.String("hmac-keys", "", "comma separated {key id}:{key} hmac keys, for rotating the hmac key")
+	hmacActiveKeyID   = flag.String("hmac-active-key-id", "", "id of the hmac key to sign with, or empty to sign with -hmac-key")
+	hmacRetiredKeyIDs = flag.String("hmac-retired-key-ids", "", "comma separated ids of the hmac keys that are no longer accepted, with none for -hmac-key")
 )
 
 func main() {
@@ -80,17 +98,58 @@ func main() {
 	}
 	go checker.Run()
 
+	// Serve images through the image service socket instead of redirecting, if configured
+	var imageProxy http.Handler
+	if *imageServiceSocket != "" {
+		imageProxy = api.UnixSocketProxy(*imageServiceSocket, log)
+	}
+
+	// Initialize the rate limiting
+	trustedProxyPrefixes, err := handler.ParseTrustedProxies(*trustedProxies)
+	if err != nil {
+		log.Fatalf("error parsing trusted proxies: %s", err)
+	}
+
+	rateLimits := &handler.RateLimits{
+		Limiter:   handler.NewRateLimiter(trustedProxyPrefixes),
+		Redirects: handler.NewBudget("redirects", *rateLimitRedirects, *rateLimitRedirectBurst),
+		Images:    handler.NewBudget("images", *rateLimitImages, *rateLimitImageBurst),
+	}
+
+	// Load the API keys, if configured
+	var apiKeys *apikey.Keys
+	if *apiKeysPath != "" {
+		apiKeys, err = apikey.Load(*apiKeysPath)
+		if err != nil {
+			log.Fatalf("error loading api keys: %s", err)
+		}
+	}
+
+	// Initialize the hmac keyring
+	keys, err := hmac.ParseKeys(*hmacKeys)
+	if err != nil {
+		log.Fatalf("error parsing hmac keys: %s", err)
+	}
+
+	hmacKeyring, err := hmac.New([]byte(*hmacKey), keys, *hmacActiveKeyID, hmac.ParseKeyIDs(*hmacRetiredKeyIDs))
+	if err != nil {
+		log.Fatalf("error initializing hmac keyring: %s", err)
+	}
+
 	// Start and listen on http
 	api := &api.API{
-		Database:        database,
-		Log:             log,
-		Tracer:          tracer,
-		RootURL:         *rootURL,
-		ImageServiceURL: *imageServiceURL,
-		HandlerTimeout:  cmd.HandlerTimeout,
-		HMAC: &hmac.HMAC{
-			Key: []byte(*hmacKey),
-		},
+		Database:            database,
+		Log:                 log,
+		Tracer:              tracer,
+		RootURL:             *rootURL,
+		ImageServiceURL:     *imageServiceURL,
+		HandlerTimeout:      cmd.HandlerTimeout,
+		HMAC:                hmacKeyring,
+		ImageProxy:          imageProxy,
+		MetadataCacheMaxAge: *metadataCacheMaxAge,
+		RateLimits:          rateLimits,
+		APIKeys:             apiKeys,
+		SignedURLMaxAge:     *signedURLMaxAge,
 	}
 	router, err := api.Router()
 	if err != nil {
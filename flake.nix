@@ -108,6 +108,13 @@
                 example = default;
                 description = "Image database file path";
               };
+
+              apiKeysPath = mkOption {
+                type = with types; nullOr path;
+                default = null;
+                example = "/var/lib/picsum-photos/api-keys.json";
+                description = "API key file path, for clients with their own rate limits, max image size and features";
+              };
             };
 
             image-service = {
@@ -150,6 +157,13 @@
                 example = default;
                 description = "Storage path";
               };
+
+              databaseFilePath = mkOption {
+                type = with types; nullOr path;
+                default = null;
+                example = "/var/lib/image-service/image-manifest.json";
+                description = "Image database file path, for the attribution headers of images";
+              };
             };
           };
 
@@ -172,7 +186,8 @@
                   exec ${self.packages.${pkgs.system}.picsum-photos}/bin/picsum-photos \
                     -log-level=${cfg.picsum-photos.logLevel} \
                     -listen=${cfg.picsum-photos.sockPath} \
-                    -database-file-path=${cfg.picsum-photos.databaseFilePath}
+                    -database-file-path=${cfg.picsum-photos.databaseFilePath} \
+                    ${optionalString (cfg.picsum-photos.apiKeysPath != null) "-api-keys-path=${cfg.picsum-photos.apiKeysPath}"}
                 '';
 
                 serviceConfig = {
@@ -191,6 +206,8 @@
               services.nginx.virtualHosts."${cfg.picsum-photos.domain}" = {
                 locations."/" = {
                   proxyPass = "http://unix:${cfg.picsum-photos.sockPath}";
+                  # Forward the client IP, for the rate limiting
+                  recommendedProxySettings = true;
                 };
               };
             })
@@ -214,7 +231,8 @@
                     -log-level=${cfg.image-service.logLevel} \
                     -listen=${cfg.image-service.sockPath} \
                     -storage-path=${cfg.image-service.storagePath} \
-                    -workers=${toString cfg.image-service.workers}
+                    -workers=${toString cfg.image-service.workers} \
+                    ${optionalString (cfg.image-service.databaseFilePath != null) "-database-file-path=${cfg.image-service.databaseFilePath}"}
                 '';
 
                 serviceConfig = {
@@ -233,6 +251,8 @@
               services.nginx.virtualHosts."${cfg.image-service.domain}" = {
                 locations."/" = {
                   proxyPass = "http://unix:${cfg.image-service.sockPath}";
+                  # Forward the client IP, for the rate limiting
+                  recommendedProxySettings = true;
                 };
               };
             })
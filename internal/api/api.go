@@ -5,8 +5,10 @@ import (
 	"net/http"
 	"time"
 
+	"github.com/DMarby/picsum-photos/internal/apikey"
 	"github.com/DMarby/picsum-photos/internal/handler"
 	"github.com/DMarby/picsum-photos/internal/hmac"
+	"github.com/DMarby/picsum-photos/internal/imageapi"
 	"github.com/DMarby/picsum-photos/internal/tracing"
 	"github.com/DMarby/picsum-photos/internal/web"
 	"github.com/rs/cors"
@@ -27,6 +29,16 @@ type API struct {
 	ImageServiceURL string
 	HandlerTimeout  time.Duration
 	HMAC            *hmac.HMAC
+	// ImageProxy serves the images instead of redirecting to ImageServiceURL, if set
+	ImageProxy http.Handler
+	// MetadataCacheMaxAge is how long image metadata can be cached publicly, or zero to always revalidate
+	MetadataCacheMaxAge time.Duration
+	// RateLimits limits the requests of each client, if set
+	RateLimits *handler.RateLimits
+	// APIKeys authenticate clients with their own limits, if set
+	APIKeys *apikey.Keys
+	// SignedURLMaxAge is how long signed image service URLs can be used for, or zero for them to never expire
+	SignedURLMaxAge time.Duration
 }
 
 // Utility methods for logging
@@ -38,49 +50,103 @@ func (a *API) logError(r *http.Request, message string, err error) {
 func (a *API) Router() (http.Handler, error) {
 	router := mux.NewRouter()
 
-	router.NotFoundHandler = handler.Handler(a.notFoundHandler)
+	router.NotFoundHandler = handler.MethodNotAllowed(router, handler.Handler(a.notFoundHandler))
+	router.MethodNotAllowedHandler = router.NotFoundHandler
 
 	// Redirect trailing slashes
 	router.StrictSlash(true)
 
 	// Image list
-	router.Handle("/v2/list", handler.Handler(a.listHandler)).Methods("GET").Name("api.list")
+	router.Handle("/v2/list", handler.Handler(a.listHandler)).Methods("GET", "HEAD").Name("api.list")
 
 	// Query parameters:
 	// ?page={page} - What page to display
+	// ?cursor={cursor} - Display the page after {cursor}, from the Link header. Pass an empty cursor to start
 	// ?limit={limit} - How many entries to display per page
+	// ?author={author} - Only list images by {author}
+	// ?min_width={width} - Only list images at least {width} wide
+	// ?min_height={height} - Only list images at least {height} tall
+	// ?orientation={orientation} - Only list landscape, portrait or square images
+	// ?sort={sort} - Sort by id, author, width, or shuffle using ?seed={seed}
 
-	// Image routes
-	oldRouter := router.PathPrefix("").Subrouter()
-	oldRouter.Use(a.deprecatedParams)
+	// Tag list
+	router.Handle("/v2/tags", handler.Handler(a.tagsHandler)).Methods("GET", "HEAD").Name("api.tags")
 
-	oldRouter.Handle("/{size:[0-9]+}{extension:(?:\\..*)?}", handler.Handler(a.randomImageRedirectHandler)).Methods("GET").Name("api.randomImageRedirect")
-	oldRouter.Handle("/{width:[0-9]+}/{height:[0-9]+}{extension:(?:\\..*)?}", handler.Handler(a.randomImageRedirectHandler)).Methods("GET").Name("api.randomImageRedirect")
+	// Author list
+	router.Handle("/v2/authors", handler.Handler(a.authorsHandler)).Methods("GET", "HEAD").Name("api.authors")
+	router.Handle("/v2/authors/{slug}/images", handler.Handler(a.listHandler)).Methods("GET", "HEAD").Name("api.authorImages")
 
-	// Image by ID routes
-	router.Handle("/id/{id}/{size:[0-9]+}{extension:(?:\\..*)?}", handler.Handler(a.imageRedirectHandler)).Methods("GET").Name("api.imageRedirect")
-	router.Handle("/id/{id}/{width:[0-9]+}/{height:[0-9]+}{extension:(?:\\..*)?}", handler.Handler(a.imageRedirectHandler)).Methods("GET").Name("api.imageRedirect")
+	// Query parameters:
+	// Same as for /v2/list
+
+	// Batch of random images
+	router.Handle("/v2/random", handler.Handler(a.randomHandler)).Methods("GET", "HEAD").Name("api.random")
+
+	// Query parameters:
+	// ?count={count} - How many distinct images to return
+	// ?width={width}, ?height={height} - The size of the images, defaults to the size of each image
+	// ?format={format} - jpg, webp or avif
+	// ?seed={seed} - Return the same images every time based on a seed
+	// ?orientation={orientation}, ?tag={tag}, ?author_slug={slug} - Only pick matching images
+	// ?exclude={id},{id} - Don't pick the given images
+	// ?grayscale, ?blur={amount} - Same as for the image routes
+
+	// Image routes
+	a.imageRoutes(router, "api.")
 
 	// Image info routes
-	router.Handle("/id/{id}/info", handler.Handler(a.infoHandler)).Methods("GET").Name("api.info")
-	router.Handle("/seed/{seed}/info", handler.Handler(a.infoSeedHandler)).Methods("GET").Name("api.infoSeed")
+	router.Handle("/id/{id}/info", handler.Handler(a.infoHandler)).Methods("GET", "HEAD").Name("api.info")
+	router.Handle("/seed/{seed}/info", handler.Handler(a.infoSeedHandler)).Methods("GET", "HEAD").Name("api.infoSeed")
+	router.Handle("/daily/info", handler.Handler(a.dailyInfoHandler)).Methods("GET", "HEAD").Name("api.dailyInfo")
 
-	// Image by seed routes
-	router.Handle("/seed/{seed}/{size:[0-9]+}{extension:(?:\\..*)?}", handler.Handler(a.seedImageRedirectHandler)).Methods("GET").Name("api.seedImageRedirect")
-	router.Handle("/seed/{seed}/{width:[0-9]+}/{height:[0-9]+}{extension:(?:\\..*)?}", handler.Handler(a.seedImageRedirectHandler)).Methods("GET").Name("api.seedImageRedirect")
+	// Responsive image srcset
+	router.Handle("/id/{id}/srcset", handler.Handler(a.srcsetHandler)).Methods("GET", "HEAD").Name("api.srcset")
 
 	// Query parameters:
-	// ?grayscale - Grayscale the image
-	// ?blur - Blur the image
-	// ?blur={amount} - Blur the image by {amount}
+	// ?widths={width},{width} - The widths to include
+	// ?ratio={width}:{height} - The aspect ratio of the images, defaults to the aspect ratio of the image
+	// ?sizes={sizes} - The sizes attribute of the <img> tag
+	// ?grayscale, ?blur={amount} - Same as for the image routes
 
-	// Deprecated query parameters:
-	// ?image={id} - Get image by id
+	// Resolve routes, returning the signed image service URL and image info as JSON instead of redirecting
+	// Available for all the image routes, e.g. /v2/resolve/id/{id}/{width}/{height}
+	resolveRouter := router.PathPrefix("/v2/resolve").Subrouter()
+	resolveRouter.Use(resolve)
+	a.imageRoutes(resolveRouter, "api.resolve.")
+
+	// Deep zoom tiles, described by the Deep Zoom descriptor
+	router.Handle("/id/{id}/tiles.dzi", handler.Handler(a.dziHandler)).Methods("GET", "HEAD").Name("api.dzi")
+	router.Handle("/id/{id}/tiles/{level:[0-9]+}/{col:[0-9]+}_{row:[0-9]+}.jpg", handler.Handler(a.tileHandler)).Methods("GET", "HEAD").Name("api.tile")
+
+	// IIIF Image API 3.0
+	router.Handle("/iiif/3/{id}", handler.Handler(a.iiifBaseHandler)).Methods("GET", "HEAD").Name("api.iiifBase")
+	router.Handle("/iiif/3/{id}/info.json", handler.Handler(a.iiifInfoHandler)).Methods("GET", "HEAD").Name("api.iiifInfo")
+	router.Handle("/iiif/3/{id}/{region}/{size}/{rotation}/{quality:[a-z]+}.{format:[a-z]+}", handler.Handler(a.iiifImageHandler)).Methods("GET", "HEAD").Name("api.iiifImage")
+
+	// oEmbed, for the image routes, registered after them to match the URL against them
+	// ?url={url} - The URL of an image route
+	// ?format=json - The response format, only json is supported
+	// ?maxwidth={width}, ?maxheight={height} - Scale the image down to fit, keeping the aspect ratio
+	router.Handle("/oembed", handler.Handler(a.oembedHandler(router))).Methods("GET", "HEAD").Name("api.oembed")
 
 	// Deprecated routes
-	router.Handle("/list", handler.Handler(a.deprecatedListHandler)).Methods("GET").Name("api.deprecatedList")
-	router.Handle("/g/{size:[0-9]+}{extension:(?:\\..*)?}", handler.Handler(a.deprecatedImageHandler)).Methods("GET").Name("api.deprecatedImage")
-	router.Handle("/g/{width:[0-9]+}/{height:[0-9]+}{extension:(?:\\..*)?}", handler.Handler(a.deprecatedImageHandler)).Methods("GET").Name("api.deprecatedImage")
+	router.Handle("/list", handler.Handler(a.deprecatedListHandler)).Methods("GET", "HEAD").Name("api.deprecatedList")
+
+	// OpenAPI descriptions of the api and image service, registered last to include all the routes
+	openAPIRoute := router.Handle("/v2/openapi.json", nil).Methods("GET", "HEAD").Name("api.openapi")
+	imageServiceOpenAPIRoute := router.Handle("/v2/openapi-image-service.json", nil).Methods("GET", "HEAD").Name("api.openapiImageService")
+
+	apiSpec, err := a.openAPISpec(router)
+	if err != nil {
+		return nil, err
+	}
+	openAPIRoute.Handler(a.openAPIHandler(apiSpec))
+
+	imageServiceSpec, err := a.imageServiceOpenAPISpec((&imageapi.API{}).Mux())
+	if err != nil {
+		return nil, err
+	}
+	imageServiceOpenAPIRoute.Handler(a.openAPIHandler(imageServiceSpec))
 
 	// Static files
 	staticFS, err := fs.Sub(web.Static, "embed")
@@ -97,26 +163,135 @@ func (a *API) Router() (http.Handler, error) {
 
 	// Set up handlers
 	cors := cors.New(cors.Options{
-		AllowedMethods: []string{"GET"},
+		AllowedMethods: []string{"GET", "HEAD"},
 		AllowedOrigins: []string{"*"},
+		AllowedHeaders: []string{"Authorization"},
+		ExposedHeaders: []string{"Content-Type", "Link", "X-Total-Count", "ETag", "Picsum-ID", "Picsum-Author", "Picsum-Author-URL", "RateLimit-Limit", "RateLimit-Remaining", "RateLimit-Reset", "RateLimit-Policy", "Retry-After"},
 	})
 
-	httpHandler := cors.Handler(router)
+	routeMatcher := &handler.MuxRouteMatcher{Router: router}
+
+	var httpHandler http.Handler = router
+	if a.RateLimits != nil {
+		httpHandler = handler.RateLimit(a.RateLimits.Limiter, httpHandler, routeMatcher, a.rateLimitBudget)
+	}
+
+	// Authenticate API keys before rate limiting, as they have their own budgets
+	if a.APIKeys != nil {
+		// Unknown keys are charged to the anonymous budget of the client, so that keys can't be guessed without a limit
+		var invalidKey http.Handler = handler.Handler(invalidAPIKeyHandler)
+		if a.RateLimits != nil {
+			invalidKey = handler.RateLimit(a.RateLimits.Limiter, invalidKey, routeMatcher, func(r *http.Request, route string) *handler.Budget {
+				return a.RateLimits.Redirects
+			})
+		}
+
+		httpHandler = a.authenticate(httpHandler, invalidKey)
+	}
+
+	httpHandler = cors.Handler(httpHandler)
 	httpHandler = handler.Recovery(a.Log, httpHandler)
 	httpHandler = http.TimeoutHandler(httpHandler, a.HandlerTimeout, "Something went wrong. Timed out.")
 	httpHandler = handler.Logger(a.Log, httpHandler)
 
-	routeMatcher := &handler.MuxRouteMatcher{Router: router}
 	httpHandler = handler.Tracer(a.Tracer, httpHandler, routeMatcher)
 	httpHandler = handler.Metrics(httpHandler, routeMatcher)
 
 	return httpHandler, nil
 }
 
+// rateLimitBudget returns the rate limit budget of a request to a route, using the budgets of its API key if it has one
+// Routes returning images use the images budget when the images are processed for them through the image proxy
+func (a *API) rateLimitBudget(r *http.Request, route string) *handler.Budget {
+	// The website isn't limited, as browsers request all of its assets at once
+	if route == "api.serveFile" {
+		return nil
+	}
+
+	redirects, images := a.RateLimits.Redirects, a.RateLimits.Images
+	if key := getAPIKey(r); key != nil {
+		redirects, images = key.Budgets()
+	}
+
+	if a.ImageProxy != nil && imageBudgetRoutes[route] {
+		return images
+	}
+
+	return redirects
+}
+
+// imageBudgetRoutes are the routes that return images, using the images budget when they're served through the image proxy
+// The resolve routes return JSON, and other routes redirect or return metadata, so they use the redirects budget
+var imageBudgetRoutes = map[string]bool{
+	"api.randomImageRedirect":  true,
+	"api.imageRedirect":        true,
+	"api.ratioImageRedirect":   true,
+	"api.tagImageRedirect":     true,
+	"api.tagSeedImageRedirect": true,
+	"api.authorImageRedirect":  true,
+	"api.seedImageRedirect":    true,
+	"api.dailyImageRedirect":   true,
+	"api.deprecatedImage":      true,
+	"api.tile":                 true,
+	"api.iiifImage":            true,
+}
+
+// imageRoutes adds the routes for images to the router, with the route names prefixed by name
+func (a *API) imageRoutes(router *mux.Router, name string) {
+	oldRouter := router.PathPrefix("").Subrouter()
+	oldRouter.Use(a.deprecatedParams)
+
+	oldRouter.Handle("/{size:[0-9]+}{extension:(?:\\..*)?}", handler.Handler(a.randomImageRedirectHandler)).Methods("GET", "HEAD").Name(name + "randomImageRedirect")
+	oldRouter.Handle("/{width:[0-9]+}/{height:[0-9]+}{extension:(?:\\..*)?}", handler.Handler(a.randomImageRedirectHandler)).Methods("GET", "HEAD").Name(name + "randomImageRedirect")
+
+	// Image by ID routes
+	router.Handle("/id/{id}/{size:[0-9]+}{extension:(?:\\..*)?}", handler.Handler(a.imageRedirectHandler)).Methods("GET", "HEAD").Name(name + "imageRedirect")
+	router.Handle("/id/{id}/{width:[0-9]+}/{height:[0-9]+}{extension:(?:\\..*)?}", handler.Handler(a.imageRedirectHandler)).Methods("GET", "HEAD").Name(name + "imageRedirect")
+
+	// Image by aspect ratio routes
+	router.Handle("/ratio/{ratio:[0-9]+:[0-9]+}/{width:[0-9]+}{extension:(?:\\..*)?}", handler.Handler(a.ratioImageRedirectHandler)).Methods("GET", "HEAD").Name(name + "ratioImageRedirect")
+	router.Handle("/id/{id}/ratio/{ratio:[0-9]+:[0-9]+}/{width:[0-9]+}{extension:(?:\\..*)?}", handler.Handler(a.imageRedirectHandler)).Methods("GET", "HEAD").Name(name + "imageRedirect")
+
+	// Image by tag routes
+	router.Handle("/tag/{tag}/{size:[0-9]+}{extension:(?:\\..*)?}", handler.Handler(a.randomImageRedirectHandler)).Methods("GET", "HEAD").Name(name + "tagImageRedirect")
+	router.Handle("/tag/{tag}/{width:[0-9]+}/{height:[0-9]+}{extension:(?:\\..*)?}", handler.Handler(a.randomImageRedirectHandler)).Methods("GET", "HEAD").Name(name + "tagImageRedirect")
+	router.Handle("/tag/{tag}/seed/{seed}/{size:[0-9]+}{extension:(?:\\..*)?}", handler.Handler(a.seedImageRedirectHandler)).Methods("GET", "HEAD").Name(name + "tagSeedImageRedirect")
+	router.Handle("/tag/{tag}/seed/{seed}/{width:[0-9]+}/{height:[0-9]+}{extension:(?:\\..*)?}", handler.Handler(a.seedImageRedirectHandler)).Methods("GET", "HEAD").Name(name + "tagSeedImageRedirect")
+
+	// Image by author routes
+	router.Handle("/author/{slug}/{size:[0-9]+}{extension:(?:\\..*)?}", handler.Handler(a.randomImageRedirectHandler)).Methods("GET", "HEAD").Name(name + "authorImageRedirect")
+	router.Handle("/author/{slug}/{width:[0-9]+}/{height:[0-9]+}{extension:(?:\\..*)?}", handler.Handler(a.randomImageRedirectHandler)).Methods("GET", "HEAD").Name(name + "authorImageRedirect")
+
+	// Image by seed routes
+	router.Handle("/seed/{seed}/{size:[0-9]+}{extension:(?:\\..*)?}", handler.Handler(a.seedImageRedirectHandler)).Methods("GET", "HEAD").Name(name + "seedImageRedirect")
+	router.Handle("/seed/{seed}/{width:[0-9]+}/{height:[0-9]+}{extension:(?:\\..*)?}", handler.Handler(a.seedImageRedirectHandler)).Methods("GET", "HEAD").Name(name + "seedImageRedirect")
+
+	// Image of the day routes, cached until the next day starts
+	router.Handle("/daily/{size:[0-9]+}{extension:(?:\\..*)?}", handler.Handler(a.dailyImageRedirectHandler)).Methods("GET", "HEAD").Name(name + "dailyImageRedirect")
+	router.Handle("/daily/{width:[0-9]+}/{height:[0-9]+}{extension:(?:\\..*)?}", handler.Handler(a.dailyImageRedirectHandler)).Methods("GET", "HEAD").Name(name + "dailyImageRedirect")
+
+	// Query parameters:
+	// ?orientation={orientation} - Only pick landscape, portrait or square images for random and seed routes
+	// ?exclude={id},{id} - Don't pick the given images for random and seed routes
+	// ?grayscale - Grayscale the image
+	// ?blur - Blur the image
+	// ?blur={amount} - Blur the image by {amount}
+	// ?date={YYYY-MM-DD} - Get the image of the day for the date
+	// ?tz={timezone} - Get the image of the day for the current date in the time zone, instead of UTC
+
+	// Deprecated query parameters:
+	// ?image={id} - Get image by id
+
+	// Deprecated routes
+	router.Handle("/g/{size:[0-9]+}{extension:(?:\\..*)?}", handler.Handler(a.deprecatedImageHandler)).Methods("GET", "HEAD").Name(name + "deprecatedImage")
+	router.Handle("/g/{width:[0-9]+}/{height:[0-9]+}{extension:(?:\\..*)?}", handler.Handler(a.deprecatedImageHandler)).Methods("GET", "HEAD").Name(name + "deprecatedImage")
+}
+
 // Handle not found errors
 var notFoundError = &handler.Error{
-	Message: "page not found",
-	Code:    http.StatusNotFound,
+	Message:   "page not found",
+	Code:      http.StatusNotFound,
+	ErrorCode: "page_not_found",
 }
 
 func (a *API) notFoundHandler(w http.ResponseWriter, r *http.Request) *handler.Error {
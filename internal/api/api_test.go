@@ -2,19 +2,31 @@ package api_test
 
 import (
 	"context"
+	"encoding/base64"
 	"encoding/json"
+	"expvar"
 	"fmt"
+	"html"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"os"
+	"path/filepath"
 	"reflect"
+	"sort"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/DMarby/picsum-photos/internal/api"
+	"github.com/DMarby/picsum-photos/internal/apikey"
 	"github.com/DMarby/picsum-photos/internal/database"
+	"github.com/DMarby/picsum-photos/internal/handler"
 	"github.com/DMarby/picsum-photos/internal/hmac"
+	"github.com/DMarby/picsum-photos/internal/iiif"
 	"github.com/DMarby/picsum-photos/internal/logger"
+	"github.com/DMarby/picsum-photos/internal/params"
 	"github.com/DMarby/picsum-photos/internal/tracing"
 	"go.opentelemetry.io/otel/trace"
 	"go.uber.org/zap"
@@ -34,6 +46,7 @@ func TestAPI(t *testing.T) {
 
 	db, _ := fileDatabase.New("../../test/fixtures/file/metadata.json")
 	dbMultiple, _ := fileDatabase.New("../../test/fixtures/file/metadata_multiple.json")
+	dbVaried, _ := fileDatabase.New("../../test/fixtures/file/metadata_varied.json")
 
 	hmac := &hmac.HMAC{
 		Key: []byte("test"),
@@ -49,9 +62,64 @@ func TestAPI(t *testing.T) {
 		},
 	}
 
-	router, _ := (&api.API{db, log, tracer, rootURL, imageServiceURL, time.Minute, hmac}).Router()
-	paginationRouter, _ := (&api.API{dbMultiple, log, tracer, rootURL, imageServiceURL, time.Minute, hmac}).Router()
-	mockDatabaseRouter, _ := (&api.API{&mockDatabase.Provider{}, log, tracer, rootURL, imageServiceURL, time.Minute, hmac}).Router()
+	// Router returns an error when a route is missing from the OpenAPI description
+	router, err := (&api.API{Database: db, Log: log, Tracer: tracer, RootURL: rootURL, ImageServiceURL: imageServiceURL, HandlerTimeout: time.Minute, HMAC: hmac}).Router()
+	if err != nil {
+		t.Fatal(err)
+	}
+	paginationRouter, _ := (&api.API{Database: dbMultiple, Log: log, Tracer: tracer, RootURL: rootURL, ImageServiceURL: imageServiceURL, HandlerTimeout: time.Minute, HMAC: hmac}).Router()
+	variedRouter, _ := (&api.API{Database: dbVaried, Log: log, Tracer: tracer, RootURL: rootURL, ImageServiceURL: imageServiceURL, HandlerTimeout: time.Minute, HMAC: hmac}).Router()
+	mockDatabaseRouter, _ := (&api.API{Database: &mockDatabase.Provider{}, Log: log, Tracer: tracer, RootURL: rootURL, ImageServiceURL: imageServiceURL, HandlerTimeout: time.Minute, HMAC: hmac}).Router()
+
+	// Image service listening on a unix socket, responding with the requested path
+	imageServiceListener, err := net.Listen("unix", filepath.Join(t.TempDir(), "image-service.sock"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	imageService := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "public, max-age=2592000, immutable")
+		w.Header().Set("Content-Type", "image/jpeg")
+		if r.Header.Get("Authorization") != "" {
+			w.Header().Set("Test-Authorization", r.Header.Get("Authorization"))
+		}
+		w.Write([]byte(r.URL.RequestURI()))
+	}))
+	imageService.Listener = imageServiceListener
+	imageService.Start()
+	defer imageService.Close()
+
+	proxyRouter, _ := (&api.API{Database: db, Log: log, Tracer: tracer, RootURL: rootURL, ImageServiceURL: imageServiceURL, HandlerTimeout: time.Minute, HMAC: hmac, ImageProxy: api.UnixSocketProxy(imageServiceListener.Addr().String(), log)}).Router()
+	proxiedImagePath, _ := imageServicePath(hmac, "/id/1/200/300.jpg?grayscale")
+
+	randomImageURL, _ := imageServiceLocation(hmac, "/id/1/400/300.webp?blur=2&grayscale")
+	resolvedIDURL, _ := imageServiceLocation(hmac, "/id/1/200/300.jpg?grayscale")
+	resolvedSeedURL, _ := imageServiceLocation(hmac, "/id/1/200/200.webp")
+	resolvedDeprecatedURL, _ := imageServiceLocation(hmac, "/id/1/300/400.jpg?grayscale")
+
+	oembedURL, _ := imageServiceLocation(hmac, "/id/1/200/300.jpg")
+	oembedMaxWidthURL, _ := imageServiceLocation(hmac, "/id/1/100/150.jpg?grayscale")
+
+	srcsetURLs := map[string]string{}
+	for _, path := range []string{"/id/1/150/150.avif?grayscale", "/id/1/300/300.avif?grayscale", "/id/1/150/150.webp?grayscale", "/id/1/300/300.webp?grayscale", "/id/1/150/150.jpg?grayscale", "/id/1/300/300.jpg?grayscale"} {
+		srcsetURLs[path], _ = imageServiceLocation(hmac, path)
+	}
+
+	// The image info returned by the resolve routes for the image in metadata.json
+	capturedAt := time.Date(2015, 6, 2, 14, 30, 0, 0, time.FixedZone("", 2*60*60))
+
+	resolvedListImage := api.ListImage{
+		Image: database.Image{
+			ID:     "1",
+			Author: "John Doe",
+			URL:    "https://picsum.photos",
+			Width:  300,
+			Height: 400,
+		},
+		DownloadURL: fmt.Sprintf("%s/id/1/300/400", rootURL),
+	}
+
+	// Cursor pointing at the first image
+	firstCursor := base64.RawURLEncoding.EncodeToString([]byte(`{"id":"1","author":"John Doe","width":300}`))
 
 	tests := []struct {
 		Name             string
@@ -89,10 +157,10 @@ func TestAPI(t *testing.T) {
 				},
 			}),
 			ExpectedHeaders: map[string]string{
-				"Content-Type":                  "application/json",
-				"Link":                          fmt.Sprintf("<%s/v2/list?page=2&limit=30>; rel=\"next\"", rootURL),
-				"Cache-Control":                 "private, no-cache, no-store, must-revalidate",
-				"Access-Control-Expose-Headers": "Link",
+				"Content-Type":  "application/json",
+				"Link":          fmt.Sprintf("<%s/v2/list?page=1&limit=30>; rel=\"first\", <%s/v2/list?page=1&limit=30>; rel=\"last\"", rootURL, rootURL),
+				"X-Total-Count": "2",
+				"Cache-Control": "private, no-cache",
 			},
 		},
 		{
@@ -124,8 +192,8 @@ func TestAPI(t *testing.T) {
 			}),
 			ExpectedHeaders: map[string]string{
 				"Content-Type":  "application/json",
-				"Link":          fmt.Sprintf("<%s/v2/list?page=2&limit=100>; rel=\"next\"", rootURL),
-				"Cache-Control": "private, no-cache, no-store, must-revalidate",
+				"Link":          fmt.Sprintf("<%s/v2/list?page=1&limit=100>; rel=\"first\", <%s/v2/list?page=1&limit=100>; rel=\"last\"", rootURL, rootURL),
+				"Cache-Control": "private, no-cache",
 			},
 		},
 		{
@@ -146,10 +214,9 @@ func TestAPI(t *testing.T) {
 				},
 			}),
 			ExpectedHeaders: map[string]string{
-				"Content-Type":                  "application/json",
-				"Link":                          fmt.Sprintf("<%s/v2/list?page=2&limit=1>; rel=\"next\"", rootURL),
-				"Cache-Control":                 "private, no-cache, no-store, must-revalidate",
-				"Access-Control-Expose-Headers": "Link",
+				"Content-Type":  "application/json",
+				"Link":          fmt.Sprintf("<%s/v2/list?page=1&limit=1>; rel=\"first\", <%s/v2/list?page=2&limit=1>; rel=\"next\", <%s/v2/list?page=2&limit=1>; rel=\"last\"", rootURL, rootURL, rootURL),
+				"Cache-Control": "private, no-cache",
 			},
 		},
 		{
@@ -170,10 +237,9 @@ func TestAPI(t *testing.T) {
 				},
 			}),
 			ExpectedHeaders: map[string]string{
-				"Content-Type":                  "application/json",
-				"Link":                          fmt.Sprintf("<%s/v2/list?page=1&limit=1>; rel=\"prev\", <%s/v2/list?page=3&limit=1>; rel=\"next\"", rootURL, rootURL),
-				"Cache-Control":                 "private, no-cache, no-store, must-revalidate",
-				"Access-Control-Expose-Headers": "Link",
+				"Content-Type":  "application/json",
+				"Link":          fmt.Sprintf("<%s/v2/list?page=1&limit=1>; rel=\"first\", <%s/v2/list?page=1&limit=1>; rel=\"prev\", <%s/v2/list?page=2&limit=1>; rel=\"last\"", rootURL, rootURL, rootURL),
+				"Cache-Control": "private, no-cache",
 			},
 		},
 		{
@@ -183,10 +249,9 @@ func TestAPI(t *testing.T) {
 			ExpectedStatus:   http.StatusOK,
 			ExpectedResponse: marshalJson([]api.ListImage{}),
 			ExpectedHeaders: map[string]string{
-				"Content-Type":                  "application/json",
-				"Link":                          fmt.Sprintf("<%s/v2/list?page=2&limit=1>; rel=\"prev\"", rootURL),
-				"Cache-Control":                 "private, no-cache, no-store, must-revalidate",
-				"Access-Control-Expose-Headers": "Link",
+				"Content-Type":  "application/json",
+				"Link":          fmt.Sprintf("<%s/v2/list?page=1&limit=1>; rel=\"first\", <%s/v2/list?page=2&limit=1>; rel=\"prev\", <%s/v2/list?page=2&limit=1>; rel=\"last\"", rootURL, rootURL, rootURL),
+				"Cache-Control": "private, no-cache",
 			},
 		},
 		{
@@ -230,7 +295,7 @@ func TestAPI(t *testing.T) {
 			),
 			ExpectedHeaders: map[string]string{
 				"Content-Type":  "application/json",
-				"Cache-Control": "private, no-cache, no-store, must-revalidate",
+				"Cache-Control": "private, no-cache",
 			},
 		},
 		{
@@ -250,6 +315,431 @@ func TestAPI(t *testing.T) {
 					DownloadURL: fmt.Sprintf("%s/id/2/300/400", rootURL),
 				},
 			),
+			ExpectedHeaders: map[string]string{
+				"Content-Type":  "application/json",
+				"Cache-Control": "private, no-cache",
+			},
+		},
+		{
+			Name:           "/seed/{seed}/info?orientation returns info about an image with the orientation",
+			URL:            "/seed/1/info?orientation=landscape",
+			Router:         variedRouter,
+			ExpectedStatus: http.StatusOK,
+			ExpectedResponse: marshalJson(
+				api.ListImage{
+					Image: database.Image{
+						ID:          "3",
+						Author:      "Jane Doe",
+						AuthorURL:   "https://picsum.photos/authors/jane-doe",
+						URL:         "https://picsum.photos",
+						Width:       1600,
+						Height:      900,
+						Tags:        []string{"nature", "city"},
+						Title:       "Harbour",
+						Description: "Boats in a harbour at dusk",
+						License:     "CC0 1.0",
+						SourceURL:   "https://picsum.photos/sources/3",
+						CameraModel: "Canon EOS 5D",
+						FocalLength: 35,
+						CapturedAt:  &capturedAt,
+					},
+					DownloadURL: fmt.Sprintf("%s/id/3/1600/900", rootURL),
+				},
+			),
+			ExpectedHeaders: map[string]string{
+				"Content-Type":  "application/json",
+				"Cache-Control": "private, no-cache",
+			},
+		},
+		{
+			Name:           "/v2/list cursor pagination first page",
+			URL:            "/v2/list?cursor=&limit=1",
+			Router:         paginationRouter,
+			ExpectedStatus: http.StatusOK,
+			ExpectedResponse: marshalJson([]api.ListImage{
+				{
+					Image: database.Image{
+						ID:     "1",
+						Author: "John Doe",
+						URL:    "https://picsum.photos",
+						Width:  300,
+						Height: 400,
+					},
+					DownloadURL: fmt.Sprintf("%s/id/1/300/400", rootURL),
+				},
+			}),
+			ExpectedHeaders: map[string]string{
+				"Content-Type":  "application/json",
+				"Link":          fmt.Sprintf("<%s/v2/list?cursor=&limit=1>; rel=\"first\", <%s/v2/list?cursor=%s&limit=1>; rel=\"next\"", rootURL, rootURL, firstCursor),
+				"X-Total-Count": "2",
+			},
+		},
+		{
+			Name:           "/v2/list cursor pagination last page",
+			URL:            fmt.Sprintf("/v2/list?cursor=%s&limit=1", firstCursor),
+			Router:         paginationRouter,
+			ExpectedStatus: http.StatusOK,
+			ExpectedResponse: marshalJson([]api.ListImage{
+				{
+					Image: database.Image{
+						ID:     "2",
+						Author: "John Doe",
+						URL:    "https://picsum.photos",
+						Width:  300,
+						Height: 400,
+					},
+					DownloadURL: fmt.Sprintf("%s/id/2/300/400", rootURL),
+				},
+			}),
+			ExpectedHeaders: map[string]string{
+				"Content-Type":  "application/json",
+				"Link":          fmt.Sprintf("<%s/v2/list?cursor=&limit=1>; rel=\"first\"", rootURL),
+				"X-Total-Count": "2",
+			},
+		},
+		{
+			Name:           "/v2/list filters and sorts images",
+			URL:            "/v2/list?author=jane%20doe&sort=width&limit=1",
+			Router:         variedRouter,
+			ExpectedStatus: http.StatusOK,
+			ExpectedResponse: marshalJson([]api.ListImage{
+				{
+					Image: database.Image{
+						ID:     "4",
+						Author: "Jane Doe",
+						URL:    "https://picsum.photos",
+						Width:  500,
+						Height: 500,
+					},
+					DownloadURL: fmt.Sprintf("%s/id/4/500/500", rootURL),
+				},
+			}),
+			ExpectedHeaders: map[string]string{
+				"Content-Type":  "application/json",
+				"Link":          fmt.Sprintf("<%s/v2/list?page=1&limit=1&author=jane+doe&sort=width>; rel=\"first\", <%s/v2/list?page=2&limit=1&author=jane+doe&sort=width>; rel=\"next\", <%s/v2/list?page=2&limit=1&author=jane+doe&sort=width>; rel=\"last\"", rootURL, rootURL, rootURL),
+				"X-Total-Count": "2",
+				"Cache-Control": "private, no-cache",
+			},
+		},
+		{
+			Name:           "/v2/list returns the metadata of the images",
+			URL:            "/v2/list?min_width=1000",
+			Router:         variedRouter,
+			ExpectedStatus: http.StatusOK,
+			ExpectedResponse: marshalJson([]api.ListImage{
+				{
+					Image: database.Image{
+						ID:          "3",
+						Author:      "Jane Doe",
+						AuthorURL:   "https://picsum.photos/authors/jane-doe",
+						URL:         "https://picsum.photos",
+						Width:       1600,
+						Height:      900,
+						Tags:        []string{"nature", "city"},
+						Title:       "Harbour",
+						Description: "Boats in a harbour at dusk",
+						License:     "CC0 1.0",
+						SourceURL:   "https://picsum.photos/sources/3",
+						CameraModel: "Canon EOS 5D",
+						FocalLength: 35,
+						CapturedAt:  &capturedAt,
+					},
+					DownloadURL: fmt.Sprintf("%s/id/3/1600/900", rootURL),
+				},
+			}),
+			ExpectedHeaders: map[string]string{
+				"Content-Type":  "application/json",
+				"X-Total-Count": "1",
+				"Cache-Control": "private, no-cache",
+			},
+		},
+		{
+			Name:             "/v2/list keeps filters in the Link header",
+			URL:              "/v2/list?page=2&limit=1&min_width=400&orientation=landscape&sort=shuffle&seed=picsum",
+			Router:           variedRouter,
+			ExpectedStatus:   http.StatusOK,
+			ExpectedResponse: marshalJson([]api.ListImage{}),
+			ExpectedHeaders: map[string]string{
+				"Content-Type":  "application/json",
+				"Link":          fmt.Sprintf("<%s/v2/list?page=1&limit=1&min_width=400&orientation=landscape&seed=picsum&sort=shuffle>; rel=\"first\", <%s/v2/list?page=1&limit=1&min_width=400&orientation=landscape&seed=picsum&sort=shuffle>; rel=\"prev\", <%s/v2/list?page=1&limit=1&min_width=400&orientation=landscape&seed=picsum&sort=shuffle>; rel=\"last\"", rootURL, rootURL, rootURL),
+				"X-Total-Count": "1",
+				"Cache-Control": "private, no-cache",
+			},
+		},
+		{
+			Name:           "/v2/authors lists authors",
+			URL:            "/v2/authors",
+			Router:         variedRouter,
+			ExpectedStatus: http.StatusOK,
+			ExpectedResponse: marshalJson([]api.ListAuthor{
+				{
+					Author:    database.Author{Name: "Jane Doe", Slug: "jane-doe", URL: "https://picsum.photos/authors/jane-doe", Count: 2},
+					ImagesURL: fmt.Sprintf("%s/v2/authors/jane-doe/images", rootURL),
+				},
+				{
+					Author:    database.Author{Name: "John Doe", Slug: "john-doe", Count: 2},
+					ImagesURL: fmt.Sprintf("%s/v2/authors/john-doe/images", rootURL),
+				},
+			}),
+			ExpectedHeaders: map[string]string{
+				"Content-Type":  "application/json",
+				"Cache-Control": "private, no-cache, no-store, must-revalidate",
+			},
+		},
+		{
+			Name:           "/v2/authors/{slug}/images lists the images of an author",
+			URL:            "/v2/authors/jane-doe/images?limit=1&sort=width",
+			Router:         variedRouter,
+			ExpectedStatus: http.StatusOK,
+			ExpectedResponse: marshalJson([]api.ListImage{
+				{
+					Image: database.Image{
+						ID:     "4",
+						Author: "Jane Doe",
+						URL:    "https://picsum.photos",
+						Width:  500,
+						Height: 500,
+					},
+					DownloadURL: fmt.Sprintf("%s/id/4/500/500", rootURL),
+				},
+			}),
+			ExpectedHeaders: map[string]string{
+				"Content-Type":  "application/json",
+				"Link":          fmt.Sprintf("<%s/v2/authors/jane-doe/images?page=1&limit=1&sort=width>; rel=\"first\", <%s/v2/authors/jane-doe/images?page=2&limit=1&sort=width>; rel=\"next\", <%s/v2/authors/jane-doe/images?page=2&limit=1&sort=width>; rel=\"last\"", rootURL, rootURL, rootURL),
+				"X-Total-Count": "2",
+				"Cache-Control": "private, no-cache",
+			},
+		},
+		{
+			Name:           "/v2/random returns random images",
+			URL:            "/v2/random?count=5&width=400&height=300&format=webp&grayscale&blur=2",
+			Router:         router,
+			ExpectedStatus: http.StatusOK,
+			ExpectedResponse: marshalJson([]api.ResolvedImage{
+				{
+					Image: api.ListImage{
+						Image: database.Image{
+							ID:     "1",
+							Author: "John Doe",
+							URL:    "https://picsum.photos",
+							Width:  300,
+							Height: 400,
+						},
+						DownloadURL: fmt.Sprintf("%s/id/1/300/400", rootURL),
+					},
+					Width:  400,
+					Height: 300,
+					URL:    randomImageURL,
+				},
+			}),
+			ExpectedHeaders: map[string]string{
+				"Content-Type":  "application/json",
+				"Cache-Control": "private, no-cache, no-store, must-revalidate",
+			},
+		},
+		{
+			Name:           "/v2/tags lists tags",
+			URL:            "/v2/tags",
+			Router:         variedRouter,
+			ExpectedStatus: http.StatusOK,
+			ExpectedResponse: marshalJson([]database.Tag{
+				{Name: "city", Count: 2},
+				{Name: "nature", Count: 2},
+			}),
+			ExpectedHeaders: map[string]string{
+				"Content-Type":  "application/json",
+				"Cache-Control": "private, no-cache, no-store, must-revalidate",
+			},
+		},
+		{
+			Name:             "/v2/resolve/id/:id/:width/:height resolves an image",
+			URL:              "/v2/resolve/id/1/200/300?grayscale",
+			Router:           router,
+			ExpectedStatus:   http.StatusOK,
+			ExpectedResponse: marshalJson(api.ResolvedImage{Image: resolvedListImage, Width: 200, Height: 300, URL: resolvedIDURL}),
+			ExpectedHeaders: map[string]string{
+				"Content-Type":  "application/json",
+				"Cache-Control": "private, no-cache, no-store, must-revalidate",
+			},
+		},
+		{
+			Name:             "/v2/resolve/seed/:seed/:size resolves an image",
+			URL:              "/v2/resolve/seed/1/200.webp",
+			Router:           router,
+			ExpectedStatus:   http.StatusOK,
+			ExpectedResponse: marshalJson(api.ResolvedImage{Image: resolvedListImage, Width: 200, Height: 200, URL: resolvedSeedURL}),
+			ExpectedHeaders: map[string]string{
+				"Content-Type":  "application/json",
+				"Cache-Control": "private, no-cache, no-store, must-revalidate",
+			},
+		},
+		{
+			Name:             "/v2/resolve/:width/:height?image resolves an image",
+			URL:              "/v2/resolve/200/300?image=1&grayscale",
+			Router:           router,
+			ExpectedStatus:   http.StatusOK,
+			ExpectedResponse: marshalJson(api.ResolvedImage{Image: resolvedListImage, Width: 200, Height: 300, URL: resolvedIDURL}),
+			ExpectedHeaders: map[string]string{
+				"Content-Type":  "application/json",
+				"Cache-Control": "private, no-cache, no-store, must-revalidate",
+			},
+		},
+		{
+			Name:             "/v2/resolve/g/:width/:height resolves an image",
+			URL:              "/v2/resolve/g/300/400",
+			Router:           router,
+			ExpectedStatus:   http.StatusOK,
+			ExpectedResponse: marshalJson(api.ResolvedImage{Image: resolvedListImage, Width: 300, Height: 400, URL: resolvedDeprecatedURL}),
+			ExpectedHeaders: map[string]string{
+				"Content-Type":  "application/json",
+				"Cache-Control": "private, no-cache, no-store, must-revalidate",
+			},
+		},
+		{
+			Name:             "/id/:id/:width/:height proxies the image",
+			URL:              "/id/1/200/300?grayscale",
+			Router:           proxyRouter,
+			ExpectedStatus:   http.StatusOK,
+			ExpectedResponse: []byte(proxiedImagePath),
+			ExpectedHeaders: map[string]string{
+				"Content-Type":  "image/jpeg",
+				"Cache-Control": "private, no-cache, no-store, must-revalidate",
+			},
+		},
+		{
+			Name:             "/v2/resolve/id/:id/:width/:height doesn't proxy the image",
+			URL:              "/v2/resolve/id/1/200/300?grayscale",
+			Router:           proxyRouter,
+			ExpectedStatus:   http.StatusOK,
+			ExpectedResponse: marshalJson(api.ResolvedImage{Image: resolvedListImage, Width: 200, Height: 300, URL: resolvedIDURL}),
+			ExpectedHeaders: map[string]string{
+				"Content-Type":  "application/json",
+				"Cache-Control": "private, no-cache, no-store, must-revalidate",
+			},
+		},
+		{
+			Name:           "/id/{id}/srcset returns a srcset for an image",
+			URL:            "/id/1/srcset?widths=300,150&ratio=1:1&grayscale",
+			Router:         router,
+			ExpectedStatus: http.StatusOK,
+			ExpectedResponse: marshalJson(api.Srcset{
+				Image: resolvedListImage,
+				Sources: []api.SrcsetSource{
+					{
+						Type:   "image/avif",
+						Srcset: fmt.Sprintf("%s 150w, %s 300w", srcsetURLs["/id/1/150/150.avif?grayscale"], srcsetURLs["/id/1/300/300.avif?grayscale"]),
+						Images: []api.SrcsetImage{
+							{Width: 150, Height: 150, URL: srcsetURLs["/id/1/150/150.avif?grayscale"]},
+							{Width: 300, Height: 300, URL: srcsetURLs["/id/1/300/300.avif?grayscale"]},
+						},
+					},
+					{
+						Type:   "image/webp",
+						Srcset: fmt.Sprintf("%s 150w, %s 300w", srcsetURLs["/id/1/150/150.webp?grayscale"], srcsetURLs["/id/1/300/300.webp?grayscale"]),
+						Images: []api.SrcsetImage{
+							{Width: 150, Height: 150, URL: srcsetURLs["/id/1/150/150.webp?grayscale"]},
+							{Width: 300, Height: 300, URL: srcsetURLs["/id/1/300/300.webp?grayscale"]},
+						},
+					},
+					{
+						Type:   "image/jpeg",
+						Srcset: fmt.Sprintf("%s 150w, %s 300w", srcsetURLs["/id/1/150/150.jpg?grayscale"], srcsetURLs["/id/1/300/300.jpg?grayscale"]),
+						Images: []api.SrcsetImage{
+							{Width: 150, Height: 150, URL: srcsetURLs["/id/1/150/150.jpg?grayscale"]},
+							{Width: 300, Height: 300, URL: srcsetURLs["/id/1/300/300.jpg?grayscale"]},
+						},
+					},
+				},
+				HTML: fmt.Sprintf(
+					`<picture><source type="image/avif" srcset="%s 150w, %s 300w" sizes="100vw"><source type="image/webp" srcset="%s 150w, %s 300w" sizes="100vw"><img src="%s" srcset="%s 150w, %s 300w" sizes="100vw" width="300" height="300" alt="Photo by John Doe" loading="lazy"></picture>`,
+					html.EscapeString(srcsetURLs["/id/1/150/150.avif?grayscale"]), html.EscapeString(srcsetURLs["/id/1/300/300.avif?grayscale"]),
+					html.EscapeString(srcsetURLs["/id/1/150/150.webp?grayscale"]), html.EscapeString(srcsetURLs["/id/1/300/300.webp?grayscale"]),
+					html.EscapeString(srcsetURLs["/id/1/300/300.jpg?grayscale"]),
+					html.EscapeString(srcsetURLs["/id/1/150/150.jpg?grayscale"]), html.EscapeString(srcsetURLs["/id/1/300/300.jpg?grayscale"]),
+				),
+			}),
+			ExpectedHeaders: map[string]string{
+				"Content-Type":  "application/json",
+				"Cache-Control": "private, no-cache, no-store, must-revalidate",
+			},
+		},
+
+		// Deep zoom
+		{
+			Name:             "/id/{id}/tiles.dzi returns the Deep Zoom descriptor",
+			URL:              "/id/1/tiles.dzi",
+			Router:           router,
+			ExpectedStatus:   http.StatusOK,
+			ExpectedResponse: []byte(fmt.Sprintf("<?xml version=\"1.0\" encoding=\"UTF-8\"?>\n<Image xmlns=\"http://schemas.microsoft.com/deepzoom/2008\" Url=\"%s/id/1/tiles/\" Format=\"jpg\" Overlap=\"1\" TileSize=\"256\"><Size Width=\"300\" Height=\"400\"></Size></Image>\n", rootURL)),
+			ExpectedHeaders: map[string]string{
+				"Content-Type":  "application/xml",
+				"Cache-Control": "private, no-cache",
+			},
+		},
+
+		// IIIF
+		{
+			Name:             "/iiif/3/{id}/info.json returns the IIIF image information",
+			URL:              "/iiif/3/1/info.json",
+			Router:           router,
+			ExpectedStatus:   http.StatusOK,
+			ExpectedResponse: marshalJson(iiif.NewInfo(rootURL+"/iiif/3/1", 300, 400, 5000)),
+			ExpectedHeaders: map[string]string{
+				"Content-Type":  "application/json",
+				"Cache-Control": "private, no-cache",
+			},
+		},
+		{
+			Name:             "/iiif/3/{id} redirects to the IIIF image information",
+			URL:              "/iiif/3/1",
+			Router:           router,
+			ExpectedStatus:   http.StatusSeeOther,
+			ExpectedResponse: []byte(fmt.Sprintf("<a href=\"%s/iiif/3/1/info.json\">See Other</a>.\n\n", rootURL)),
+			ExpectedHeaders: map[string]string{
+				"Location": rootURL + "/iiif/3/1/info.json",
+			},
+		},
+
+		// oEmbed
+		{
+			Name:           "/oembed returns an oEmbed photo response for an image URL",
+			URL:            "/oembed?url=" + url.QueryEscape(rootURL+"/id/1/200/300") + "&format=json",
+			Router:         router,
+			ExpectedStatus: http.StatusOK,
+			ExpectedResponse: marshalJson(api.OEmbed{
+				Type:         "photo",
+				Version:      "1.0",
+				Title:        "Photo by John Doe",
+				AuthorName:   "John Doe",
+				AuthorURL:    "https://picsum.photos",
+				ProviderName: "Lorem Picsum",
+				ProviderURL:  rootURL,
+				URL:          oembedURL,
+				Width:        200,
+				Height:       300,
+			}),
+			ExpectedHeaders: map[string]string{
+				"Content-Type":  "application/json",
+				"Cache-Control": "private, no-cache, no-store, must-revalidate",
+			},
+		},
+		{
+			Name:           "/oembed scales the image down to the max width and height",
+			URL:            "/oembed?url=" + url.QueryEscape(rootURL+"/g/200/300?image=1") + "&maxwidth=150&maxheight=150",
+			Router:         router,
+			ExpectedStatus: http.StatusOK,
+			ExpectedResponse: marshalJson(api.OEmbed{
+				Type:         "photo",
+				Version:      "1.0",
+				Title:        "Photo by John Doe",
+				AuthorName:   "John Doe",
+				AuthorURL:    "https://picsum.photos",
+				ProviderName: "Lorem Picsum",
+				ProviderURL:  rootURL,
+				URL:          oembedMaxWidthURL,
+				Width:        100,
+				Height:       150,
+			}),
 			ExpectedHeaders: map[string]string{
 				"Content-Type":  "application/json",
 				"Cache-Control": "private, no-cache, no-store, must-revalidate",
@@ -257,6 +747,32 @@ func TestAPI(t *testing.T) {
 		},
 
 		// Errors
+		{"nonexistant tile level", "/id/1/tiles/10/0_0.jpg", router, http.StatusNotFound, []byte("Tile does not exist\n"), map[string]string{"Content-Type": "text/plain; charset=utf-8", "Cache-Control": "private, no-cache, no-store, must-revalidate"}},
+		{"nonexistant tile", "/id/1/tiles/8/1_0.jpg", router, http.StatusNotFound, []byte("Tile does not exist\n"), map[string]string{"Content-Type": "text/plain; charset=utf-8", "Cache-Control": "private, no-cache, no-store, must-revalidate"}},
+		{"invalid image id", "/id/nonexistant/tiles.dzi", router, http.StatusNotFound, []byte("Image does not exist\n"), map[string]string{"Content-Type": "text/plain; charset=utf-8", "Cache-Control": "private, no-cache, no-store, must-revalidate"}},
+		{"invalid image id", "/id/nonexistant/tiles/0/0_0.jpg", router, http.StatusNotFound, []byte("Image does not exist\n"), map[string]string{"Content-Type": "text/plain; charset=utf-8", "Cache-Control": "private, no-cache, no-store, must-revalidate"}},
+		{"invalid date", "/daily/info?date=2026-13-01", router, http.StatusBadRequest, []byte("Invalid date\n"), map[string]string{"Content-Type": "text/plain; charset=utf-8", "Cache-Control": "private, no-cache, no-store, must-revalidate"}},
+		{"invalid timezone", "/daily/200?tz=Mars/Olympus_Mons", router, http.StatusBadRequest, []byte("Invalid timezone\n"), map[string]string{"Content-Type": "text/plain; charset=utf-8", "Cache-Control": "private, no-cache, no-store, must-revalidate"}},
+		{"invalid timezone", "/daily/info?tz=Local", router, http.StatusBadRequest, []byte("Invalid timezone\n"), map[string]string{"Content-Type": "text/plain; charset=utf-8", "Cache-Control": "private, no-cache, no-store, must-revalidate"}},
+		{"invalid iiif region", "/iiif/3/1/300,0,10,10/max/0/default.jpg", router, http.StatusBadRequest, []byte("Invalid region\n"), map[string]string{"Content-Type": "text/plain; charset=utf-8", "Cache-Control": "private, no-cache, no-store, must-revalidate"}},
+		{"invalid iiif size", "/iiif/3/1/full/600,/0/default.jpg", router, http.StatusBadRequest, []byte("Invalid size\n"), map[string]string{"Content-Type": "text/plain; charset=utf-8", "Cache-Control": "private, no-cache, no-store, must-revalidate"}},
+		{"invalid iiif size", "/iiif/3/1/full/^6000,/0/default.jpg", router, http.StatusBadRequest, []byte("Invalid size\n"), map[string]string{"Content-Type": "text/plain; charset=utf-8", "Cache-Control": "private, no-cache, no-store, must-revalidate"}},
+		{"invalid iiif rotation", "/iiif/3/1/full/max/45/default.jpg", router, http.StatusBadRequest, []byte("Invalid rotation\n"), map[string]string{"Content-Type": "text/plain; charset=utf-8", "Cache-Control": "private, no-cache, no-store, must-revalidate"}},
+		{"invalid iiif quality", "/iiif/3/1/full/max/0/bitonal.jpg", router, http.StatusBadRequest, []byte("Invalid quality\n"), map[string]string{"Content-Type": "text/plain; charset=utf-8", "Cache-Control": "private, no-cache, no-store, must-revalidate"}},
+		{"invalid iiif format", "/iiif/3/1/full/max/0/default.png", router, http.StatusBadRequest, []byte("Invalid format\n"), map[string]string{"Content-Type": "text/plain; charset=utf-8", "Cache-Control": "private, no-cache, no-store, must-revalidate"}},
+		{"invalid image id", "/iiif/3/nonexistant/full/max/0/default.jpg", router, http.StatusNotFound, []byte("Image does not exist\n"), map[string]string{"Content-Type": "text/plain; charset=utf-8", "Cache-Control": "private, no-cache, no-store, must-revalidate"}},
+		{"invalid image id", "/iiif/3/nonexistant/info.json", router, http.StatusNotFound, []byte("Image does not exist\n"), map[string]string{"Content-Type": "text/plain; charset=utf-8", "Cache-Control": "private, no-cache, no-store, must-revalidate"}},
+		{"invalid widths", "/id/1/srcset?widths=100,wide", router, http.StatusBadRequest, []byte("Invalid size\n"), map[string]string{"Content-Type": "text/plain; charset=utf-8", "Cache-Control": "private, no-cache, no-store, must-revalidate"}},
+		{"too many widths", "/id/1/srcset?widths=1,2,3,4,5,6,7,8,9,10,11", router, http.StatusBadRequest, []byte("Too many widths\n"), map[string]string{"Content-Type": "text/plain; charset=utf-8", "Cache-Control": "private, no-cache, no-store, must-revalidate"}},
+		{"invalid ratio", "/id/1/srcset?ratio=1:0", router, http.StatusBadRequest, []byte("Invalid ratio\n"), map[string]string{"Content-Type": "text/plain; charset=utf-8", "Cache-Control": "private, no-cache, no-store, must-revalidate"}},
+		{"invalid size", "/id/1/srcset?widths=6000", router, http.StatusBadRequest, []byte("Invalid size\n"), map[string]string{"Content-Type": "text/plain; charset=utf-8", "Cache-Control": "private, no-cache, no-store, must-revalidate"}},
+		{"invalid image id", "/id/nonexistant/srcset", router, http.StatusNotFound, []byte("Image does not exist\n"), map[string]string{"Content-Type": "text/plain; charset=utf-8", "Cache-Control": "private, no-cache, no-store, must-revalidate"}},
+		{"unsupported oembed format", "/oembed?url=" + url.QueryEscape(rootURL+"/id/1/200/300") + "&format=xml", router, http.StatusNotImplemented, []byte("Unsupported format\n"), map[string]string{"Content-Type": "text/plain; charset=utf-8", "Cache-Control": "private, no-cache, no-store, must-revalidate"}},
+		{"invalid oembed max width", "/oembed?url=" + url.QueryEscape(rootURL+"/id/1/200/300") + "&maxwidth=wide", router, http.StatusBadRequest, []byte("Invalid size\n"), map[string]string{"Content-Type": "text/plain; charset=utf-8", "Cache-Control": "private, no-cache, no-store, must-revalidate"}},
+		{"oembed url on another host", "/oembed?url=" + url.QueryEscape("https://other.example.com/id/1/200/300"), router, http.StatusNotFound, []byte("page not found\n"), map[string]string{"Content-Type": "text/plain; charset=utf-8", "Cache-Control": "private, no-cache, no-store, must-revalidate"}},
+		{"oembed url not an image route", "/oembed?url=" + url.QueryEscape(rootURL+"/v2/list"), router, http.StatusNotFound, []byte("page not found\n"), map[string]string{"Content-Type": "text/plain; charset=utf-8", "Cache-Control": "private, no-cache, no-store, must-revalidate"}},
+		{"oembed invalid image id", "/oembed?url=" + url.QueryEscape(rootURL+"/id/nonexistant/200/300"), router, http.StatusNotFound, []byte("Image does not exist\n"), map[string]string{"Content-Type": "text/plain; charset=utf-8", "Cache-Control": "private, no-cache, no-store, must-revalidate"}},
+		{"invalid image id", "/v2/resolve/id/nonexistant/200/300", router, http.StatusNotFound, []byte("Image does not exist\n"), map[string]string{"Content-Type": "text/plain; charset=utf-8", "Cache-Control": "private, no-cache, no-store, must-revalidate"}},
 		{"invalid image id", "/id/nonexistant/200/300", router, http.StatusNotFound, []byte("Image does not exist\n"), map[string]string{"Content-Type": "text/plain; charset=utf-8", "Cache-Control": "private, no-cache, no-store, must-revalidate"}},
 		{"invalid image id", "/id/nonexistant/info", router, http.StatusNotFound, []byte("Image does not exist\n"), map[string]string{"Content-Type": "text/plain; charset=utf-8", "Cache-Control": "private, no-cache, no-store, must-revalidate"}},
 		{"invalid size", "/id/1/1/9223372036854775808", router, http.StatusBadRequest, []byte("Invalid size\n"), map[string]string{"Content-Type": "text/plain; charset=utf-8", "Cache-Control": "private, no-cache, no-store, must-revalidate"}},   // Number larger then max int size to fail int parsing
@@ -266,6 +782,29 @@ func TestAPI(t *testing.T) {
 		{"invalid size", "/9223372036854775808", router, http.StatusBadRequest, []byte("Invalid size\n"), map[string]string{"Content-Type": "text/plain; charset=utf-8", "Cache-Control": "private, no-cache, no-store, must-revalidate"}},          // Number larger then maxImageSize to fail int parsing
 		{"invalid blur amount", "/id/1/100/100?blur=11", router, http.StatusBadRequest, []byte("Invalid blur amount\n"), map[string]string{"Content-Type": "text/plain; charset=utf-8", "Cache-Control": "private, no-cache, no-store, must-revalidate"}},
 		{"invalid blur amount", "/id/1/100/100?blur=0", router, http.StatusBadRequest, []byte("Invalid blur amount\n"), map[string]string{"Content-Type": "text/plain; charset=utf-8", "Cache-Control": "private, no-cache, no-store, must-revalidate"}},
+		{"invalid ratio", "/ratio/0:1/200", router, http.StatusBadRequest, []byte("Invalid ratio\n"), map[string]string{"Content-Type": "text/plain; charset=utf-8", "Cache-Control": "private, no-cache, no-store, must-revalidate"}},
+		{"ratio without a width", "/ratio/16:9/0", router, http.StatusBadRequest, []byte("Invalid size\n"), map[string]string{"Content-Type": "text/plain; charset=utf-8", "Cache-Control": "private, no-cache, no-store, must-revalidate"}},
+		{"invalid size", "/ratio/1:5/1200", router, http.StatusBadRequest, []byte("Invalid size\n"), map[string]string{"Content-Type": "text/plain; charset=utf-8", "Cache-Control": "private, no-cache, no-store, must-revalidate"}},
+		{"invalid orientation", "/200?orientation=diagonal", router, http.StatusBadRequest, []byte("Invalid orientation\n"), map[string]string{"Content-Type": "text/plain; charset=utf-8", "Cache-Control": "private, no-cache, no-store, must-revalidate"}},
+		{"invalid orientation", "/seed/1/200?orientation=diagonal", router, http.StatusBadRequest, []byte("Invalid orientation\n"), map[string]string{"Content-Type": "text/plain; charset=utf-8", "Cache-Control": "private, no-cache, no-store, must-revalidate"}},
+		{"no image with orientation", "/200?orientation=landscape", router, http.StatusNotFound, []byte("Image does not exist\n"), map[string]string{"Content-Type": "text/plain; charset=utf-8", "Cache-Control": "private, no-cache, no-store, must-revalidate"}},
+		{"no image with orientation", "/seed/1/200?orientation=landscape", router, http.StatusNotFound, []byte("Image does not exist\n"), map[string]string{"Content-Type": "text/plain; charset=utf-8", "Cache-Control": "private, no-cache, no-store, must-revalidate"}},
+		{"no image with orientation", "/seed/1/info?orientation=landscape", router, http.StatusNotFound, []byte("Image does not exist\n"), map[string]string{"Content-Type": "text/plain; charset=utf-8", "Cache-Control": "private, no-cache, no-store, must-revalidate"}},
+		{"invalid cursor", "/v2/list?cursor=invalid", router, http.StatusBadRequest, []byte("Invalid cursor\n"), map[string]string{"Content-Type": "text/plain; charset=utf-8", "Cache-Control": "private, no-cache, no-store, must-revalidate"}},
+		{"nonexistant author", "/v2/authors/nobody/images", variedRouter, http.StatusNotFound, []byte("Author does not exist\n"), map[string]string{"Content-Type": "text/plain; charset=utf-8", "Cache-Control": "private, no-cache, no-store, must-revalidate"}},
+		{"nonexistant author", "/author/nobody/200", variedRouter, http.StatusNotFound, []byte("Image does not exist\n"), map[string]string{"Content-Type": "text/plain; charset=utf-8", "Cache-Control": "private, no-cache, no-store, must-revalidate"}},
+		{"invalid size", "/v2/random?width=wide", router, http.StatusBadRequest, []byte("Invalid size\n"), map[string]string{"Content-Type": "text/plain; charset=utf-8", "Cache-Control": "private, no-cache, no-store, must-revalidate"}},
+		{"invalid size", "/v2/random?width=6000", router, http.StatusBadRequest, []byte("Invalid size\n"), map[string]string{"Content-Type": "text/plain; charset=utf-8", "Cache-Control": "private, no-cache, no-store, must-revalidate"}},
+		{"invalid format", "/v2/random?format=png", router, http.StatusBadRequest, []byte("Invalid file extension\n"), map[string]string{"Content-Type": "text/plain; charset=utf-8", "Cache-Control": "private, no-cache, no-store, must-revalidate"}},
+		{"no random images", "/v2/random?tag=food", variedRouter, http.StatusNotFound, []byte("Image does not exist\n"), map[string]string{"Content-Type": "text/plain; charset=utf-8", "Cache-Control": "private, no-cache, no-store, must-revalidate"}},
+		{"invalid sort", "/v2/list?sort=size", router, http.StatusBadRequest, []byte("Invalid sort\n"), map[string]string{"Content-Type": "text/plain; charset=utf-8", "Cache-Control": "private, no-cache, no-store, must-revalidate"}},
+		{"invalid min width", "/v2/list?min_width=wide", router, http.StatusBadRequest, []byte("Invalid size\n"), map[string]string{"Content-Type": "text/plain; charset=utf-8", "Cache-Control": "private, no-cache, no-store, must-revalidate"}},
+		{"invalid min height", "/v2/list?min_height=-1", router, http.StatusBadRequest, []byte("Invalid size\n"), map[string]string{"Content-Type": "text/plain; charset=utf-8", "Cache-Control": "private, no-cache, no-store, must-revalidate"}},
+		{"all images excluded", "/200?exclude=1", router, http.StatusNotFound, []byte("Image does not exist\n"), map[string]string{"Content-Type": "text/plain; charset=utf-8", "Cache-Control": "private, no-cache, no-store, must-revalidate"}},
+		{"all images excluded", "/seed/1/200?exclude=1", router, http.StatusNotFound, []byte("Image does not exist\n"), map[string]string{"Content-Type": "text/plain; charset=utf-8", "Cache-Control": "private, no-cache, no-store, must-revalidate"}},
+		{"all images excluded", "/ratio/16:9/200?exclude=1", router, http.StatusNotFound, []byte("Image does not exist\n"), map[string]string{"Content-Type": "text/plain; charset=utf-8", "Cache-Control": "private, no-cache, no-store, must-revalidate"}},
+		{"nonexistant tag", "/tag/food/200", variedRouter, http.StatusNotFound, []byte("Image does not exist\n"), map[string]string{"Content-Type": "text/plain; charset=utf-8", "Cache-Control": "private, no-cache, no-store, must-revalidate"}},
+		{"nonexistant tag", "/tag/food/seed/1/200", variedRouter, http.StatusNotFound, []byte("Image does not exist\n"), map[string]string{"Content-Type": "text/plain; charset=utf-8", "Cache-Control": "private, no-cache, no-store, must-revalidate"}},
 		{"invalid file extension", "/id/1/100/100.png", router, http.StatusBadRequest, []byte("Invalid file extension\n"), map[string]string{"Content-Type": "text/plain; charset=utf-8", "Cache-Control": "private, no-cache, no-store, must-revalidate"}},
 		// Deprecated handler errors
 		{"invalid size", "/g/9223372036854775808", router, http.StatusBadRequest, []byte("Invalid size\n"), map[string]string{"Content-Type": "text/plain; charset=utf-8", "Cache-Control": "private, no-cache, no-store, must-revalidate"}}, // Number larger then max int size to fail int parsing
@@ -274,6 +813,13 @@ func TestAPI(t *testing.T) {
 		{"List()", "/v2/list", mockDatabaseRouter, http.StatusInternalServerError, []byte("Something went wrong\n"), map[string]string{"Content-Type": "text/plain; charset=utf-8", "Cache-Control": "private, no-cache, no-store, must-revalidate"}},
 		{"GetRandom()", "/200", mockDatabaseRouter, http.StatusInternalServerError, []byte("Something went wrong\n"), map[string]string{"Content-Type": "text/plain; charset=utf-8", "Cache-Control": "private, no-cache, no-store, must-revalidate"}},
 		{"GetRandom()", "/g/200", mockDatabaseRouter, http.StatusInternalServerError, []byte("Something went wrong\n"), map[string]string{"Content-Type": "text/plain; charset=utf-8", "Cache-Control": "private, no-cache, no-store, must-revalidate"}},
+		{"GetRandomWithRatio()", "/ratio/16:9/200", mockDatabaseRouter, http.StatusInternalServerError, []byte("Something went wrong\n"), map[string]string{"Content-Type": "text/plain; charset=utf-8", "Cache-Control": "private, no-cache, no-store, must-revalidate"}},
+		{"ListAuthors()", "/v2/authors", mockDatabaseRouter, http.StatusInternalServerError, []byte("Something went wrong\n"), map[string]string{"Content-Type": "text/plain; charset=utf-8", "Cache-Control": "private, no-cache, no-store, must-revalidate"}},
+		{"GetAuthor()", "/v2/authors/jane-doe/images", mockDatabaseRouter, http.StatusInternalServerError, []byte("Something went wrong\n"), map[string]string{"Content-Type": "text/plain; charset=utf-8", "Cache-Control": "private, no-cache, no-store, must-revalidate"}},
+		{"GetRandomSample()", "/v2/random", mockDatabaseRouter, http.StatusInternalServerError, []byte("Something went wrong\n"), map[string]string{"Content-Type": "text/plain; charset=utf-8", "Cache-Control": "private, no-cache, no-store, must-revalidate"}},
+		{"GetRandomSampleWithSeed()", "/v2/random?seed=1", mockDatabaseRouter, http.StatusInternalServerError, []byte("Something went wrong\n"), map[string]string{"Content-Type": "text/plain; charset=utf-8", "Cache-Control": "private, no-cache, no-store, must-revalidate"}},
+		{"ListTags()", "/v2/tags", mockDatabaseRouter, http.StatusInternalServerError, []byte("Something went wrong\n"), map[string]string{"Content-Type": "text/plain; charset=utf-8", "Cache-Control": "private, no-cache, no-store, must-revalidate"}},
+		{"GetRandomFiltered()", "/tag/nature/200", mockDatabaseRouter, http.StatusInternalServerError, []byte("Something went wrong\n"), map[string]string{"Content-Type": "text/plain; charset=utf-8", "Cache-Control": "private, no-cache, no-store, must-revalidate"}},
 		{"GetRandomWithSeed()", "/seed/1/200", mockDatabaseRouter, http.StatusInternalServerError, []byte("Something went wrong\n"), map[string]string{"Content-Type": "text/plain; charset=utf-8", "Cache-Control": "private, no-cache, no-store, must-revalidate"}},
 		{"Get() database", "/id/1/100/100", mockDatabaseRouter, http.StatusInternalServerError, []byte("Something went wrong\n"), map[string]string{"Content-Type": "text/plain; charset=utf-8", "Cache-Control": "private, no-cache, no-store, must-revalidate"}},
 		{"Get() database", "/g/100?image=1", mockDatabaseRouter, http.StatusInternalServerError, []byte("Something went wrong\n"), map[string]string{"Content-Type": "text/plain; charset=utf-8", "Cache-Control": "private, no-cache, no-store, must-revalidate"}},
@@ -305,13 +851,7 @@ func TestAPI(t *testing.T) {
 		}
 	}
 
-	redirectTests := []struct {
-		Name            string
-		URL             string
-		ExpectedURL     string
-		TestCacheHeader bool
-		LocalRedirect   bool
-	}{
+	redirectTests := []redirectTest{
 		// /id/:id/:size to <imageServiceURL>/id/:id/:width/:height
 		{"/id/:id/:size", "/id/1/200", "/id/1/200/200.jpg", true, false},
 		{"/id/:id/:size.jpg", "/id/1/200.jpg", "/id/1/200/200.jpg", true, false},
@@ -407,6 +947,13 @@ func TestAPI(t *testing.T) {
 		{"/seed/:seed/:width/:height?blur&grayscale", "/seed/1/200/300?blur&grayscale", "/id/1/200/300.jpg?blur=5&grayscale", true, false},
 		{"/seed/:seed/:width/:height?blur=10&grayscale", "/seed/1/200/300?blur=10&grayscale", "/id/1/200/300.jpg?blur=10&grayscale", true, false},
 
+		// By aspect ratio
+		{"/ratio/:ratio/:width", "/ratio/16:9/320", "/id/1/320/180.jpg", true, false},
+		{"/ratio/:ratio/:width.webp", "/ratio/16:9/320.webp", "/id/1/320/180.webp", true, false},
+		{"/ratio/:ratio/:width?grayscale", "/ratio/1:1/200?grayscale", "/id/1/200/200.jpg?grayscale", true, false},
+		{"/id/:id/ratio/:ratio/:width", "/id/1/ratio/4:3/400", "/id/1/400/300.jpg", true, false},
+		{"/id/:id/ratio/:ratio/:width.webp?blur", "/id/1/ratio/3:4/300.webp?blur", "/id/1/300/400.webp?blur=5", true, false},
+
 		// Trailing slashes
 		{"/:size/", "/200/", "/200", false, true},
 		{"/:width/:height/", "/200/300/", "/200/300", false, true},
@@ -416,6 +963,757 @@ func TestAPI(t *testing.T) {
 		{"/seed/:seed/:width/:height/", "/seed/1/200/120/", "/seed/1/200/120", false, true},
 	}
 
+	testRedirects(t, router, hmac, redirectTests)
+
+	t.Run("/daily picks the image of the day by the date", func(t *testing.T) {
+		// The image of the day is the image for the seed of the date
+		for _, date := range []string{"2026-10-19", "2026-10-20", "2026-10-21"} {
+			dailyInfo := httptest.NewRecorder()
+			paginationRouter.ServeHTTP(dailyInfo, httptest.NewRequest("GET", "/daily/info?date="+date, nil))
+
+			seedInfo := httptest.NewRecorder()
+			paginationRouter.ServeHTTP(seedInfo, httptest.NewRequest("GET", "/seed/daily:"+date+"/info", nil))
+
+			if dailyInfo.Code != http.StatusOK || dailyInfo.Body.String() != seedInfo.Body.String() {
+				t.Errorf("%s: wrong image of the day %s", date, dailyInfo.Body.String())
+			}
+
+			if cacheControl := dailyInfo.Header().Get("Cache-Control"); cacheControl != "public, max-age=86400" {
+				t.Errorf("%s: wrong cache header %s", date, cacheControl)
+			}
+
+			dailyImage := httptest.NewRecorder()
+			paginationRouter.ServeHTTP(dailyImage, httptest.NewRequest("GET", "/daily/200/300?date="+date, nil))
+
+			var image api.ListImage
+			json.Unmarshal(dailyInfo.Body.Bytes(), &image)
+			expectedURL, _ := imageServiceLocation(hmac, fmt.Sprintf("/id/%s/200/300.jpg", image.ID))
+			if location := dailyImage.Header().Get("Location"); dailyImage.Code != http.StatusFound || location != expectedURL {
+				t.Errorf("%s: wrong redirect %s, expected %s", date, location, expectedURL)
+			}
+
+			if cacheControl := dailyImage.Header().Get("Cache-Control"); cacheControl != "public, max-age=86400" {
+				t.Errorf("%s: wrong cache header %s", date, cacheControl)
+			}
+		}
+
+		// The current image of the day is cached until the next day starts in the time zone
+		for _, url := range []string{"/daily/info", "/daily/info?tz=Pacific/Kiritimati", "/daily/200?tz=America/Los_Angeles"} {
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest("GET", url, nil))
+
+			var maxAge int
+			if _, err := fmt.Sscanf(w.Header().Get("Cache-Control"), "public, max-age=%d", &maxAge); err != nil || maxAge < 1 || maxAge > 86400 {
+				t.Errorf("%s: wrong cache header %s", url, w.Header().Get("Cache-Control"))
+			}
+		}
+	})
+
+	// Routes that aren't embeddable with oEmbed
+	t.Run("/iiif/3 and /id/{id}/tiles redirect to the image service", func(t *testing.T) {
+		redirectTests := []struct {
+			URL         string
+			ExpectedURL string
+		}{
+			{"/id/1/tiles/9/1_1.jpg", "/id/1/tiles/300/400/9/1_1.jpg"},
+			{"/id/1/tiles/0/0_0.jpg", "/id/1/tiles/300/400/0/0_0.jpg"},
+			{"/iiif/3/1/full/max/0/default.jpg", "/id/1/300/400.jpg"},
+			{"/iiif/3/1/full/150,/0/gray.webp", "/id/1/150/200.webp?grayscale"},
+			{"/iiif/3/1/full/,200/0/color.jpg", "/id/1/150/200.jpg"},
+			{"/iiif/3/1/full/pct:50/0/default.jpg", "/id/1/150/200.jpg"},
+			{"/iiif/3/1/full/!100,100/0/default.jpg", "/id/1/75/100.jpg"},
+			{"/iiif/3/1/full/^600,/0/default.jpg", "/id/1/600/800.jpg"},
+			{"/iiif/3/1/full/300,300/0/default.jpg", "/id/1/300/300.jpg?region=0%2C0%2C300%2C400"},
+			{"/iiif/3/1/square/100,100/!90/default.jpg", "/id/1/100/100.jpg?mirror&region=0%2C50%2C300%2C300&rotate=90"},
+			{"/iiif/3/1/pct:0,0,50,50/max/180/default.jpg", "/id/1/150/200.jpg?region=0%2C0%2C150%2C200&rotate=180"},
+			{"/iiif/3/1/100,200,500,500/max/0/default.jpg", "/id/1/200/200.jpg?region=100%2C200%2C200%2C200"},
+		}
+
+		for _, test := range redirectTests {
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", test.URL, nil)
+			router.ServeHTTP(w, req)
+			if w.Code != http.StatusFound {
+				t.Errorf("%s: wrong response code, %#v", test.URL, w.Code)
+				continue
+			}
+
+			expectedURL, err := imageServiceLocation(hmac, test.ExpectedURL)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if location := w.Header().Get("Location"); location != expectedURL {
+				t.Errorf("%s: wrong redirect %s, expected %s", test.URL, location, expectedURL)
+			}
+		}
+	})
+
+	t.Run("/v2/random returns distinct images", func(t *testing.T) {
+		for _, url := range []string{"/v2/random?count=4", "/v2/random?count=4&seed=picsum"} {
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", url, nil)
+			variedRouter.ServeHTTP(w, req)
+
+			var images []api.ResolvedImage
+			if err := json.Unmarshal(w.Body.Bytes(), &images); err != nil {
+				t.Fatalf("%s: %s", url, err)
+			}
+
+			ids := map[string]bool{}
+			for _, image := range images {
+				ids[image.Image.ID] = true
+			}
+
+			if len(images) != 4 || len(ids) != 4 {
+				t.Errorf("%s: wrong images %s", url, w.Body.String())
+			}
+		}
+	})
+
+	t.Run("/v2/random filters by the author slug", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/v2/random?count=4&author_slug=jane-doe", nil)
+		variedRouter.ServeHTTP(w, req)
+
+		var images []api.ResolvedImage
+		if err := json.Unmarshal(w.Body.Bytes(), &images); err != nil {
+			t.Fatal(err)
+		}
+
+		if len(images) != 2 {
+			t.Fatalf("wrong images %s", w.Body.String())
+		}
+
+		for _, image := range images {
+			if image.Image.Author != "Jane Doe" {
+				t.Errorf("wrong author %s", image.Image.Author)
+			}
+		}
+	})
+
+	t.Run("proxied images don't forward the authorization", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "/id/1/200/300", nil)
+		req.Header.Set("Authorization", "Bearer secret")
+		proxyRouter.ServeHTTP(w, req)
+
+		if w.Code != http.StatusOK || w.Header().Get("Test-Authorization") != "" {
+			t.Errorf("wrong response %d %#v", w.Code, w.Header())
+		}
+	})
+
+	t.Run("cors exposes the pagination and rate limit headers", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "/v2/list", nil)
+		req.Header.Set("Origin", "https://example.org")
+		paginationRouter.ServeHTTP(w, req)
+
+		exposed := w.Header().Get("Access-Control-Expose-Headers")
+		for _, header := range []string{"Link", "X-Total-Count", "Etag", "Ratelimit-Limit", "Ratelimit-Remaining", "Ratelimit-Reset", "Ratelimit-Policy", "Retry-After"} {
+			if !strings.Contains(exposed, header) {
+				t.Errorf("%s not exposed in %s", header, exposed)
+			}
+		}
+	})
+
+	t.Run("errors have machine-readable codes", func(t *testing.T) {
+		excludeIDs := make([]string, 101)
+		for i := range excludeIDs {
+			excludeIDs[i] = strconv.Itoa(i)
+		}
+		tooManyExcluded := strings.Join(excludeIDs, ",")
+
+		errorCodeTests := []struct {
+			URL            string
+			ExpectedStatus int
+			ExpectedCode   string
+		}{
+			{"/id/1/5001/100", http.StatusBadRequest, "invalid_size"},
+			{"/id/1/100/100?blur=11", http.StatusBadRequest, "invalid_blur"},
+			{"/id/1/100/100.png", http.StatusBadRequest, "invalid_file_extension"},
+			{"/v2/list?sort=name", http.StatusBadRequest, "invalid_sort"},
+			{"/200?exclude=" + tooManyExcluded, http.StatusBadRequest, "invalid_exclude"},
+			{"/seed/1/info?exclude=" + tooManyExcluded, http.StatusBadRequest, "invalid_exclude"},
+			{"/v2/random?exclude=" + tooManyExcluded, http.StatusBadRequest, "invalid_exclude"},
+			{"/200/6000?image=1", http.StatusBadRequest, "invalid_size"},
+			{"/200?image=nonexistant", http.StatusNotFound, "image_not_found"},
+			{"/daily/info?date=2026-13-01", http.StatusBadRequest, "invalid_date"},
+			{"/iiif/3/1/full/max/45/default.jpg", http.StatusBadRequest, "invalid_rotation"},
+			{"/id/nonexistant/100/100", http.StatusNotFound, "image_not_found"},
+			{"/v2/authors/nobody/images", http.StatusNotFound, "author_not_found"},
+			{"/id/1/tiles/10/0_0.jpg", http.StatusNotFound, "tile_not_found"},
+			{"/asdf", http.StatusNotFound, "page_not_found"},
+			{"/oembed?url=https://example.com/200&format=xml", http.StatusNotImplemented, "unsupported_format"},
+		}
+
+		for _, test := range errorCodeTests {
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", test.URL, nil)
+			req.Header.Set("Accept", "application/problem+json")
+			router.ServeHTTP(w, req)
+
+			var problem handler.Problem
+			if err := json.Unmarshal(w.Body.Bytes(), &problem); err != nil {
+				t.Errorf("%s: %s", test.URL, err)
+				continue
+			}
+
+			if w.Code != test.ExpectedStatus || w.Header().Get("Content-Type") != "application/problem+json" || problem.Status != test.ExpectedStatus || problem.Code != test.ExpectedCode {
+				t.Errorf("%s: wrong error %d %s", test.URL, w.Code, w.Body.String())
+			}
+		}
+	})
+
+	t.Run("rate limits redirects and processed images separately", func(t *testing.T) {
+		newRateLimits := func() *handler.RateLimits {
+			return &handler.RateLimits{
+				Limiter:   handler.NewRateLimiter(nil),
+				Redirects: &handler.Budget{Name: "redirects", Rate: 0.001, Burst: 2},
+				Images:    &handler.Budget{Name: "images", Rate: 0.001, Burst: 1},
+			}
+		}
+
+		redirectRouter, _ := (&api.API{Database: db, Log: log, Tracer: tracer, RootURL: rootURL, ImageServiceURL: imageServiceURL, HandlerTimeout: time.Minute, HMAC: hmac, RateLimits: newRateLimits()}).Router()
+		rateLimitedProxyRouter, _ := (&api.API{Database: db, Log: log, Tracer: tracer, RootURL: rootURL, ImageServiceURL: imageServiceURL, HandlerTimeout: time.Minute, HMAC: hmac, ImageProxy: api.UnixSocketProxy(imageServiceListener.Addr().String(), log), RateLimits: newRateLimits()}).Router()
+
+		rateLimitTests := []struct {
+			Name           string
+			Router         http.Handler
+			URL            string
+			ExpectedStatus int
+			ExpectedLimit  string
+		}{
+			{"redirect", redirectRouter, "/id/1/200/300", http.StatusFound, "2"},
+			{"metadata", redirectRouter, "/id/1/info", http.StatusOK, "2"},
+			{"redirect limited", redirectRouter, "/id/1/200/300", http.StatusTooManyRequests, "2"},
+			{"website", redirectRouter, "/", http.StatusOK, ""},
+			{"proxied image", rateLimitedProxyRouter, "/id/1/200/300", http.StatusOK, "1"},
+			{"proxied image limited", rateLimitedProxyRouter, "/id/1/200/300", http.StatusTooManyRequests, "1"},
+			{"resolved image", rateLimitedProxyRouter, "/v2/resolve/id/1/200/300", http.StatusOK, "2"},
+			{"iiif redirect", rateLimitedProxyRouter, "/iiif/3/1", http.StatusSeeOther, "2"},
+		}
+
+		for _, test := range rateLimitTests {
+			w := httptest.NewRecorder()
+			test.Router.ServeHTTP(w, httptest.NewRequest("GET", test.URL, nil))
+
+			if w.Code != test.ExpectedStatus || w.Header().Get("RateLimit-Limit") != test.ExpectedLimit {
+				t.Errorf("%s: wrong response %d %#v", test.Name, w.Code, w.Header())
+			}
+		}
+	})
+
+	t.Run("signed urls expire", func(t *testing.T) {
+		expiringRouter, _ := (&api.API{Database: db, Log: log, Tracer: tracer, RootURL: rootURL, ImageServiceURL: imageServiceURL, HandlerTimeout: time.Minute, HMAC: hmac, SignedURLMaxAge: time.Hour}).Router()
+
+		w := httptest.NewRecorder()
+		expiringRouter.ServeHTTP(w, httptest.NewRequest("GET", "/v2/resolve/id/1/200/300", nil))
+
+		var resolvedImage api.ResolvedImage
+		if err := json.Unmarshal(w.Body.Bytes(), &resolvedImage); err != nil {
+			t.Fatal(err)
+		}
+
+		// The expiry is rounded up to the next hour, to be the same for an hour
+		now := time.Now()
+		if expires := resolvedImage.Expires; expires == nil || expires.Before(now.Add(time.Hour)) || expires.After(now.Add(2*time.Hour)) || expires.Minute() != 0 {
+			t.Fatalf("wrong expiry %v", expires)
+		}
+
+		imageURL, _ := url.Parse(resolvedImage.URL)
+		if exp := imageURL.Query().Get("exp"); exp != fmt.Sprint(resolvedImage.Expires.Unix()) {
+			t.Errorf("wrong exp query parameter %s", exp)
+		}
+
+		if valid, err := params.ValidateHMAC(hmac, httptest.NewRequest("GET", imageURL.RequestURI(), nil)); !valid || err != nil {
+			t.Errorf("expected a valid url %s: %v", imageURL, err)
+		}
+
+		// The exp query parameter is signed
+		query := imageURL.Query()
+		query.Set("exp", fmt.Sprint(resolvedImage.Expires.Add(time.Hour).Unix()))
+		if valid, _ := params.ValidateHMAC(hmac, httptest.NewRequest("GET", imageURL.Path+"?"+params.BuildQuery(query), nil)); valid {
+			t.Error("expected a changed expiry to be invalid")
+		}
+
+		expiredURL, _ := params.HMACWithExpiry(hmac, "/id/1/200/300.jpg", url.Values{}, now.Add(-time.Minute))
+		if valid, err := params.ValidateHMAC(hmac, httptest.NewRequest("GET", expiredURL, nil)); valid || err != params.ErrExpired {
+			t.Errorf("expected an expired url %s: %v", expiredURL, err)
+		}
+
+		// The image of the day isn't cached for longer than its url can be used
+		w = httptest.NewRecorder()
+		expiringRouter.ServeHTTP(w, httptest.NewRequest("GET", "/daily/200/300", nil))
+
+		var maxAge int
+		if _, err := fmt.Sscanf(w.Header().Get("Cache-Control"), "public, max-age=%d", &maxAge); err != nil || maxAge > 2*60*60 {
+			t.Errorf("wrong Cache-Control %s", w.Header().Get("Cache-Control"))
+		}
+	})
+
+	t.Run("signed urls include the key id of the active key", func(t *testing.T) {
+		keyring := *hmac
+		keyring.Keys = map[string][]byte{"q1": []byte("q1-secret"), "q2": []byte("q2-secret")}
+		keyring.ActiveKeyID = "q2"
+
+		keyringRouter, _ := (&api.API{Database: db, Log: log, Tracer: tracer, RootURL: rootURL, ImageServiceURL: imageServiceURL, HandlerTimeout: time.Minute, HMAC: &keyring}).Router()
+
+		w := httptest.NewRecorder()
+		keyringRouter.ServeHTTP(w, httptest.NewRequest("GET", "/id/1/200/300?grayscale", nil))
+
+		imageURL, _ := url.Parse(w.Header().Get("Location"))
+		if kid := imageURL.Query().Get("kid"); kid != "q2" {
+			t.Fatalf("wrong kid %s", kid)
+		}
+
+		// URLs signed before the rotation are still valid
+		previous, _ := params.HMAC(hmac, "/id/1/200/300.jpg", url.Values{})
+		for _, signedURL := range []string{imageURL.RequestURI(), previous} {
+			if valid, err := params.ValidateHMAC(&keyring, httptest.NewRequest("GET", signedURL, nil)); !valid || err != nil {
+				t.Errorf("expected a valid url %s: %v", signedURL, err)
+			}
+		}
+
+		// The kid query parameter is signed
+		query := imageURL.Query()
+		query.Set("kid", "q1")
+		if valid, _ := params.ValidateHMAC(&keyring, httptest.NewRequest("GET", imageURL.Path+"?"+params.BuildQuery(query), nil)); valid {
+			t.Error("expected a changed kid to be invalid")
+		}
+
+		// URLs signed with a retired key aren't valid
+		retired := keyring
+		retired.ActiveKeyID = "q1"
+		retired.Retired = map[string]bool{"q2": true}
+		if valid, _ := params.ValidateHMAC(&retired, httptest.NewRequest("GET", imageURL.RequestURI(), nil)); valid {
+			t.Error("expected a retired key to be invalid")
+		}
+	})
+
+	t.Run("api keys have their own limits and features", func(t *testing.T) {
+		partner := &apikey.Key{Name: "partner", Key: "partner-secret", MaxImageSize: 8000, Features: []apikey.Feature{apikey.Grayscale}}
+		partner.RateLimits.Redirects = &apikey.Limit{Rate: 0.001, Burst: 2}
+		basic := &apikey.Key{Name: "basic", Key: "basic-secret", Features: []apikey.Feature{apikey.Blur}}
+
+		small := &apikey.Key{Name: "small", Key: "small-secret", MaxImageSize: 200}
+
+		keys, err := apikey.New([]*apikey.Key{partner, basic, small})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rateLimits := &handler.RateLimits{
+			Limiter:   handler.NewRateLimiter(nil),
+			Redirects: &handler.Budget{Name: "redirects", Rate: 0.001, Burst: 100},
+		}
+		keyRouter, _ := (&api.API{Database: db, Log: log, Tracer: tracer, RootURL: rootURL, ImageServiceURL: imageServiceURL, HandlerTimeout: time.Minute, HMAC: hmac, MetadataCacheMaxAge: time.Minute, RateLimits: rateLimits, APIKeys: keys}).Router()
+
+		keyTests := []struct {
+			Name           string
+			URL            string
+			Authorization  string
+			ExpectedStatus int
+			ExpectedLimit  string
+		}{
+			{"anonymous large image", "/id/1/6000/6000", "", http.StatusBadRequest, "100"},
+			{"large image", "/id/1/6000/6000", "Bearer partner-secret", http.StatusFound, "2"},
+			{"too large image", "/id/1/8001/8001", "Bearer partner-secret", http.StatusBadRequest, "2"},
+			{"key query parameter", "/id/1/200/300?grayscale&key=partner-secret", "", http.StatusTooManyRequests, "2"},
+			{"allowed feature", "/id/1/200/300?blur&key=basic-secret", "", http.StatusFound, ""},
+			{"feature not allowed", "/id/1/200/300?grayscale&key=basic-secret", "", http.StatusForbidden, ""},
+			{"webp not allowed", "/id/1/200/300.webp", "Bearer basic-secret", http.StatusForbidden, ""},
+			{"avif not allowed", "/id/1/200/300.avif", "Bearer basic-secret", http.StatusForbidden, ""},
+			{"default image size", "/id/1/6000/6000", "Bearer basic-secret", http.StatusBadRequest, ""},
+			{"invalid key", "/id/1/200/300", "Bearer wrong", http.StatusUnauthorized, "100"},
+			{"invalid key query parameter", "/id/1/200/300?key=wrong", "", http.StatusUnauthorized, "100"},
+			{"other authorization scheme", "/id/1/200/300", "Basic dXNlcjpwYXNz", http.StatusFound, "100"},
+		}
+
+		for _, test := range keyTests {
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest("GET", test.URL, nil)
+			if test.Authorization != "" {
+				req.Header.Set("Authorization", test.Authorization)
+			}
+			keyRouter.ServeHTTP(w, req)
+
+			if w.Code != test.ExpectedStatus || w.Header().Get("RateLimit-Limit") != test.ExpectedLimit {
+				t.Errorf("%s: wrong response %d %#v", test.Name, w.Code, w.Header())
+			}
+		}
+
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "/id/1/200/300", nil)
+		req.Header.Set("Authorization", "Bearer wrong")
+		keyRouter.ServeHTTP(w, req)
+		if authenticate := w.Header().Get("WWW-Authenticate"); authenticate != `Bearer error="invalid_token"` {
+			t.Errorf("wrong WWW-Authenticate header %#v", authenticate)
+		}
+
+		// The oEmbed discovery link doesn't include the key
+		w = httptest.NewRecorder()
+		keyRouter.ServeHTTP(w, httptest.NewRequest("GET", "/id/1/200/300?blur&key=basic-secret", nil))
+		if link := w.Header().Get("Link"); link == "" || strings.Contains(link, "secret") {
+			t.Errorf("wrong oEmbed link %s", link)
+		}
+
+		// Srcsets leave out the formats the key isn't allowed to use
+		w = httptest.NewRecorder()
+		keyRouter.ServeHTTP(w, httptest.NewRequest("GET", "/id/1/srcset?key=basic-secret", nil))
+		var srcset api.Srcset
+		if err := json.Unmarshal(w.Body.Bytes(), &srcset); err != nil || len(srcset.Sources) != 1 || srcset.Sources[0].Type != "image/jpeg" {
+			t.Errorf("wrong srcset %d %s", w.Code, w.Body.String())
+		}
+
+		// Full-size images can be embedded like on the image routes, and scaled images fit within the max image size
+		oembedTests := []struct {
+			URL            string
+			ExpectedWidth  int
+			ExpectedHeight int
+		}{
+			{"/oembed?url=" + url.QueryEscape(rootURL+"/id/1/0/0"), 300, 400},
+			{"/oembed?url=" + url.QueryEscape(rootURL+"/id/1/0/0") + "&maxwidth=250", 150, 200},
+		}
+		for _, test := range oembedTests {
+			w = httptest.NewRecorder()
+			req = httptest.NewRequest("GET", test.URL, nil)
+			req.Header.Set("Authorization", "Bearer small-secret")
+			keyRouter.ServeHTTP(w, req)
+
+			var oembed api.OEmbed
+			if err := json.Unmarshal(w.Body.Bytes(), &oembed); err != nil || oembed.Width != test.ExpectedWidth || oembed.Height != test.ExpectedHeight {
+				t.Errorf("%s: wrong oEmbed response %d %s", test.URL, w.Code, w.Body.String())
+			}
+		}
+
+		// Images that are only allowed with a key aren't cached publicly
+		w = httptest.NewRecorder()
+		req = httptest.NewRequest("GET", "/daily/200/300", nil)
+		req.Header.Set("Authorization", "Bearer basic-secret")
+		keyRouter.ServeHTTP(w, req)
+		if cacheControl := w.Header().Get("Cache-Control"); w.Code != http.StatusFound || !strings.HasPrefix(cacheControl, "private, max-age=") {
+			t.Errorf("wrong daily image response %d %s", w.Code, cacheControl)
+		}
+
+		// The IIIF image information has the max size of the key, so it's only cached publicly without a key
+		for authorization, expectedCacheControl := range map[string]string{"": "public, max-age=60", "Bearer small-secret": "private, max-age=60"} {
+			w = httptest.NewRecorder()
+			req = httptest.NewRequest("GET", "/iiif/3/1/info.json", nil)
+			if authorization != "" {
+				req.Header.Set("Authorization", authorization)
+			}
+			keyRouter.ServeHTTP(w, req)
+			if cacheControl := w.Header().Get("Cache-Control"); cacheControl != expectedCacheControl {
+				t.Errorf("wrong IIIF image information cache control %s for %#v", cacheControl, authorization)
+			}
+		}
+
+		// The OpenAPI description documents the optional keys
+		w = httptest.NewRecorder()
+		keyRouter.ServeHTTP(w, httptest.NewRequest("GET", "/v2/openapi.json", nil))
+		var spec struct {
+			Paths map[string]struct {
+				Get struct {
+					Responses map[string]struct {
+						Headers map[string]any `json:"headers"`
+					} `json:"responses"`
+				} `json:"get"`
+			} `json:"paths"`
+			Components struct {
+				SecuritySchemes map[string]any `json:"securitySchemes"`
+			} `json:"components"`
+			Security []map[string][]string `json:"security"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &spec); err != nil || spec.Components.SecuritySchemes["bearer"] == nil || len(spec.Security) != 3 {
+			t.Errorf("wrong OpenAPI security %#v", spec)
+		}
+
+		// Along with the responses of invalid keys, features the key doesn't allow, and rate limiting
+		imageResponses := spec.Paths["/id/{id}/{width}/{height}"].Get.Responses
+		for _, status := range []string{"302", "400", "401", "403", "404", "429", "500"} {
+			if _, ok := imageResponses[status]; !ok {
+				t.Errorf("missing OpenAPI response %s", status)
+			}
+		}
+		if imageResponses["429"].Headers["Retry-After"] == nil || imageResponses["429"].Headers["RateLimit-Reset"] == nil || imageResponses["401"].Headers["WWW-Authenticate"] == nil {
+			t.Errorf("wrong OpenAPI error headers %#v", imageResponses)
+		}
+
+		listResponses := spec.Paths["/v2/list"].Get.Responses
+		if _, ok := listResponses["304"]; !ok || listResponses["200"].Headers["ETag"] == nil {
+			t.Errorf("missing OpenAPI 304 response %#v", listResponses)
+		}
+		if _, ok := listResponses["403"]; ok {
+			t.Errorf("unexpected OpenAPI 403 response %#v", listResponses)
+		}
+
+		usage := expvar.Get("counter_labelmap_key_api_key_requests").(*expvar.Map)
+		if requests, ok := usage.Get("basic").(*expvar.Int); !ok || requests.Value() != 8 {
+			t.Errorf("wrong usage of the key %v", usage.Get("basic"))
+		}
+	})
+
+	t.Run("invalid api keys use the anonymous budget", func(t *testing.T) {
+		keys, err := apikey.New([]*apikey.Key{{Name: "basic", Key: "basic-secret"}})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rateLimits := &handler.RateLimits{
+			Limiter:   handler.NewRateLimiter(nil),
+			Redirects: &handler.Budget{Name: "redirects", Rate: 0.001, Burst: 2},
+		}
+		keyRouter, _ := (&api.API{Database: db, Log: log, Tracer: tracer, RootURL: rootURL, ImageServiceURL: imageServiceURL, HandlerTimeout: time.Minute, HMAC: hmac, RateLimits: rateLimits, APIKeys: keys}).Router()
+
+		tests := []struct {
+			URL            string
+			ExpectedStatus int
+		}{
+			{"/id/1/200/300?key=wrong", http.StatusUnauthorized},
+			{"/id/1/200/300?key=guess", http.StatusUnauthorized},
+			{"/id/1/200/300?key=another-guess", http.StatusTooManyRequests},
+			{"/id/1/200/300", http.StatusTooManyRequests},
+			{"/id/1/200/300?key=basic-secret", http.StatusFound},
+		}
+
+		for _, test := range tests {
+			w := httptest.NewRecorder()
+			keyRouter.ServeHTTP(w, httptest.NewRequest("GET", test.URL, nil))
+			if w.Code != test.ExpectedStatus {
+				t.Errorf("%s: wrong response %d %s", test.URL, w.Code, w.Body.String())
+			}
+		}
+	})
+
+	t.Run("metadata responds with 304 Not Modified for a matching ETag", func(t *testing.T) {
+		cacheRouter, _ := (&api.API{Database: db, Log: log, Tracer: tracer, RootURL: rootURL, ImageServiceURL: imageServiceURL, HandlerTimeout: time.Minute, HMAC: hmac, MetadataCacheMaxAge: time.Minute}).Router()
+
+		for _, url := range []string{"/id/1/info", "/seed/1/info", "/v2/list", "/v2/authors/john-doe/images"} {
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", url, nil)
+			cacheRouter.ServeHTTP(w, req)
+
+			etag := w.Header().Get("ETag")
+			if w.Code != http.StatusOK || !strings.HasPrefix(etag, "\"") {
+				t.Fatalf("%s: wrong response code %d or ETag %s", url, w.Code, etag)
+			}
+
+			if cacheControl := w.Header().Get("Cache-Control"); cacheControl != "public, max-age=60" {
+				t.Errorf("%s: wrong Cache-Control %s", url, cacheControl)
+			}
+
+			for _, ifNoneMatch := range []string{etag, "W/" + etag, "\"other\", " + etag, "*"} {
+				w := httptest.NewRecorder()
+				req, _ := http.NewRequest("GET", url, nil)
+				req.Header.Set("If-None-Match", ifNoneMatch)
+				cacheRouter.ServeHTTP(w, req)
+
+				if w.Code != http.StatusNotModified || w.Body.Len() != 0 || w.Header().Get("ETag") != etag {
+					t.Errorf("%s: wrong response for If-None-Match %s, %d %s", url, ifNoneMatch, w.Code, w.Header().Get("ETag"))
+				}
+			}
+
+			w = httptest.NewRecorder()
+			req, _ = http.NewRequest("GET", url, nil)
+			req.Header.Set("If-None-Match", "\"other\"")
+			cacheRouter.ServeHTTP(w, req)
+
+			if w.Code != http.StatusOK || w.Header().Get("ETag") != etag {
+				t.Errorf("%s: wrong response for a different ETag, %d %s", url, w.Code, w.Header().Get("ETag"))
+			}
+		}
+
+		// The ETag depends on the contents
+		etags := map[string]bool{}
+		for _, url := range []string{"/v2/list?page=1&limit=1", "/v2/list?page=2&limit=1"} {
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", url, nil)
+			paginationRouter.ServeHTTP(w, req)
+			etags[w.Header().Get("ETag")] = true
+		}
+
+		if len(etags) != 2 {
+			t.Errorf("wrong ETags for different pages %v", etags)
+		}
+	})
+
+	methodTests := []struct {
+		Name             string
+		Method           string
+		URL              string
+		ExpectedStatus   int
+		ExpectedAllow    string
+		ExpectedLocation string
+	}{
+		{"HEAD /id/:id/:size", "HEAD", "/id/1/200", http.StatusFound, "", "/id/1/200/200.jpg"},
+		{"HEAD /:width/:height", "HEAD", "/200/300", http.StatusFound, "", "/id/1/200/300.jpg"},
+		{"HEAD /v2/resolve/:size", "HEAD", "/v2/resolve/200", http.StatusOK, "", ""},
+		{"HEAD /id/:id/info", "HEAD", "/id/1/info", http.StatusOK, "", ""},
+		{"HEAD /v2/list", "HEAD", "/v2/list", http.StatusOK, "", ""},
+		{"OPTIONS /id/:id/:size", "OPTIONS", "/id/1/200", http.StatusNoContent, "GET, HEAD, OPTIONS", ""},
+		{"OPTIONS /v2/list", "OPTIONS", "/v2/list", http.StatusNoContent, "GET, HEAD, OPTIONS", ""},
+		{"POST /v2/list", "POST", "/v2/list", http.StatusMethodNotAllowed, "GET, HEAD, OPTIONS", ""},
+		{"DELETE /id/:id/:width/:height", "DELETE", "/id/1/200/300", http.StatusMethodNotAllowed, "GET, HEAD, OPTIONS", ""},
+		{"POST nonexistant", "POST", "/asdf/asdf", http.StatusNotFound, "", ""},
+	}
+
+	for _, test := range methodTests {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(test.Method, test.URL, nil)
+		router.ServeHTTP(w, req)
+		if w.Code != test.ExpectedStatus {
+			t.Errorf("%s: wrong response code, %#v", test.Name, w.Code)
+			continue
+		}
+
+		if allow := w.Header().Get("Allow"); allow != test.ExpectedAllow {
+			t.Errorf("%s: wrong Allow header, %#v", test.Name, allow)
+		}
+
+		if test.ExpectedLocation != "" {
+			expectedLocation, _ := imageServiceLocation(hmac, test.ExpectedLocation)
+			if location := w.Header().Get("Location"); location != expectedLocation {
+				t.Errorf("%s: wrong redirect %s", test.Name, location)
+			}
+		}
+	}
+
+	t.Run("/v2/openapi.json describes the routes", func(t *testing.T) {
+		tests := []struct {
+			URL             string
+			ExpectedPaths   []string
+			ExpectedSchemas []string
+			ExpectedURL     string
+		}{
+			{"/v2/openapi.json", []string{"/v2/list", "/v2/random", "/{size}", "/{size}.webp", "/id/{id}/{width}/{height}", "/id/{id}/{width}/{height}.avif", "/v2/resolve/seed/{seed}/{size}.jpg", "/list", "/v2/openapi.json"}, []string{"ListImage", "ResolvedImage", "DeprecatedImage", "Problem"}, rootURL},
+			{"/v2/openapi-image-service.json", []string{"/id/{id}/{width}/{height}.jpg", "/id/{id}/{width}/{height}.webp"}, []string{"Problem"}, imageServiceURL},
+		}
+
+		for _, test := range tests {
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", test.URL, nil)
+			router.ServeHTTP(w, req)
+
+			var spec struct {
+				Servers []struct {
+					URL string `json:"url"`
+				} `json:"servers"`
+				Paths map[string]struct {
+					Get struct {
+						OperationID string `json:"operationId"`
+					} `json:"get"`
+				} `json:"paths"`
+				Components struct {
+					Schemas map[string]any `json:"schemas"`
+				} `json:"components"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &spec); err != nil {
+				t.Fatalf("%s: %s", test.URL, err)
+			}
+
+			if len(spec.Servers) != 1 || spec.Servers[0].URL != test.ExpectedURL {
+				t.Errorf("%s: wrong servers %#v", test.URL, spec.Servers)
+			}
+
+			for _, path := range test.ExpectedPaths {
+				if spec.Paths[path].Get.OperationID == "" {
+					t.Errorf("%s: missing path %s", test.URL, path)
+				}
+			}
+
+			for _, schema := range test.ExpectedSchemas {
+				if spec.Components.Schemas[schema] == nil {
+					t.Errorf("%s: missing schema %s", test.URL, schema)
+				}
+			}
+
+			// The image service requires the extension
+			if _, ok := spec.Paths["/id/{id}/{width}/{height}"]; ok && test.ExpectedURL == imageServiceURL {
+				t.Errorf("%s: unexpected path without an extension", test.URL)
+			}
+
+			operationIDs := map[string]bool{}
+			for path, item := range spec.Paths {
+				if strings.Contains(path, "{extension}") {
+					t.Errorf("%s: extension path parameter in %s", test.URL, path)
+				}
+
+				if operationIDs[item.Get.OperationID] {
+					t.Errorf("%s: duplicate operation id for %s", test.URL, path)
+				}
+				operationIDs[item.Get.OperationID] = true
+			}
+		}
+	})
+
+	orientationRedirectTests := []redirectTest{
+		// Inferred from the size
+		{"/:width/:height landscape", "/300/200", "/id/3/300/200.jpg", true, false},
+
+		// Query parameter
+		{"/:width/:height?orientation=square", "/200/300?orientation=square", "/id/4/200/300.jpg", true, false},
+		{"/:size?orientation=landscape", "/200?orientation=landscape", "/id/3/200/200.jpg", true, false},
+		{"/seed/:seed/:size?orientation=landscape", "/seed/1/200?orientation=landscape", "/id/3/200/200.jpg", true, false},
+		{"/seed/:seed/:width/:height?orientation=square", "/seed/1/200/300?orientation=square", "/id/4/200/300.jpg", true, false},
+	}
+
+	testRedirects(t, variedRouter, hmac, orientationRedirectTests)
+
+	t.Run("square sizes pick from all the images", func(t *testing.T) {
+		ids := map[string]bool{}
+		for i := 0; i < 100; i++ {
+			w := httptest.NewRecorder()
+			variedRouter.ServeHTTP(w, httptest.NewRequest("GET", "/200", nil))
+			ids[strings.Split(w.Header().Get("Location"), "/")[4]] = true
+		}
+
+		if len(ids) < 2 {
+			t.Errorf("expected more than one image, got %v", ids)
+		}
+	})
+
+	tagRedirectTests := []redirectTest{
+		{"/tag/:tag/:width/:height", "/tag/city/300/200", "/id/3/300/200.jpg", true, false},
+		{"/tag/:tag/:width/:height.webp", "/tag/city/300/200.webp", "/id/3/300/200.webp", true, false},
+		{"/tag/:tag/:size?orientation=portrait&grayscale", "/tag/nature/200?orientation=portrait&grayscale", "/id/1/200/200.jpg?grayscale", true, false},
+		{"/tag/:tag/seed/:seed/:size?orientation=portrait", "/tag/nature/seed/1/200?orientation=portrait", "/id/1/200/200.jpg", true, false},
+		{"/tag/:tag/seed/:seed/:width/:height?orientation=landscape", "/tag/nature/seed/1/200/300?orientation=landscape", "/id/3/200/300.jpg", true, false},
+	}
+
+	testRedirects(t, variedRouter, hmac, tagRedirectTests)
+
+	excludeRedirectTests := []redirectTest{
+		{"/:size?exclude", "/200?exclude=1,2,3", "/id/4/200/200.jpg", true, false},
+		{"/:width/:height?exclude", "/200/300?exclude=1&exclude=2,3", "/id/4/200/300.jpg", true, false},
+		{"/:width/:height?exclude falls back to any orientation", "/200/300?exclude=1,2,4", "/id/3/200/300.jpg", true, false},
+		{"/seed/:seed/:size?exclude", "/seed/1/200?exclude=1,2,4", "/id/3/200/200.jpg", true, false},
+		{"/ratio/:ratio/:width?exclude", "/ratio/16:9/320?exclude=3", "/id/4/320/180.jpg", true, false},
+		{"/tag/:tag/:size?exclude", "/tag/nature/200?exclude=1", "/id/3/200/200.jpg", true, false},
+	}
+
+	testRedirects(t, variedRouter, hmac, excludeRedirectTests)
+
+	authorRedirectTests := []redirectTest{
+		{"/author/:slug/:width/:height", "/author/jane-doe/300/200", "/id/3/300/200.jpg", true, false},
+		{"/author/:slug/:size.webp?orientation=square", "/author/jane-doe/200.webp?orientation=square", "/id/4/200/200.webp", true, false},
+		{"/author/:slug/:size?orientation=landscape&blur", "/author/jane-doe/200?orientation=landscape&blur", "/id/3/200/200.jpg?blur=5", true, false},
+	}
+
+	testRedirects(t, variedRouter, hmac, authorRedirectTests)
+}
+
+type redirectTest struct {
+	Name            string
+	URL             string
+	ExpectedURL     string
+	TestCacheHeader bool
+	LocalRedirect   bool
+}
+
+func testRedirects(t *testing.T, router http.Handler, hmac *hmac.HMAC, redirectTests []redirectTest) {
+	t.Helper()
+
 	for _, test := range redirectTests {
 		w := httptest.NewRecorder()
 		req, _ := http.NewRequest("GET", test.URL, nil)
@@ -429,23 +1727,27 @@ func TestAPI(t *testing.T) {
 
 		expectedURL := test.ExpectedURL
 		if !test.LocalRedirect {
-			expectedHMAC, err := hmac.Create(test.ExpectedURL)
+			var err error
+			expectedURL, err = imageServiceLocation(hmac, test.ExpectedURL)
 			if err != nil {
 				t.Errorf("%s: hmac error %s", test.Name, err)
 				continue
 			}
-
-			if strings.Contains(test.ExpectedURL, "?") {
-				expectedURL = imageServiceURL + test.ExpectedURL + "&hmac=" + expectedHMAC
-			} else {
-				expectedURL = imageServiceURL + test.ExpectedURL + "?hmac=" + expectedHMAC
-			}
 		}
 
 		if location != expectedURL {
 			t.Errorf("%s: wrong redirect %s, expected %s", test.Name, location, expectedURL)
 		}
 
+		// The oEmbed link leaves out the query parameters
+		if !test.LocalRedirect {
+			path, _, _ := strings.Cut(test.URL, "?")
+			expectedLink := fmt.Sprintf(`<%s/oembed?url=%s&format=json>; rel="alternate"; type="application/json+oembed"`, rootURL, url.QueryEscape(rootURL+path))
+			if link := w.Header().Get("Link"); link != expectedLink {
+				t.Errorf("%s: wrong oembed link %s, expected %s", test.Name, link, expectedLink)
+			}
+		}
+
 		if test.TestCacheHeader {
 			if cacheControl := w.Header().Get("Cache-Control"); cacheControl != "private, no-cache, no-store, must-revalidate" {
 				t.Errorf("%s: wrong cache header, %#v", test.Name, cacheControl)
@@ -454,6 +1756,39 @@ func TestAPI(t *testing.T) {
 	}
 }
 
+// imageServiceLocation returns the signed image service URL for a path and query
+func imageServiceLocation(hmac *hmac.HMAC, url string) (string, error) {
+	path, err := imageServicePath(hmac, url)
+	if err != nil {
+		return "", err
+	}
+
+	return imageServiceURL + path, nil
+}
+
+// imageServicePath returns the signed image service path for a path and query
+func imageServicePath(hmac *hmac.HMAC, url string) (string, error) {
+	expectedHMAC, err := hmac.Create(url)
+	if err != nil {
+		return "", err
+	}
+
+	// The query parameters are sorted by key, including the hmac
+	path, query, _ := strings.Cut(url, "?")
+	parameters := []string{"hmac=" + expectedHMAC}
+	if query != "" {
+		parameters = append(parameters, strings.Split(query, "&")...)
+	}
+
+	sort.Slice(parameters, func(i, j int) bool {
+		keyI, _, _ := strings.Cut(parameters[i], "=")
+		keyJ, _, _ := strings.Cut(parameters[j], "=")
+		return keyI < keyJ
+	})
+
+	return path + "?" + strings.Join(parameters, "&"), nil
+}
+
 func marshalJson(v interface{}) []byte {
 	fixture, _ := json.Marshal(v)
 	return append(fixture[:], []byte("\n")...)
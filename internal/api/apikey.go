@@ -0,0 +1,114 @@
+package api
+
+import (
+	"context"
+	"expvar"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/DMarby/picsum-photos/internal/apikey"
+	"github.com/DMarby/picsum-photos/internal/handler"
+	"github.com/DMarby/picsum-photos/internal/params"
+)
+
+var apiKeyRequests = expvar.NewMap("counter_labelmap_key_api_key_requests")
+
+// Errors
+var (
+	ErrInvalidAPIKey     = fmt.Errorf("Invalid API key")
+	ErrFeatureNotAllowed = fmt.Errorf("Feature not allowed for the API key")
+)
+
+type apiKeyKey struct{}
+
+// authenticate is a middleware that looks up the API key of the request, if any, rejecting unknown keys with invalidKey
+// The key is given in the Authorization header, e.g. `Authorization: Bearer {key}`, or the key query parameter
+func (a *API) authenticate(next http.Handler, invalidKey http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		secret, ok := getAPIKeySecret(r)
+		if !ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		key, ok := a.APIKeys.Get(secret)
+		if !ok {
+			invalidKey.ServeHTTP(w, r)
+			return
+		}
+
+		apiKeyRequests.Add(key.Name, 1)
+
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), apiKeyKey{}, key)))
+	})
+}
+
+// invalidAPIKeyHandler rejects requests with an unknown API key
+func invalidAPIKeyHandler(w http.ResponseWriter, r *http.Request) *handler.Error {
+	w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+	return errorCodes.New(http.StatusUnauthorized, ErrInvalidAPIKey)
+}
+
+// getAPIKeySecret returns the API key given in the Authorization header or the key query parameter
+func getAPIKeySecret(r *http.Request) (string, bool) {
+	if scheme, secret, ok := strings.Cut(r.Header.Get("Authorization"), " "); ok && strings.EqualFold(scheme, "Bearer") {
+		return strings.TrimSpace(secret), true
+	}
+
+	if secret := r.URL.Query().Get("key"); secret != "" {
+		return secret, true
+	}
+
+	return "", false
+}
+
+// getAPIKey returns the API key the request was authenticated with, or nil for anonymous requests
+func getAPIKey(r *http.Request) *apikey.Key {
+	key, _ := r.Context().Value(apiKeyKey{}).(*apikey.Key)
+	return key
+}
+
+// getMaxImageSize returns the max allowed image width/height that can be requested with the API key
+func getMaxImageSize(key *apikey.Key) int {
+	if key != nil && key.MaxImageSize > 0 {
+		return key.MaxImageSize
+	}
+
+	return maxImageSize
+}
+
+// privateForAPIKey returns the Cache-Control header with public caching downgraded to private for requests with an API key,
+// as their responses can depend on the limits of the key, so shared caches mustn't store them
+func privateForAPIKey(r *http.Request, cacheControl string) string {
+	if directives, ok := strings.CutPrefix(cacheControl, "public"); ok && getAPIKey(r) != nil {
+		return "private" + directives
+	}
+
+	return cacheControl
+}
+
+// validateFeatures validates that the API key is allowed to use the features of the params
+func validateFeatures(p *params.Params, key *apikey.Key) error {
+	if key == nil {
+		return nil
+	}
+
+	if p.Blur && !key.Allows(apikey.Blur) {
+		return ErrFeatureNotAllowed
+	}
+
+	if p.Grayscale && !key.Allows(apikey.Grayscale) {
+		return ErrFeatureNotAllowed
+	}
+
+	if p.Extension == ".webp" && !key.Allows(apikey.WebP) {
+		return ErrFeatureNotAllowed
+	}
+
+	if p.Extension == ".avif" && !key.Allows(apikey.AVIF) {
+		return ErrFeatureNotAllowed
+	}
+
+	return nil
+}
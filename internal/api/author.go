@@ -0,0 +1,58 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/DMarby/picsum-photos/internal/database"
+	"github.com/DMarby/picsum-photos/internal/handler"
+)
+
+// ListAuthor contains information about an author and where to list their images
+type ListAuthor struct {
+	database.Author
+	ImagesURL string `json:"images_url"`
+}
+
+// Returns a list of all the authors
+func (a *API) authorsHandler(w http.ResponseWriter, r *http.Request) *handler.Error {
+	databaseAuthors, err := a.Database.ListAuthors(r.Context())
+	if err != nil {
+		a.logError(r, "error getting author list from database", err)
+		return handler.InternalServerError()
+	}
+
+	authors := []ListAuthor{}
+	for _, author := range databaseAuthors {
+		authors = append(authors, ListAuthor{
+			Author:    author,
+			ImagesURL: fmt.Sprintf("%s/v2/authors/%s/images", a.RootURL, url.PathEscape(author.Slug)),
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "private, no-cache, no-store, must-revalidate")
+
+	if err := json.NewEncoder(w).Encode(authors); err != nil {
+		a.logError(r, "error encoding author list", err)
+		return handler.InternalServerError()
+	}
+
+	return nil
+}
+
+func (a *API) getAuthor(r *http.Request, slug string) (*database.Author, *handler.Error) {
+	author, err := a.Database.GetAuthor(r.Context(), slug)
+	if err != nil {
+		if err == database.ErrAuthorNotFound {
+			return nil, errorCodes.NotFound(err)
+		}
+
+		a.logError(r, "error getting author from database", err)
+		return nil, handler.InternalServerError()
+	}
+
+	return author, nil
+}
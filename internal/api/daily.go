@@ -0,0 +1,123 @@
+package api
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"time"
+	_ "time/tzdata" // Time zones for the tz query parameter, regardless of the system time zone database
+
+	"github.com/DMarby/picsum-photos/internal/database"
+	"github.com/DMarby/picsum-photos/internal/handler"
+	"github.com/DMarby/picsum-photos/internal/params"
+)
+
+// Errors
+var (
+	ErrInvalidDate     = fmt.Errorf("Invalid date")
+	ErrInvalidTimezone = fmt.Errorf("Invalid timezone")
+)
+
+// How long the image of the day for a specific date can be cached
+const dailyDateMaxAge = 24 * time.Hour
+
+// day is the date of the image of the day, and when it expires
+type day struct {
+	date    string
+	expires time.Time
+}
+
+// seed returns the seed of the image of the day
+func (d day) seed() string {
+	return "daily:" + d.date
+}
+
+// pickImage returns an image picker for the image of the day
+func (d day) pickImage(a *API) imagePicker {
+	return func(r *http.Request, p *params.Params) (*database.Image, *handler.Error) {
+		return a.getImageFromSeed(r, d.seed(), database.Filter{})
+	}
+}
+
+// cacheControl returns the Cache-Control header, caching the image of the day until it expires
+func (d day) cacheControl(now time.Time) string {
+	return fmt.Sprintf("public, max-age=%d", int(math.Ceil(d.expires.Sub(now).Seconds())))
+}
+
+// Redirects to the image of the day, cached until the next day starts
+func (a *API) dailyImageRedirectHandler(w http.ResponseWriter, r *http.Request) *handler.Error {
+	now := time.Now()
+
+	d, err := getDay(r, now)
+	if err != nil {
+		return errorCodes.BadRequest(err)
+	}
+
+	// Pick the image and cache the redirect for the same day, in case the next day starts while handling the request
+	return a.redirectToImageWithCacheControl(w, r, d.pickImage(a), func(resolvedImage *ResolvedImage) string {
+		// The redirect can't be cached for longer than the URL can be used
+		if resolvedImage.Expires != nil && resolvedImage.Expires.Before(d.expires) {
+			d.expires = *resolvedImage.Expires
+		}
+
+		return d.cacheControl(now)
+	})
+}
+
+// pickDailyImage picks the image of the day
+func (a *API) pickDailyImage(r *http.Request, p *params.Params) (*database.Image, *handler.Error) {
+	d, err := getDay(r, time.Now())
+	if err != nil {
+		return nil, errorCodes.BadRequest(err)
+	}
+
+	return d.pickImage(a)(r, p)
+}
+
+// Returns info about the image of the day, cached until the next day starts
+func (a *API) dailyInfoHandler(w http.ResponseWriter, r *http.Request) *handler.Error {
+	now := time.Now()
+
+	d, err := getDay(r, now)
+	if err != nil {
+		return errorCodes.BadRequest(err)
+	}
+
+	image, handlerErr := a.getImageFromSeed(r, d.seed(), database.Filter{})
+	if handlerErr != nil {
+		return handlerErr
+	}
+
+	return a.writeMetadataWithCacheControl(w, r, a.getListImage(*image), d.cacheControl(now))
+}
+
+// getDay returns the day of the image of the day, from the date query parameter,
+// or the current date in UTC or the time zone in the tz query parameter
+func getDay(r *http.Request, now time.Time) (day, error) {
+	query := r.URL.Query()
+
+	// The image for a specific date doesn't change at midnight
+	if value := query.Get("date"); value != "" {
+		date, err := time.Parse(time.DateOnly, value)
+		if err != nil {
+			return day{}, ErrInvalidDate
+		}
+
+		return day{date: date.Format(time.DateOnly), expires: now.Add(dailyDateMaxAge)}, nil
+	}
+
+	location := time.UTC
+	if value := query.Get("tz"); value != "" {
+		// Local is the time zone of the server, which isn't meaningful to clients
+		var err error
+		if location, err = time.LoadLocation(value); err != nil || value == "Local" {
+			return day{}, ErrInvalidTimezone
+		}
+	}
+
+	year, month, date := now.In(location).Date()
+	return day{
+		date:    time.Date(year, month, date, 0, 0, 0, 0, location).Format(time.DateOnly),
+		expires: time.Date(year, month, date+1, 0, 0, 0, 0, location),
+	}, nil
+}
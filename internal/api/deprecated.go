@@ -38,6 +38,11 @@ func (a *API) deprecatedListHandler(w http.ResponseWriter, r *http.Request) *han
 			continue
 		}
 
+		authorURL := image.AuthorURL
+		if authorURL == "" {
+			authorURL = image.URL
+		}
+
 		images = append(images, DeprecatedImage{
 			Format:    "jpeg",
 			Width:     image.Width,
@@ -45,7 +50,7 @@ func (a *API) deprecatedListHandler(w http.ResponseWriter, r *http.Request) *han
 			Filename:  fmt.Sprintf("%s.jpeg", image.ID),
 			ID:        numericID,
 			Author:    image.Author,
-			AuthorURL: image.URL,
+			AuthorURL: authorURL,
 			PostURL:   image.URL,
 		})
 	}
@@ -62,33 +67,26 @@ func (a *API) deprecatedListHandler(w http.ResponseWriter, r *http.Request) *han
 
 // Handles deprecated image routes
 func (a *API) deprecatedImageHandler(w http.ResponseWriter, r *http.Request) *handler.Error {
-	// Get the params
-	p, err := params.GetParams(r)
-	if err != nil {
-		return handler.BadRequest(err.Error())
-	}
+	return a.redirectToImage(w, r, a.pickDeprecatedImage)
+}
 
-	var image *database.Image
+// pickDeprecatedImage picks the image for the deprecated /g/ routes, from the ?image query parameter or randomly
+func (a *API) pickDeprecatedImage(r *http.Request, p *params.Params) (*database.Image, *handler.Error) {
+	// Set grayscale to true as this is the deprecated /g/ endpoint
+	p.Grayscale = true
 
 	// Look for the deprecated ?image query parameter
 	if id := r.URL.Query().Get("image"); id != "" {
-		var handlerErr *handler.Error
-		image, handlerErr = a.getImage(r, id)
-		if handlerErr != nil {
-			return handlerErr
-		}
-	} else {
-		image, err = a.Database.GetRandom(r.Context())
-		if err != nil {
-			a.logError(r, "error getting random image from database", err)
-			return handler.InternalServerError()
-		}
+		return a.getImage(r, id)
 	}
 
-	// Set grayscale to true as this is the deprecated /g/ endpoint
-	p.Grayscale = true
+	image, err := a.Database.GetRandom(r.Context())
+	if err != nil {
+		a.logError(r, "error getting random image from database", err)
+		return nil, handler.InternalServerError()
+	}
 
-	return a.validateAndRedirect(w, r, p, image)
+	return image, nil
 }
 
 // deprecatedParams is a handler to handle deprecated query params for regular routes
@@ -96,25 +94,21 @@ func (a *API) deprecatedParams(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		// Look for the deprecated ?image query parameter
 		if id := r.URL.Query().Get("image"); id != "" {
-			w.Header().Set("Cache-Control", "private, no-cache, no-store, must-revalidate")
-
-			p, err := params.GetParams(r)
-			if err != nil {
-				http.Error(w, err.Error(), http.StatusBadRequest)
-				return
-			}
+			handler.Handler(func(w http.ResponseWriter, r *http.Request) *handler.Error {
+				w.Header().Set("Cache-Control", "private, no-cache, no-store, must-revalidate")
 
-			image, handlerErr := a.getImage(r, id)
-			if handlerErr != nil {
-				http.Error(w, handlerErr.Message, handlerErr.Code)
-				return
-			}
+				p, err := params.GetParams(r)
+				if err != nil {
+					return errorCodes.BadRequest(err)
+				}
 
-			handlerErr = a.validateAndRedirect(w, r, p, image)
-			if handlerErr != nil {
-				http.Error(w, handlerErr.Message, handlerErr.Code)
-			}
+				image, handlerErr := a.getImage(r, id)
+				if handlerErr != nil {
+					return handlerErr
+				}
 
+				return a.validateAndRedirect(w, r, p, image, nil)
+			}).ServeHTTP(w, r)
 			return
 		}
 
@@ -0,0 +1,35 @@
+package api
+
+import (
+	"github.com/DMarby/picsum-photos/internal/database"
+	"github.com/DMarby/picsum-photos/internal/dzi"
+	"github.com/DMarby/picsum-photos/internal/handler"
+	"github.com/DMarby/picsum-photos/internal/iiif"
+	"github.com/DMarby/picsum-photos/internal/params"
+)
+
+// errorCodes are the machine-readable codes of the errors, that clients can match on instead of the messages
+var errorCodes = handler.ErrorCodes{
+	params.ErrInvalidSize:          "invalid_size",
+	params.ErrInvalidFileExtension: "invalid_file_extension",
+	params.ErrInvalidRatio:         "invalid_ratio",
+	ErrInvalidBlurAmount:           "invalid_blur",
+	ErrInvalidOrientation:          "invalid_orientation",
+	ErrInvalidSort:                 "invalid_sort",
+	ErrInvalidCursor:               "invalid_cursor",
+	ErrInvalidExclude:              "invalid_exclude",
+	ErrTooManyWidths:               "too_many_widths",
+	ErrUnsupportedFormat:           "unsupported_format",
+	ErrInvalidDate:                 "invalid_date",
+	ErrInvalidTimezone:             "invalid_timezone",
+	ErrInvalidAPIKey:               "invalid_api_key",
+	ErrFeatureNotAllowed:           "feature_not_allowed",
+	iiif.ErrInvalidRegion:          "invalid_region",
+	iiif.ErrInvalidSize:            "invalid_size",
+	iiif.ErrInvalidRotation:        "invalid_rotation",
+	iiif.ErrInvalidQuality:         "invalid_quality",
+	iiif.ErrInvalidFormat:          "invalid_format",
+	database.ErrNotFound:           "image_not_found",
+	database.ErrAuthorNotFound:     "author_not_found",
+	dzi.ErrTileNotFound:            "tile_not_found",
+}
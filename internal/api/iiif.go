@@ -0,0 +1,82 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/DMarby/picsum-photos/internal/handler"
+	"github.com/DMarby/picsum-photos/internal/iiif"
+	"github.com/DMarby/picsum-photos/internal/params"
+	"github.com/gorilla/mux"
+)
+
+// Redirects the IIIF base URI of an image to its image information
+func (a *API) iiifBaseHandler(w http.ResponseWriter, r *http.Request) *handler.Error {
+	vars := mux.Vars(r)
+	http.Redirect(w, r, fmt.Sprintf("%s/info.json", a.iiifID(vars["id"])), http.StatusSeeOther)
+	return nil
+}
+
+// Returns the IIIF image information of an image
+func (a *API) iiifInfoHandler(w http.ResponseWriter, r *http.Request) *handler.Error {
+	vars := mux.Vars(r)
+	image, handlerErr := a.getImage(r, vars["id"])
+	if handlerErr != nil {
+		return handlerErr
+	}
+
+	// The max size of the image depends on the API key
+	info := iiif.NewInfo(a.iiifID(image.ID), image.Width, image.Height, getMaxImageSize(getAPIKey(r)))
+	return a.writeMetadataWithCacheControl(w, r, info, privateForAPIKey(r, a.metadataCacheControl()))
+}
+
+// Translates an IIIF image request into the region, size, mirroring, rotation and quality of the image service,
+// and redirects to the signed image service URL like the other image routes
+func (a *API) iiifImageHandler(w http.ResponseWriter, r *http.Request) *handler.Error {
+	vars := mux.Vars(r)
+	image, handlerErr := a.getImage(r, vars["id"])
+	if handlerErr != nil {
+		return handlerErr
+	}
+
+	request, err := iiif.Parse(vars["region"], vars["size"], vars["rotation"], vars["quality"], vars["format"], image.Width, image.Height, getMaxImageSize(getAPIKey(r)))
+	if err != nil {
+		return errorCodes.BadRequest(err)
+	}
+
+	p := &params.Params{
+		Width:     request.Width,
+		Height:    request.Height,
+		Grayscale: request.Grayscale,
+		Extension: request.Extension,
+	}
+
+	query := url.Values{}
+
+	// The image service crops the full image to the requested aspect ratio when resizing, so distorting sizes need an explicit region
+	if !request.Full || request.Distorted() {
+		query.Set("region", fmt.Sprintf("%d,%d,%d,%d", request.Region.X, request.Region.Y, request.Region.Width, request.Region.Height))
+	}
+
+	if request.Mirror {
+		query.Set("mirror", "")
+	}
+
+	if request.Rotation != 0 {
+		query.Set("rotate", strconv.Itoa(request.Rotation))
+	}
+
+	resolvedImage, handlerErr := a.resolveImageWithQuery(r, p, image, query)
+	if handlerErr != nil {
+		return handlerErr
+	}
+
+	return a.writeResolvedImage(w, r, resolvedImage)
+}
+
+// iiifID returns the IIIF base URI of an image
+func (a *API) iiifID(imageID string) string {
+	return fmt.Sprintf("%s/iiif/3/%s", a.RootURL, url.PathEscape(imageID))
+}
@@ -1,12 +1,15 @@
 package api
 
 import (
+	"context"
+	"encoding/json"
 	"expvar"
 	"fmt"
 	"math"
 	"net/http"
 	"net/url"
 	"strconv"
+	"time"
 
 	"github.com/DMarby/picsum-photos/internal/database"
 	"github.com/DMarby/picsum-photos/internal/handler"
@@ -21,68 +24,105 @@ var (
 	imageRequestsGrayscale = expvar.NewInt("image_requests_grayscale")
 )
 
+// imagePicker picks the image for a request to an image route
+type imagePicker func(r *http.Request, p *params.Params) (*database.Image, *handler.Error)
+
 func (a *API) imageRedirectHandler(w http.ResponseWriter, r *http.Request) *handler.Error {
+	return a.redirectToImage(w, r, a.pickImageByID)
+}
+
+func (a *API) randomImageRedirectHandler(w http.ResponseWriter, r *http.Request) *handler.Error {
+	return a.redirectToImage(w, r, a.pickRandomImage)
+}
+
+func (a *API) ratioImageRedirectHandler(w http.ResponseWriter, r *http.Request) *handler.Error {
+	return a.redirectToImage(w, r, a.pickRatioImage)
+}
+
+func (a *API) seedImageRedirectHandler(w http.ResponseWriter, r *http.Request) *handler.Error {
+	return a.redirectToImage(w, r, a.pickSeedImage)
+}
+
+// redirectToImage redirects to the image picked by pick, with the path and query parameters of the request
+func (a *API) redirectToImage(w http.ResponseWriter, r *http.Request, pick imagePicker) *handler.Error {
+	return a.redirectToImageWithCacheControl(w, r, pick, nil)
+}
+
+// redirectToImageWithCacheControl redirects to the image like redirectToImage,
+// with the Cache-Control header returned by cacheControl for the resolved image if it's not nil
+func (a *API) redirectToImageWithCacheControl(w http.ResponseWriter, r *http.Request, pick imagePicker, cacheControl func(resolvedImage *ResolvedImage) string) *handler.Error {
 	// Get the path and query parameters
 	p, err := params.GetParams(r)
 	if err != nil {
-		return handler.BadRequest(err.Error())
+		return errorCodes.BadRequest(err)
 	}
 
-	// Get the image from the database
-	vars := mux.Vars(r)
-	imageID := vars["id"]
-	image, handlerErr := a.getImage(r, imageID)
+	image, handlerErr := pick(r, p)
 	if handlerErr != nil {
 		return handlerErr
 	}
 
 	// Validate the params and redirect to the image service
-	return a.validateAndRedirect(w, r, p, image)
+	return a.validateAndRedirect(w, r, p, image, cacheControl)
 }
 
-func (a *API) randomImageRedirectHandler(w http.ResponseWriter, r *http.Request) *handler.Error {
-	// Get the path and query parameters
-	p, err := params.GetParams(r)
-	if err != nil {
-		return handler.BadRequest(err.Error())
-	}
+// pickImageByID picks the image from the database by ID
+func (a *API) pickImageByID(r *http.Request, p *params.Params) (*database.Image, *handler.Error) {
+	vars := mux.Vars(r)
+	imageID := vars["id"]
+	return a.getImage(r, imageID)
+}
 
-	// Get a random image
-	image, err := a.Database.GetRandom(r.Context())
+// pickRandomImage picks a random image, optionally limited to a tag or author
+func (a *API) pickRandomImage(r *http.Request, p *params.Params) (*database.Image, *handler.Error) {
+	filter, err := getFilter(r)
 	if err != nil {
-		a.logError(r, "error getting random image from database", err)
-		return handler.InternalServerError()
+		return nil, errorCodes.BadRequest(err)
 	}
 
-	// Validate the params and redirect to the image service
-	return a.validateAndRedirect(w, r, p, image)
+	return a.getRandomImage(r, p, filter)
 }
 
-func (a *API) seedImageRedirectHandler(w http.ResponseWriter, r *http.Request) *handler.Error {
-	// Get the path and query parameters
-	p, err := params.GetParams(r)
+// pickRatioImage picks a random image, preferring images close to the requested aspect ratio to reduce cropping
+func (a *API) pickRatioImage(r *http.Request, p *params.Params) (*database.Image, *handler.Error) {
+	filter, err := getFilter(r)
 	if err != nil {
-		return handler.BadRequest(err.Error())
+		return nil, errorCodes.BadRequest(err)
 	}
 
+	image, err := a.Database.GetRandomWithRatio(r.Context(), p.Ratio, filter)
+	if err != nil {
+		if err == database.ErrNotFound {
+			return nil, errorCodes.NotFound(err)
+		}
+
+		a.logError(r, "error getting random image from database", err)
+		return nil, handler.InternalServerError()
+	}
+
+	return image, nil
+}
+
+// pickSeedImage picks an image based on the seed
+func (a *API) pickSeedImage(r *http.Request, p *params.Params) (*database.Image, *handler.Error) {
 	// Get the image seed
 	vars := mux.Vars(r)
 	imageSeed := vars["seed"]
 
-	image, handlerErr := a.getImageFromSeed(r, imageSeed)
-	if handlerErr != nil {
-		return handlerErr
+	// The orientation is never inferred for seeds, to keep returning the same image for a seed regardless of size
+	filter, err := getFilter(r)
+	if err != nil {
+		return nil, errorCodes.BadRequest(err)
 	}
 
-	// Validate the params and redirect to the image service
-	return a.validateAndRedirect(w, r, p, image)
+	return a.getImageFromSeed(r, imageSeed, filter)
 }
 
 func (a *API) getImage(r *http.Request, imageID string) (*database.Image, *handler.Error) {
 	databaseImage, err := a.Database.Get(r.Context(), imageID)
 	if err != nil {
 		if err == database.ErrNotFound {
-			return nil, &handler.Error{Message: err.Error(), Code: http.StatusNotFound}
+			return nil, errorCodes.NotFound(err)
 		}
 
 		a.logError(r, "error getting image from database", err)
@@ -92,13 +132,49 @@ func (a *API) getImage(r *http.Request, imageID string) (*database.Image, *handl
 	return databaseImage, nil
 }
 
-func (a *API) getImageFromSeed(r *http.Request, imageSeed string) (*database.Image, *handler.Error) {
+// getRandomImage returns a random image matching the filter
+// If the filter has no orientation, it's inferred from non-square sizes to reduce cropping
+// Square sizes pick from all the images, as few images are square
+func (a *API) getRandomImage(r *http.Request, p *params.Params, filter database.Filter) (*database.Image, *handler.Error) {
+	inferred := false
+	orientationFilter := filter
+	if filter.Orientation == "" && p.Width > 0 && p.Height > 0 {
+		if orientation := database.GetOrientation(p.Width, p.Height); orientation != database.Square {
+			orientationFilter.Orientation = orientation
+			inferred = true
+		}
+	}
+
+	image, err := a.Database.GetRandomFiltered(r.Context(), orientationFilter)
+
+	// Fall back to any orientation if there are no images with the inferred orientation
+	if err == database.ErrNotFound && inferred {
+		image, err = a.Database.GetRandomFiltered(r.Context(), filter)
+	}
+
+	if err != nil {
+		if err == database.ErrNotFound {
+			return nil, errorCodes.NotFound(err)
+		}
+
+		a.logError(r, "error getting random image from database", err)
+		return nil, handler.InternalServerError()
+	}
+
+	return image, nil
+}
+
+func (a *API) getImageFromSeed(r *http.Request, imageSeed string, filter database.Filter) (*database.Image, *handler.Error) {
 	// Hash the input using murmur3
 	murmurHash := murmur3.StringSum64(imageSeed)
 
 	// Get a random image by the hash
-	image, err := a.Database.GetRandomWithSeed(r.Context(), int64(murmurHash))
+	image, err := a.Database.GetRandomWithSeedFiltered(r.Context(), int64(murmurHash), filter)
 	if err != nil {
+		if err == database.ErrNotFound {
+			return nil, errorCodes.NotFound(err)
+		}
+
 		a.logError(r, "error getting random image from database", err)
 		return nil, handler.InternalServerError()
 	}
@@ -106,18 +182,121 @@ func (a *API) getImageFromSeed(r *http.Request, imageSeed string) (*database.Ima
 	return image, nil
 }
 
-func (a *API) validateAndRedirect(w http.ResponseWriter, r *http.Request, p *params.Params, image *database.Image) *handler.Error {
-	if err := validateImageParams(p); err != nil {
-		return handler.BadRequest(err.Error())
+// ResolvedImage contains metadata about an image, and the final dimensions and signed image service URL for a request
+type ResolvedImage struct {
+	Image  ListImage `json:"image"`
+	Width  int       `json:"width"`
+	Height int       `json:"height"`
+	URL    string    `json:"url"`
+	// When the URL expires, if it does
+	Expires *time.Time `json:"expires,omitempty"`
+
+	// The signed path and query on the image service
+	path string
+	// The Cache-Control header, for images that can be cached, defaults to not caching the response
+	cacheControl string
+}
+
+type resolveKey struct{}
+
+// resolve is a middleware that makes the image routes return the resolved image as JSON, instead of redirecting to it
+func resolve(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), resolveKey{}, true)))
+	})
+}
+
+func (a *API) validateAndRedirect(w http.ResponseWriter, r *http.Request, p *params.Params, image *database.Image, cacheControl func(resolvedImage *ResolvedImage) string) *handler.Error {
+	resolvedImage, handlerErr := a.resolveImage(r, p, image)
+	if handlerErr != nil {
+		return handlerErr
 	}
 
-	width, height := getImageDimensions(p, image)
+	if cacheControl != nil {
+		resolvedImage.cacheControl = cacheControl(resolvedImage)
+	}
+
+	return a.writeEmbeddableImage(w, r, resolvedImage)
+}
+
+// writeEmbeddableImage writes the resolved image like writeResolvedImage, with an oEmbed discovery link when redirecting
+func (a *API) writeEmbeddableImage(w http.ResponseWriter, r *http.Request, resolvedImage *ResolvedImage) *handler.Error {
+	// oEmbed discovery, for embedding the image by its URL
+	if r.Context().Value(resolveKey{}) == nil && a.ImageProxy == nil {
+		w.Header().Set("Link", fmt.Sprintf(`<%s>; rel="alternate"; type="application/json+oembed"`, a.oembedURL(r)))
+	}
+
+	return a.writeResolvedImage(w, r, resolvedImage)
+}
+
+// writeResolvedImage redirects to the resolved image, serves it through the image proxy, or writes it as JSON for the resolve routes
+func (a *API) writeResolvedImage(w http.ResponseWriter, r *http.Request, resolvedImage *ResolvedImage) *handler.Error {
+	cacheControl := resolvedImage.cacheControl
+	if cacheControl == "" {
+		cacheControl = "private, no-cache, no-store, must-revalidate"
+	}
+
+	// Images resolved with an API key can be beyond the limits of other clients
+	w.Header().Set("Cache-Control", privateForAPIKey(r, cacheControl))
+
+	resolving := r.Context().Value(resolveKey{}) != nil
+
+	// Serve the image through the proxy instead of redirecting to it
+	if a.ImageProxy != nil && !resolving {
+		return a.proxyImage(w, r, resolvedImage)
+	}
+
+	if resolving {
+		w.Header().Set("Content-Type", "application/json")
+
+		if err := json.NewEncoder(w).Encode(resolvedImage); err != nil {
+			a.logError(r, "error encoding resolved image", err)
+			return handler.InternalServerError()
+		}
+
+		return nil
+	}
 
-	w.Header().Set("Cache-Control", "private, no-cache, no-store, must-revalidate")
 	w.Header()["Content-Type"] = nil
 
+	http.Redirect(w, r, resolvedImage.URL, http.StatusFound)
+
+	return nil
+}
+
+// proxyImage serves the resolved image using the image proxy
+func (a *API) proxyImage(w http.ResponseWriter, r *http.Request, resolvedImage *ResolvedImage) *handler.Error {
+	imageURL, err := url.Parse(resolvedImage.path)
+	if err != nil {
+		a.logError(r, "error parsing image url", err)
+		return handler.InternalServerError()
+	}
+
+	proxyRequest := r.Clone(r.Context())
+	proxyRequest.URL.Path = imageURL.Path
+	proxyRequest.URL.RawPath = imageURL.RawPath
+	proxyRequest.URL.RawQuery = imageURL.RawQuery
+
+	a.ImageProxy.ServeHTTP(w, proxyRequest)
+
+	return nil
+}
+
+// resolveImage validates the params, and returns the signed image service URL for the image
+func (a *API) resolveImage(r *http.Request, p *params.Params, image *database.Image) (*ResolvedImage, *handler.Error) {
+	return a.resolveImageWithQuery(r, p, image, url.Values{})
+}
+
+// resolveImageWithQuery validates the params, and returns the signed image service URL for the image,
+// with additional query parameters for the image service
+func (a *API) resolveImageWithQuery(r *http.Request, p *params.Params, image *database.Image, query url.Values) (*ResolvedImage, *handler.Error) {
+	if handlerErr := validateRequestParams(r, p); handlerErr != nil {
+		return nil, handlerErr
+	}
+
+	width, height := getImageDimensions(p, image)
+
 	path := fmt.Sprintf("/id/%s/%d/%d%s", image.ID, width, height, p.Extension)
-	query := url.Values{}
 
 	if p.Blur {
 		query.Add("blur", strconv.Itoa(p.BlurAmount))
@@ -129,14 +308,48 @@ func (a *API) validateAndRedirect(w http.ResponseWriter, r *http.Request, p *par
 		imageRequestsGrayscale.Add(1)
 	}
 
-	url, err := params.HMAC(a.HMAC, path, query)
+	url, expires, err := a.signURL(path, query)
 	if err != nil {
-		return handler.InternalServerError()
+		return nil, handler.InternalServerError()
 	}
 
 	imageRequests.Add(fmt.Sprintf("%0.f", math.Max(math.Round(float64(width)/500)*500, math.Round(float64(height)/500)*500)), 1)
 
-	http.Redirect(w, r, fmt.Sprintf("%s%s", a.ImageServiceURL, url), http.StatusFound)
+	return &ResolvedImage{
+		Image:   a.getListImage(*image),
+		Width:   width,
+		Height:  height,
+		URL:     fmt.Sprintf("%s%s", a.ImageServiceURL, url),
+		Expires: expires,
+		path:    url,
+	}, nil
+}
+
+// validateRequestParams validates the params against the limits and features of the API key of the request
+func validateRequestParams(r *http.Request, p *params.Params) *handler.Error {
+	if err := validateImageParams(p, getAPIKey(r)); err == ErrFeatureNotAllowed {
+		return errorCodes.New(http.StatusForbidden, err)
+	} else if err != nil {
+		return errorCodes.BadRequest(err)
+	}
 
 	return nil
 }
+
+// signURL signs the path and query for the image service, returning when the URL expires if SignedURLMaxAge is set
+// The expiry is rounded up to the next window of SignedURLMaxAge, so that the URLs are the same within it and can be cached,
+// giving a lifetime of one to two times SignedURLMaxAge
+func (a *API) signURL(path string, query url.Values) (string, *time.Time, error) {
+	if a.SignedURLMaxAge <= 0 {
+		url, err := params.HMAC(a.HMAC, path, query)
+		return url, nil, err
+	}
+
+	expires := time.Now().Truncate(a.SignedURLMaxAge).Add(2 * a.SignedURLMaxAge).UTC()
+	url, err := params.HMACWithExpiry(a.HMAC, path, query, expires)
+	if err != nil {
+		return "", nil, err
+	}
+
+	return url, &expires, nil
+}
@@ -1,14 +1,20 @@
 package api
 
 import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"net/url"
 	"strconv"
+	"strings"
 
 	"github.com/DMarby/picsum-photos/internal/database"
 	"github.com/DMarby/picsum-photos/internal/handler"
 	"github.com/gorilla/mux"
+	"github.com/twmb/murmur3"
 )
 
 const (
@@ -33,17 +39,7 @@ func (a *API) infoHandler(w http.ResponseWriter, r *http.Request) *handler.Error
 		return handlerErr
 	}
 
-	listImage := a.getListImage(*image)
-
-	w.Header().Set("Content-Type", "application/json")
-	w.Header().Set("Cache-Control", "private, no-cache, no-store, must-revalidate")
-
-	if err := json.NewEncoder(w).Encode(listImage); err != nil {
-		a.logError(r, "error encoding image info", err)
-		return handler.InternalServerError()
-	}
-
-	return nil
+	return a.writeMetadata(w, r, a.getListImage(*image))
 }
 
 // Returns info about an image based on the seed
@@ -51,59 +47,228 @@ func (a *API) infoSeedHandler(w http.ResponseWriter, r *http.Request) *handler.E
 	vars := mux.Vars(r)
 	imageSeed := vars["seed"]
 
-	image, handlerErr := a.getImageFromSeed(r, imageSeed)
+	filter, err := getFilter(r)
+	if err != nil {
+		return errorCodes.BadRequest(err)
+	}
+
+	image, handlerErr := a.getImageFromSeed(r, imageSeed, filter)
 	if handlerErr != nil {
 		return handlerErr
 	}
 
-	listImage := a.getListImage(*image)
+	return a.writeMetadata(w, r, a.getListImage(*image))
+}
+
+// Returns a list of all the tags
+func (a *API) tagsHandler(w http.ResponseWriter, r *http.Request) *handler.Error {
+	tags, err := a.Database.ListTags(r.Context())
+	if err != nil {
+		a.logError(r, "error getting tag list from database", err)
+		return handler.InternalServerError()
+	}
 
 	w.Header().Set("Content-Type", "application/json")
 	w.Header().Set("Cache-Control", "private, no-cache, no-store, must-revalidate")
 
-	if err := json.NewEncoder(w).Encode(listImage); err != nil {
-		a.logError(r, "error encoding image info", err)
+	if err := json.NewEncoder(w).Encode(tags); err != nil {
+		a.logError(r, "error encoding tag list", err)
 		return handler.InternalServerError()
 	}
 
 	return nil
 }
 
-// Paginated list, with `page` and `limit` query parameters
+// Paginated list, with `page` or `cursor` and `limit` query parameters, and optional filter and sort query parameters
 func (a *API) listHandler(w http.ResponseWriter, r *http.Request) *handler.Error {
 	limit := getLimit(r)
-	page := getPage(r)
 
-	offset := limit * (page - 1)
+	options, err := getListOptions(r)
+	if err != nil {
+		return errorCodes.BadRequest(err)
+	}
+
+	// Limit the list to an author when listing the images of an author
+	if slug, ok := mux.Vars(r)["slug"]; ok {
+		if _, handlerErr := a.getAuthor(r, slug); handlerErr != nil {
+			return handlerErr
+		}
+
+		options.Filter.AuthorSlug = slug
+	}
 
-	databaseList, err := a.Database.List(r.Context(), offset, limit)
+	total, err := a.Database.Count(r.Context(), options)
 	if err != nil {
-		a.logError(r, "error getting image list from database", err)
+		a.logError(r, "error counting images in database", err)
 		return handler.InternalServerError()
 	}
 
+	var databaseList []database.Image
+	var link string
+	var handlerErr *handler.Error
+
+	// Use cursor based pagination if the cursor query parameter is present, even if empty
+	if _, ok := r.URL.Query()["cursor"]; ok {
+		databaseList, link, handlerErr = a.listByCursor(r, options, limit)
+	} else {
+		databaseList, link, handlerErr = a.listByPage(r, options, limit, total)
+	}
+
+	if handlerErr != nil {
+		return handlerErr
+	}
+
 	list := []ListImage{}
 
 	for _, image := range databaseList {
 		list = append(list, a.getListImage(image))
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	w.Header().Set("Cache-Control", "private, no-cache, no-store, must-revalidate")
+	w.Header().Set("Link", link)
+	w.Header().Set("X-Total-Count", strconv.Itoa(total))
+
+	return a.writeMetadata(w, r, list)
+}
 
-	// If we've ran out of items, don't include the next page in the Link header
-	end := len(list) < limit
-	w.Header().Set("Access-Control-Expose-Headers", "Link")
-	w.Header().Set("Link", a.getLinkHeader(page, limit, end))
+// writeMetadata writes image metadata as JSON, with a strong ETag based on the catalogue version and the contents
+// Responds with 304 Not Modified instead if the client already has the metadata
+func (a *API) writeMetadata(w http.ResponseWriter, r *http.Request, metadata any) *handler.Error {
+	return a.writeMetadataWithCacheControl(w, r, metadata, a.metadataCacheControl())
+}
 
-	if err := json.NewEncoder(w).Encode(list); err != nil {
-		a.logError(r, "error encoding image list", err)
+// writeMetadataWithCacheControl writes image metadata like writeMetadata, with the Cache-Control header
+func (a *API) writeMetadataWithCacheControl(w http.ResponseWriter, r *http.Request, metadata any, cacheControl string) *handler.Error {
+	data, err := json.Marshal(metadata)
+	if err != nil {
+		a.logError(r, "error encoding image metadata", err)
 		return handler.InternalServerError()
 	}
+	data = append(data, '\n')
+
+	return a.writeVersioned(w, r, data, "application/json", cacheControl)
+}
+
+// writeVersioned writes data with a strong ETag based on the catalogue version and the data
+// Responds with 304 Not Modified instead if the client already has the data
+func (a *API) writeVersioned(w http.ResponseWriter, r *http.Request, data []byte, contentType string, cacheControl string) *handler.Error {
+	version, err := a.Database.Version(r.Context())
+	if err != nil {
+		a.logError(r, "error getting catalogue version from database", err)
+		return handler.InternalServerError()
+	}
+
+	hash := sha256.Sum256(append([]byte(version), data...))
+	etag := fmt.Sprintf("\"%s\"", hex.EncodeToString(hash[:16]))
+
+	w.Header().Set("Cache-Control", cacheControl)
+	w.Header().Set("ETag", etag)
+
+	if etagMatches(r.Header.Get("If-None-Match"), etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return nil
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.Write(data)
 
 	return nil
 }
 
+// metadataCacheControl returns the Cache-Control header for image metadata
+// Metadata is always revalidated using the ETag, unless a public cache max age is configured
+func (a *API) metadataCacheControl() string {
+	if a.MetadataCacheMaxAge > 0 {
+		return fmt.Sprintf("public, max-age=%d", int(a.MetadataCacheMaxAge.Seconds()))
+	}
+
+	return "private, no-cache"
+}
+
+// etagMatches returns whether the If-None-Match header matches the ETag
+func etagMatches(ifNoneMatch, etag string) bool {
+	for _, value := range strings.Split(ifNoneMatch, ",") {
+		value = strings.TrimPrefix(strings.TrimSpace(value), "W/")
+		if value == "*" || value == etag {
+			return true
+		}
+	}
+
+	return false
+}
+
+// listByPage returns a page of images using the `page` query parameter, and the Link header for it
+func (a *API) listByPage(r *http.Request, options database.ListOptions, limit, total int) ([]database.Image, string, *handler.Error) {
+	page := getPage(r)
+	offset := limit * (page - 1)
+
+	databaseList, err := a.Database.List(r.Context(), options, offset, limit)
+	if err != nil {
+		a.logError(r, "error getting image list from database", err)
+		return nil, "", handler.InternalServerError()
+	}
+
+	return databaseList, a.getLinkHeader(r.URL.EscapedPath(), page, limit, total, getListQuery(r)), nil
+}
+
+// listByCursor returns the images after the `cursor` query parameter, and the Link header for them
+// Unlike offsets, cursors keep pointing at the same position in the list when images are added or removed
+func (a *API) listByCursor(r *http.Request, options database.ListOptions, limit int) ([]database.Image, string, *handler.Error) {
+	after, err := decodeCursor(r.URL.Query().Get("cursor"))
+	if err != nil {
+		return nil, "", errorCodes.BadRequest(err)
+	}
+
+	options.After = after
+
+	databaseList, err := a.Database.List(r.Context(), options, 0, limit)
+	if err != nil {
+		a.logError(r, "error getting image list from database", err)
+		return nil, "", handler.InternalServerError()
+	}
+
+	remaining, err := a.Database.Count(r.Context(), options)
+	if err != nil {
+		a.logError(r, "error counting images in database", err)
+		return nil, "", handler.InternalServerError()
+	}
+
+	path := r.URL.EscapedPath()
+	query := getListQuery(r)
+	links := []string{a.getLink(path, fmt.Sprintf("cursor=&limit=%d", limit), query, "first")}
+
+	if remaining > len(databaseList) {
+		next := encodeCursor(database.NewCursor(databaseList[len(databaseList)-1]))
+		links = append(links, a.getLink(path, fmt.Sprintf("cursor=%s&limit=%d", next, limit), query, "next"))
+	}
+
+	return databaseList, strings.Join(links, ", "), nil
+}
+
+// encodeCursor encodes a cursor into an opaque string
+func encodeCursor(cursor *database.Cursor) string {
+	data, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// decodeCursor decodes a cursor from an opaque string, returning nil for an empty string
+func decodeCursor(value string) (*database.Cursor, error) {
+	if value == "" {
+		return nil, nil
+	}
+
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	var cursor database.Cursor
+	if err := json.Unmarshal(data, &cursor); err != nil || cursor.ID == "" {
+		return nil, ErrInvalidCursor
+	}
+
+	return &cursor, nil
+}
+
 func getLimit(r *http.Request) int {
 	limit, err := strconv.Atoi(r.URL.Query().Get("limit"))
 	if err != nil || limit < 1 {
@@ -126,29 +291,103 @@ func getPage(r *http.Request) int {
 	return page
 }
 
-func (a *API) getLinkHeader(page, limit int, end bool) string {
-	// This will return a next even if there's only enough items for a single page, but lets ignore that for now
-	if page == 1 {
-		return fmt.Sprintf("<%s/v2/list?page=%d&limit=%d>; rel=\"next\"", a.RootURL, page+1, limit)
+// getListOptions returns the filter and sort order given in the query parameters
+func getListOptions(r *http.Request) (options database.ListOptions, err error) {
+	query := r.URL.Query()
+
+	options.Filter.Author = query.Get("author")
+
+	options.Filter.Orientation, err = getOrientation(r)
+	if err != nil {
+		return
+	}
+
+	if options.Filter.MinWidth, err = getQuerySize(query.Get("min_width")); err != nil {
+		return
 	}
 
-	if end {
-		return fmt.Sprintf("<%s/v2/list?page=%d&limit=%d>; rel=\"prev\"", a.RootURL, page-1, limit)
+	if options.Filter.MinHeight, err = getQuerySize(query.Get("min_height")); err != nil {
+		return
+	}
+
+	switch sort := database.Sort(query.Get("sort")); sort {
+	case "", database.SortByID, database.SortByAuthor, database.SortByWidth:
+		options.Sort = sort
+	case database.SortByShuffle:
+		// Hash the seed using murmur3, like for the seed routes
+		options.Sort = sort
+		options.Seed = int64(murmur3.StringSum64(query.Get("seed")))
+	default:
+		return options, ErrInvalidSort
+	}
+
+	return
+}
+
+// listQueryParams are the query parameters that are kept across pages in the Link header
+var listQueryParams = []string{"author", "min_width", "min_height", "orientation", "sort", "seed"}
+
+// getListQuery returns the filter and sort query parameters of the request
+func getListQuery(r *http.Request) url.Values {
+	query := url.Values{}
+	for _, key := range listQueryParams {
+		if value := r.URL.Query().Get(key); value != "" {
+			query.Set(key, value)
+		}
+	}
+
+	return query
+}
+
+func (a *API) getLinkHeader(path string, page, limit, total int, query url.Values) string {
+	lastPage := (total + limit - 1) / limit
+	if lastPage < 1 {
+		lastPage = 1
+	}
+
+	links := []string{a.getLink(path, fmt.Sprintf("page=1&limit=%d", limit), query, "first")}
+
+	if page > 1 {
+		links = append(links, a.getLink(path, fmt.Sprintf("page=%d&limit=%d", page-1, limit), query, "prev"))
+	}
+
+	if page < lastPage {
+		links = append(links, a.getLink(path, fmt.Sprintf("page=%d&limit=%d", page+1, limit), query, "next"))
+	}
+
+	links = append(links, a.getLink(path, fmt.Sprintf("page=%d&limit=%d", lastPage, limit), query, "last"))
+
+	return strings.Join(links, ", ")
+}
+
+// getLink returns a link to the list at path with the given pagination query parameters
+// The filter and sort query parameters are kept when moving between pages
+func (a *API) getLink(path, pagination string, query url.Values, rel string) string {
+	var extraQuery string
+	if len(query) > 0 {
+		extraQuery = "&" + query.Encode()
 	}
 
-	return fmt.Sprintf("<%s/v2/list?page=%d&limit=%d>; rel=\"prev\", <%s/v2/list?page=%d&limit=%d>; rel=\"next\"",
-		a.RootURL, page-1, limit, a.RootURL, page+1, limit,
-	)
+	return fmt.Sprintf("<%s%s?%s%s>; rel=\"%s\"", a.RootURL, path, pagination, extraQuery, rel)
 }
 
 func (a *API) getListImage(image database.Image) ListImage {
 	return ListImage{
 		Image: database.Image{
-			ID:     image.ID,
-			Author: image.Author,
-			Width:  image.Width,
-			Height: image.Height,
-			URL:    image.URL,
+			ID:          image.ID,
+			Author:      image.Author,
+			AuthorURL:   image.AuthorURL,
+			Width:       image.Width,
+			Height:      image.Height,
+			URL:         image.URL,
+			Tags:        image.Tags,
+			Title:       image.Title,
+			Description: image.Description,
+			License:     image.License,
+			SourceURL:   image.SourceURL,
+			CameraModel: image.CameraModel,
+			FocalLength: image.FocalLength,
+			CapturedAt:  image.CapturedAt,
 		},
 		DownloadURL: fmt.Sprintf("%s/id/%s/%d/%d", a.RootURL, image.ID, image.Width, image.Height),
 	}
@@ -0,0 +1,182 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/DMarby/picsum-photos/internal/handler"
+	"github.com/DMarby/picsum-photos/internal/params"
+	"github.com/gorilla/mux"
+)
+
+// ErrUnsupportedFormat is returned for oEmbed formats other than json
+var ErrUnsupportedFormat = fmt.Errorf("Unsupported format")
+
+// OEmbed is an oEmbed photo response
+type OEmbed struct {
+	Type         string `json:"type"`
+	Version      string `json:"version"`
+	Title        string `json:"title"`
+	AuthorName   string `json:"author_name"`
+	AuthorURL    string `json:"author_url"`
+	ProviderName string `json:"provider_name"`
+	ProviderURL  string `json:"provider_url"`
+	URL          string `json:"url"`
+	Width        int    `json:"width"`
+	Height       int    `json:"height"`
+}
+
+// imagePickers returns the image pickers for the image routes, by route name without the api. or api.resolve. prefix
+func (a *API) imagePickers() map[string]imagePicker {
+	return map[string]imagePicker{
+		"randomImageRedirect":  a.pickRandomImage,
+		"imageRedirect":        a.pickImageByID,
+		"ratioImageRedirect":   a.pickRatioImage,
+		"tagImageRedirect":     a.pickRandomImage,
+		"tagSeedImageRedirect": a.pickSeedImage,
+		"authorImageRedirect":  a.pickRandomImage,
+		"seedImageRedirect":    a.pickSeedImage,
+		"dailyImageRedirect":   a.pickDailyImage,
+		"deprecatedImage":      a.pickDeprecatedImage,
+	}
+}
+
+// oembedHandler returns an oEmbed photo response for the image route URL in the `url` query parameter, matched using the router
+// Supports the `format`, `maxwidth` and `maxheight` query parameters
+func (a *API) oembedHandler(router *mux.Router) handler.Handler {
+	pickers := a.imagePickers()
+
+	return func(w http.ResponseWriter, r *http.Request) *handler.Error {
+		query := r.URL.Query()
+
+		if format := query.Get("format"); format != "" && format != "json" {
+			return errorCodes.New(http.StatusNotImplemented, ErrUnsupportedFormat)
+		}
+
+		maxWidth, err := getQuerySize(query.Get("maxwidth"))
+		if err != nil {
+			return errorCodes.BadRequest(err)
+		}
+
+		maxHeight, err := getQuerySize(query.Get("maxheight"))
+		if err != nil {
+			return errorCodes.BadRequest(err)
+		}
+
+		// Match the URL against the image routes
+		imageRequest, pick, ok := a.matchImageURL(r, router, pickers, query.Get("url"))
+		if !ok {
+			return notFoundError
+		}
+
+		p, err := params.GetParams(imageRequest)
+		if err != nil {
+			return errorCodes.BadRequest(err)
+		}
+
+		image, handlerErr := pick(imageRequest, p)
+		if handlerErr != nil {
+			return handlerErr
+		}
+
+		// Validate the image URL with the limits of its route, where full-size images can be larger than the max image size
+		if handlerErr := validateRequestParams(r, p); handlerErr != nil {
+			return handlerErr
+		}
+
+		// Scale the image down to fit within the max width and height, keeping the aspect ratio
+		width, height := getImageDimensions(p, image)
+		scale := 1.0
+		if maxWidth > 0 {
+			scale = math.Min(scale, float64(maxWidth)/float64(width))
+		}
+
+		if maxHeight > 0 {
+			scale = math.Min(scale, float64(maxHeight)/float64(height))
+		}
+
+		// Images that fit are left as they are, so that full-size images stay full size
+		// Scaled images are no longer full size, so they're also scaled to fit within the max image size
+		if scale < 1 {
+			maxSize := float64(getMaxImageSize(getAPIKey(r)))
+			scale = math.Min(scale, math.Min(maxSize/float64(width), maxSize/float64(height)))
+
+			p.Width = max(int(math.Floor(float64(width)*scale)), 1)
+			p.Height = max(int(math.Floor(float64(height)*scale)), 1)
+		}
+
+		resolvedImage, handlerErr := a.resolveImage(r, p, image)
+		if handlerErr != nil {
+			return handlerErr
+		}
+
+		authorURL := image.AuthorURL
+		if authorURL == "" {
+			authorURL = image.URL
+		}
+
+		oembed := OEmbed{
+			Type:         "photo",
+			Version:      "1.0",
+			Title:        fmt.Sprintf("Photo by %s", image.Author),
+			AuthorName:   image.Author,
+			AuthorURL:    authorURL,
+			ProviderName: "Lorem Picsum",
+			ProviderURL:  a.RootURL,
+			URL:          resolvedImage.URL,
+			Width:        resolvedImage.Width,
+			Height:       resolvedImage.Height,
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "private, no-cache, no-store, must-revalidate")
+
+		if err := json.NewEncoder(w).Encode(oembed); err != nil {
+			a.logError(r, "error encoding oembed", err)
+			return handler.InternalServerError()
+		}
+
+		return nil
+	}
+}
+
+// matchImageURL matches a URL on the api against the image routes of the router
+// It returns a request for the URL with the route variables set, and the image picker for the route
+func (a *API) matchImageURL(r *http.Request, router *mux.Router, pickers map[string]imagePicker, rawURL string) (*http.Request, imagePicker, bool) {
+	imageURL, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, nil, false
+	}
+
+	rootURL, err := url.Parse(a.RootURL)
+	if err != nil || !strings.EqualFold(imageURL.Host, rootURL.Host) {
+		return nil, nil, false
+	}
+
+	imageRequest, err := http.NewRequestWithContext(r.Context(), http.MethodGet, (&url.URL{Path: imageURL.Path, RawPath: imageURL.RawPath, RawQuery: imageURL.RawQuery}).String(), nil)
+	if err != nil {
+		return nil, nil, false
+	}
+
+	var match mux.RouteMatch
+	if !router.Match(imageRequest, &match) || match.MatchErr != nil || match.Route == nil {
+		return nil, nil, false
+	}
+
+	pick, ok := pickers[strings.TrimPrefix(strings.TrimPrefix(match.Route.GetName(), "api.resolve."), "api.")]
+	if !ok {
+		return nil, nil, false
+	}
+
+	return mux.SetURLVars(imageRequest, match.Vars), pick, true
+}
+
+// oembedURL returns the URL of the oEmbed response for the image route of the request
+// The query parameters are left out, to keep the header small and not leak the API key into it
+func (a *API) oembedURL(r *http.Request) string {
+	return fmt.Sprintf("%s/oembed?url=%s&format=json", a.RootURL, url.QueryEscape(a.RootURL+r.URL.EscapedPath()))
+}
@@ -0,0 +1,667 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"net/http"
+	"reflect"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/DMarby/picsum-photos/internal/database"
+	"github.com/DMarby/picsum-photos/internal/handler"
+	"github.com/DMarby/picsum-photos/internal/iiif"
+	"github.com/gorilla/mux"
+)
+
+// OpenAPI description types, containing the subset of OpenAPI 3.0 used by the spec
+type openAPISpec struct {
+	OpenAPI    string                     `json:"openapi"`
+	Info       openAPIInfo                `json:"info"`
+	Servers    []openAPIServer            `json:"servers"`
+	Paths      map[string]openAPIPathItem `json:"paths"`
+	Components openAPIComponents          `json:"components"`
+	Security   []map[string][]string      `json:"security,omitempty"`
+}
+
+type openAPIInfo struct {
+	Title   string `json:"title"`
+	Version string `json:"version"`
+}
+
+type openAPIServer struct {
+	URL string `json:"url"`
+}
+
+type openAPIPathItem struct {
+	Parameters []openAPIParameter `json:"parameters,omitempty"`
+	Get        *openAPIOperation  `json:"get,omitempty"`
+}
+
+type openAPIOperation struct {
+	OperationID string                     `json:"operationId"`
+	Summary     string                     `json:"summary"`
+	Parameters  []openAPIParameter         `json:"parameters,omitempty"`
+	Responses   map[string]openAPIResponse `json:"responses"`
+}
+
+type openAPIParameter struct {
+	Name            string         `json:"name"`
+	In              string         `json:"in"`
+	Description     string         `json:"description"`
+	Required        bool           `json:"required,omitempty"`
+	Deprecated      bool           `json:"deprecated,omitempty"`
+	AllowEmptyValue bool           `json:"allowEmptyValue,omitempty"`
+	Explode         *bool          `json:"explode,omitempty"`
+	Schema          *openAPISchema `json:"schema"`
+}
+
+type openAPIResponse struct {
+	Description string                      `json:"description"`
+	Headers     map[string]openAPIHeader    `json:"headers,omitempty"`
+	Content     map[string]openAPIMediaType `json:"content,omitempty"`
+}
+
+type openAPIHeader struct {
+	Description string         `json:"description"`
+	Schema      *openAPISchema `json:"schema"`
+}
+
+type openAPIMediaType struct {
+	Schema *openAPISchema `json:"schema"`
+}
+
+type openAPIComponents struct {
+	Schemas         map[string]*openAPISchema        `json:"schemas"`
+	SecuritySchemes map[string]openAPISecurityScheme `json:"securitySchemes,omitempty"`
+}
+
+type openAPISecurityScheme struct {
+	Type        string `json:"type"`
+	Description string `json:"description"`
+	Scheme      string `json:"scheme,omitempty"`
+	In          string `json:"in,omitempty"`
+	Name        string `json:"name,omitempty"`
+}
+
+type openAPISchema struct {
+	Ref        string                    `json:"$ref,omitempty"`
+	Type       string                    `json:"type,omitempty"`
+	Format     string                    `json:"format,omitempty"`
+	Pattern    string                    `json:"pattern,omitempty"`
+	Enum       []string                  `json:"enum,omitempty"`
+	Items      *openAPISchema            `json:"items,omitempty"`
+	MaxItems   int                       `json:"maxItems,omitempty"`
+	Properties map[string]*openAPISchema `json:"properties,omitempty"`
+	Required   []string                  `json:"required,omitempty"`
+}
+
+var (
+	stringSchema  = &openAPISchema{Type: "string"}
+	integerSchema = &openAPISchema{Type: "integer"}
+	binarySchema  = &openAPISchema{Type: "string", Format: "binary"}
+	explodeFalse  = false
+)
+
+// Path parameters, by the name of the mux route variable
+var pathParameters = map[string]openAPIParameter{
+	"id":       {Description: "The image ID", Schema: stringSchema},
+	"size":     {Description: "The width and height of the image", Schema: integerSchema},
+	"width":    {Description: "The width of the image", Schema: integerSchema},
+	"height":   {Description: "The height of the image", Schema: integerSchema},
+	"ratio":    {Description: "The aspect ratio of the image, e.g. 16:9", Schema: &openAPISchema{Type: "string", Pattern: "^[0-9]+:[0-9]+$"}},
+	"tag":      {Description: "Only pick images with the tag", Schema: stringSchema},
+	"slug":     {Description: "The slug of the author", Schema: stringSchema},
+	"seed":     {Description: "Return the same image every time for the seed", Schema: stringSchema},
+	"region":   {Description: "The IIIF region of the image, full, square, x,y,w,h or pct:x,y,w,h", Schema: stringSchema},
+	"rotation": {Description: "The IIIF clockwise rotation of 0, 90, 180 or 270 degrees, prefixed by ! to mirror the image", Schema: stringSchema},
+	"quality":  {Description: "The IIIF quality of the image", Schema: &openAPISchema{Type: "string", Enum: []string{"default", "color", "gray"}}},
+	"level":    {Description: "The deep zoom level, where 0 is 1x1 pixels", Schema: integerSchema},
+	"col":      {Description: "The column of the tile", Schema: integerSchema},
+	"row":      {Description: "The row of the tile", Schema: integerSchema},
+	"format":   {Description: "The IIIF format of the image", Schema: &openAPISchema{Type: "string", Enum: []string{"jpg", "webp", "avif"}}},
+}
+
+// fileExtensions are the file extensions of the image routes, each added as a separate path
+var fileExtensions = []string{".jpg", ".webp", ".avif"}
+
+// Query parameters
+var (
+	grayscaleParameter   = openAPIParameter{Name: "grayscale", In: "query", Description: "Grayscale the image", AllowEmptyValue: true, Schema: stringSchema}
+	blurParameter        = openAPIParameter{Name: "blur", In: "query", Description: "Blur the image, by an amount between 1 and 10 if given", AllowEmptyValue: true, Schema: integerSchema}
+	orientationParameter = openAPIParameter{Name: "orientation", In: "query", Description: "Only pick landscape, portrait or square images", Schema: &openAPISchema{Type: "string", Enum: []string{string(database.Landscape), string(database.Portrait), string(database.Square)}}}
+	excludeParameter     = openAPIParameter{Name: "exclude", In: "query", Description: "Comma separated image IDs not to pick", Explode: &explodeFalse, Schema: &openAPISchema{Type: "array", Items: stringSchema, MaxItems: maxExclude}}
+	imageParameter       = openAPIParameter{Name: "image", In: "query", Description: "Get the image by ID", Deprecated: true, Schema: stringSchema}
+	regionParameter      = openAPIParameter{Name: "region", In: "query", Description: "Crop the original image to the region x,y,width,height before resizing it", Schema: stringSchema}
+	mirrorParameter      = openAPIParameter{Name: "mirror", In: "query", Description: "Mirror the image horizontally", AllowEmptyValue: true, Schema: stringSchema}
+	rotateParameter      = openAPIParameter{Name: "rotate", In: "query", Description: "Rotate the image clockwise by 90, 180 or 270 degrees, after mirroring it", Schema: &openAPISchema{Type: "string", Enum: []string{"90", "180", "270"}}}
+	hmacParameter        = openAPIParameter{Name: "hmac", In: "query", Description: "HMAC signature of the path and query parameters", Required: true, Schema: stringSchema}
+
+	transformParameters = []openAPIParameter{grayscaleParameter, blurParameter}
+	filterParameters    = []openAPIParameter{orientationParameter, excludeParameter, grayscaleParameter, blurParameter}
+
+	listParameters = []openAPIParameter{
+		{Name: "page", In: "query", Description: "What page to display", Schema: integerSchema},
+		{Name: "cursor", In: "query", Description: "Display the page after the cursor from the Link header, or the first page if empty", AllowEmptyValue: true, Schema: stringSchema},
+		{Name: "limit", In: "query", Description: fmt.Sprintf("How many entries to display per page, up to %d", maxLimit), Schema: integerSchema},
+		{Name: "author", In: "query", Description: "Only list images by the author", Schema: stringSchema},
+		{Name: "min_width", In: "query", Description: "Only list images at least this wide", Schema: integerSchema},
+		{Name: "min_height", In: "query", Description: "Only list images at least this tall", Schema: integerSchema},
+		orientationParameter,
+		{Name: "sort", In: "query", Description: "The sort order, shuffle uses the seed query parameter", Schema: &openAPISchema{Type: "string", Enum: []string{string(database.SortByID), string(database.SortByAuthor), string(database.SortByWidth), string(database.SortByShuffle)}}},
+		{Name: "seed", In: "query", Description: "The seed to shuffle by", Schema: stringSchema},
+	}
+
+	srcsetParameters = []openAPIParameter{
+		{Name: "widths", In: "query", Description: fmt.Sprintf("Comma separated widths to include, up to %d", maxSrcsetWidths), Explode: &explodeFalse, Schema: &openAPISchema{Type: "array", Items: integerSchema}},
+		{Name: "ratio", In: "query", Description: "The aspect ratio of the images, e.g. 16:9, defaults to the aspect ratio of the image", Schema: &openAPISchema{Type: "string", Pattern: "^[0-9]+:[0-9]+$"}},
+		{Name: "sizes", In: "query", Description: "The sizes attribute of the <img> tag", Schema: stringSchema},
+		grayscaleParameter,
+		blurParameter,
+	}
+
+	// The IIIF size overrides the size path parameter of the image routes
+	iiifImageParameters = []openAPIParameter{
+		{Name: "size", In: "path", Description: "The IIIF size of the image, max, w,, ,h, pct:n, w,h or !w,h, prefixed by ^ to allow upscaling", Required: true, Schema: stringSchema},
+	}
+
+	dailyParameters = []openAPIParameter{
+		{Name: "date", In: "query", Description: "Get the image of the day for the date, in the form YYYY-MM-DD", Schema: &openAPISchema{Type: "string", Format: "date"}},
+		{Name: "tz", In: "query", Description: "Get the image of the day for the current date in the IANA time zone, instead of UTC", Schema: stringSchema},
+	}
+
+	oembedParameters = []openAPIParameter{
+		{Name: "url", In: "query", Description: "The URL of an image route, e.g. /id/{id}/{width}/{height}", Required: true, Schema: stringSchema},
+		{Name: "format", In: "query", Description: "The response format, only json is supported", Schema: &openAPISchema{Type: "string", Enum: []string{"json"}}},
+		{Name: "maxwidth", In: "query", Description: "The max width of the image", Schema: integerSchema},
+		{Name: "maxheight", In: "query", Description: "The max height of the image", Schema: integerSchema},
+	}
+
+	randomParameters = []openAPIParameter{
+		{Name: "count", In: "query", Description: fmt.Sprintf("How many distinct images to return, up to %d", maxCount), Schema: integerSchema},
+		{Name: "width", In: "query", Description: "The width of the images, defaults to the width of each image", Schema: integerSchema},
+		{Name: "height", In: "query", Description: "The height of the images, defaults to the height of each image", Schema: integerSchema},
+		{Name: "format", In: "query", Description: "The image format", Schema: &openAPISchema{Type: "string", Enum: []string{"jpg", "webp", "avif"}}},
+		{Name: "seed", In: "query", Description: "Return the same images every time for the seed", Schema: stringSchema},
+		orientationParameter,
+		{Name: "tag", In: "query", Description: "Only pick images with the tag", Schema: stringSchema},
+		{Name: "author_slug", In: "query", Description: "Only pick images by the author with the slug, e.g. jane-doe", Schema: stringSchema},
+		excludeParameter,
+		grayscaleParameter,
+		blurParameter,
+	}
+)
+
+// routeDoc describes a route, for the OpenAPI description
+type routeDoc struct {
+	summary    string
+	parameters []openAPIParameter
+	// The JSON response, or nil for routes returning an image
+	response any
+	// The content type of a response that's neither JSON or an image, described as a string
+	contentType string
+	// Whether the Link and X-Total-Count pagination headers are set
+	paginated bool
+	// Whether the ETag header is set, responding with 304 Not Modified when it matches If-None-Match
+	versioned bool
+	// Whether the image params are validated against the features of the API key, responding with 403 Forbidden
+	keyFeatures bool
+}
+
+// routeDocs describes every route of the api by name, without the api. or api.resolve. prefix
+var routeDocs = map[string]routeDoc{
+	"list":                 {summary: "List images", parameters: listParameters, response: []ListImage{}, paginated: true, versioned: true},
+	"tags":                 {summary: "List tags", response: []database.Tag{}},
+	"authors":              {summary: "List authors", response: []ListAuthor{}},
+	"authorImages":         {summary: "List the images of an author", parameters: listParameters, response: []ListImage{}, paginated: true, versioned: true},
+	"random":               {summary: "Get distinct random images", parameters: randomParameters, response: []ResolvedImage{}, keyFeatures: true},
+	"openapi":              {summary: "Get the OpenAPI description of the api", response: map[string]any{}},
+	"openapiImageService":  {summary: "Get the OpenAPI description of the image service", response: map[string]any{}},
+	"randomImageRedirect":  {summary: "Get a random image", parameters: append(filterParameters, imageParameter), keyFeatures: true},
+	"imageRedirect":        {summary: "Get an image by ID", parameters: transformParameters, keyFeatures: true},
+	"ratioImageRedirect":   {summary: "Get a random image, preferring images close to the aspect ratio", parameters: filterParameters, keyFeatures: true},
+	"tagImageRedirect":     {summary: "Get a random image with a tag", parameters: filterParameters, keyFeatures: true},
+	"tagSeedImageRedirect": {summary: "Get an image with a tag, based on a seed", parameters: filterParameters, keyFeatures: true},
+	"authorImageRedirect":  {summary: "Get a random image by an author", parameters: filterParameters, keyFeatures: true},
+	"seedImageRedirect":    {summary: "Get an image based on a seed", parameters: filterParameters, keyFeatures: true},
+	"dailyImageRedirect":   {summary: "Get the image of the day", parameters: append(dailyParameters, transformParameters...), keyFeatures: true},
+	"deprecatedImage":      {summary: "Get a random grayscale image", parameters: []openAPIParameter{imageParameter, blurParameter}, keyFeatures: true},
+	"info":                 {summary: "Get info about an image", response: ListImage{}, versioned: true},
+	"infoSeed":             {summary: "Get info about an image based on a seed", parameters: []openAPIParameter{orientationParameter, excludeParameter}, response: ListImage{}, versioned: true},
+	"dailyInfo":            {summary: "Get info about the image of the day", parameters: dailyParameters, response: ListImage{}, versioned: true},
+	"srcset":               {summary: "Get a srcset and <picture> tag for an image", parameters: srcsetParameters, response: Srcset{}, keyFeatures: true},
+	"dzi":                  {summary: "Get the Deep Zoom descriptor of an image", contentType: "application/xml", versioned: true},
+	"tile":                 {summary: "Get a deep zoom tile of an image"},
+	"iiifBase":             {summary: "Redirect to the IIIF image information of an image"},
+	"iiifInfo":             {summary: "Get the IIIF image information of an image", response: iiif.Info{}, versioned: true},
+	"iiifImage":            {summary: "Get an image using the IIIF Image API", parameters: iiifImageParameters, keyFeatures: true},
+	"oembed":               {summary: "Get an oEmbed photo response for an image URL", parameters: oembedParameters, response: OEmbed{}, keyFeatures: true},
+	"deprecatedList":       {summary: "List all images in the deprecated format", response: []DeprecatedImage{}},
+}
+
+// imageServiceRouteDocs describes every route of the image service by name
+var imageServiceRouteDocs = map[string]routeDoc{
+	"imageapi.image": {summary: "Get an image by ID, from a signed URL", parameters: append(transformParameters, regionParameter, mirrorParameter, rotateParameter, hmacParameter)},
+	"imageapi.tile":  {summary: "Get a deep zoom tile of an image of the width and height, from a signed URL", parameters: []openAPIParameter{hmacParameter}},
+}
+
+// Matches the variables in a mux path template, like {width:[0-9]+}, with the name and the pattern
+var muxVariable = regexp.MustCompile(`\{([^:{}]+)(?::([^{}]*))?\}`)
+
+// Headers of the error responses, by status
+var (
+	rateLimitHeaders = map[string]openAPIHeader{
+		"RateLimit-Limit":     {Description: "How many requests can be made at once", Schema: integerSchema},
+		"RateLimit-Remaining": {Description: "How many requests can be made until the budget is refilled", Schema: integerSchema},
+		"RateLimit-Reset":     {Description: "Seconds until the budget is refilled", Schema: integerSchema},
+		"RateLimit-Policy":    {Description: "The size of the budget and the seconds it takes to refill it, e.g. 20;w=10", Schema: stringSchema},
+	}
+
+	errorHeaders = map[string]map[string]openAPIHeader{
+		"401": {"WWW-Authenticate": {Description: "The Bearer authentication scheme, with the invalid_token error", Schema: stringSchema}},
+		"429": {"Retry-After": {Description: "Seconds until a request can be made again", Schema: integerSchema}},
+	}
+)
+
+// openAPIHandler serves an OpenAPI description
+func (a *API) openAPIHandler(spec *openAPISpec) handler.Handler {
+	return func(w http.ResponseWriter, r *http.Request) *handler.Error {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "private, no-cache, no-store, must-revalidate")
+
+		if err := json.NewEncoder(w).Encode(spec); err != nil {
+			a.logError(r, "error encoding OpenAPI description", err)
+			return handler.InternalServerError()
+		}
+
+		return nil
+	}
+}
+
+func newOpenAPISpec(title, serverURL string) *openAPISpec {
+	return &openAPISpec{
+		OpenAPI: "3.0.3",
+		Info: openAPIInfo{
+			Title:   title,
+			Version: "2",
+		},
+		Servers:    []openAPIServer{{URL: serverURL}},
+		Paths:      map[string]openAPIPathItem{},
+		Components: openAPIComponents{Schemas: map[string]*openAPISchema{}},
+	}
+}
+
+// openAPISpec builds the OpenAPI description of the api from its routes, returning an error if a route isn't described
+func (a *API) openAPISpec(router *mux.Router) (*openAPISpec, error) {
+	spec := newOpenAPISpec("Lorem Picsum", a.RootURL)
+
+	errors := map[string]string{
+		"400": "Invalid parameters",
+		"404": "Not found",
+		"500": "Something went wrong",
+	}
+
+	// API keys are optional, with anonymous clients getting the default limits
+	if a.APIKeys != nil {
+		spec.Components.SecuritySchemes = map[string]openAPISecurityScheme{
+			"bearer": {Type: "http", Scheme: "bearer", Description: "An API key, with its own rate limits, max image size and features"},
+			"key":    {Type: "apiKey", In: "query", Name: "key", Description: "An API key, with its own rate limits, max image size and features"},
+		}
+		spec.Security = []map[string][]string{{}, {"bearer": {}}, {"key": {}}}
+		errors["401"] = "Invalid API key"
+	}
+
+	if a.RateLimits != nil {
+		errors["429"] = "Too many requests"
+	}
+
+	err := router.Walk(func(route *mux.Route, router *mux.Router, ancestors []*mux.Route) error {
+		name := route.GetName()
+
+		// Skip subrouters and the static files
+		if (route.GetHandler() == nil && name == "") || name == "api.serveFile" {
+			return nil
+		}
+
+		resolve := strings.HasPrefix(name, "api.resolve.")
+		doc, ok := routeDocs[strings.TrimPrefix(strings.TrimPrefix(name, "api.resolve."), "api.")]
+		if !ok {
+			return fmt.Errorf("route %s is missing from the OpenAPI description", name)
+		}
+
+		routeErrors := errors
+		if doc.keyFeatures && a.APIKeys != nil {
+			routeErrors = maps.Clone(errors)
+			routeErrors["403"] = "Feature not allowed for the API key"
+		}
+
+		status, imageResponse := a.imageResponse(resolve)
+		return spec.addRoute(route, doc, status, imageResponse, routeErrors)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return spec, nil
+}
+
+// imageServiceOpenAPISpec builds the OpenAPI description of the image service from its routes
+func (a *API) imageServiceOpenAPISpec(router *mux.Router) (*openAPISpec, error) {
+	spec := newOpenAPISpec("Lorem Picsum image service", a.ImageServiceURL)
+
+	errors := map[string]string{
+		"400": "Invalid parameters",
+		"404": "Not found",
+		"410": "The signed URL has expired",
+		"429": "Too many requests",
+		"500": "Something went wrong",
+	}
+
+	err := router.Walk(func(route *mux.Route, router *mux.Router, ancestors []*mux.Route) error {
+		doc, ok := imageServiceRouteDocs[route.GetName()]
+		if !ok {
+			return fmt.Errorf("route %s is missing from the OpenAPI description", route.GetName())
+		}
+
+		return spec.addRoute(route, doc, "200", imageContentResponse(), errors)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return spec, nil
+}
+
+// addRoute adds a route to the spec, with imageResponse as the response for routes without a JSON response,
+// and the error responses by status
+// Routes with a file extension are added once for each extension, and once without it if it's optional,
+// as a path parameter can't describe an optional suffix of a path segment
+func (s *openAPISpec) addRoute(route *mux.Route, doc routeDoc, imageStatus string, imageResponse openAPIResponse, errors map[string]string) error {
+	template, err := route.GetPathTemplate()
+	if err != nil {
+		return err
+	}
+
+	for _, match := range muxVariable.FindAllStringSubmatch(template, -1) {
+		if match[1] != "extension" {
+			continue
+		}
+
+		// The extension is optional if its pattern matches an empty string
+		optional, err := regexp.MatchString("^(?:"+match[2]+")$", "")
+		if err != nil {
+			return err
+		}
+
+		if optional {
+			if err := s.addPath(route.GetName(), strings.Replace(template, match[0], "", 1), "", doc, imageStatus, imageResponse, errors); err != nil {
+				return err
+			}
+		}
+
+		for _, extension := range fileExtensions {
+			if err := s.addPath(route.GetName(), strings.Replace(template, match[0], extension, 1), extension, doc, imageStatus, imageResponse, errors); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+
+	return s.addPath(route.GetName(), template, "", doc, imageStatus, imageResponse, errors)
+}
+
+// addPath adds a path template of a route to the spec, with the file extension of the path if it has one
+func (s *openAPISpec) addPath(name, template, extension string, doc routeDoc, imageStatus string, imageResponse openAPIResponse, errors map[string]string) error {
+	path := muxVariable.ReplaceAllString(template, "{$1}")
+	if _, ok := s.Paths[path]; ok {
+		return fmt.Errorf("route %s has the same path as another route in the OpenAPI description", name)
+	}
+
+	var parameters []openAPIParameter
+	for _, match := range muxVariable.FindAllStringSubmatch(template, -1) {
+		parameter, ok := pathParameters[match[1]]
+		if !ok {
+			return fmt.Errorf("path parameter %s of %s is missing from the OpenAPI description", match[1], template)
+		}
+
+		parameter.Name = match[1]
+		parameter.In = "path"
+		parameter.Required = true
+		parameters = append(parameters, parameter)
+	}
+
+	status, response := imageStatus, imageResponse
+	if doc.response != nil {
+		schema, err := s.schema(reflect.TypeOf(doc.response))
+		if err != nil {
+			return fmt.Errorf("route %s: %w", name, err)
+		}
+
+		status = "200"
+		response = openAPIResponse{
+			Description: "OK",
+			Content: map[string]openAPIMediaType{
+				"application/json": {Schema: schema},
+			},
+		}
+	}
+
+	if doc.contentType != "" {
+		status = "200"
+		response = openAPIResponse{
+			Description: "OK",
+			Content: map[string]openAPIMediaType{
+				doc.contentType: {Schema: stringSchema},
+			},
+		}
+	}
+
+	response.Headers = maps.Clone(response.Headers)
+	if response.Headers == nil {
+		response.Headers = map[string]openAPIHeader{}
+	}
+
+	if doc.paginated {
+		response.Headers["Link"] = openAPIHeader{Description: "Links to the first, previous, next and last pages", Schema: stringSchema}
+		response.Headers["X-Total-Count"] = openAPIHeader{Description: "The total number of images in the list", Schema: integerSchema}
+	}
+
+	if _, ok := errors["429"]; ok {
+		maps.Copy(response.Headers, rateLimitHeaders)
+	}
+
+	responses := map[string]openAPIResponse{}
+
+	if doc.versioned {
+		etag := openAPIHeader{Description: "The version of the response, to send in the If-None-Match header", Schema: stringSchema}
+		response.Headers["ETag"] = etag
+		responses["304"] = openAPIResponse{
+			Description: "Not modified, the If-None-Match header matches the ETag",
+			Headers:     map[string]openAPIHeader{"ETag": etag},
+		}
+	}
+
+	responses[status] = response
+
+	// Errors are returned as text, or as problem details depending on the Accept header
+	problemSchema, err := s.schema(reflect.TypeOf(handler.Problem{}))
+	if err != nil {
+		return err
+	}
+
+	for errorStatus, description := range errors {
+		headers := maps.Clone(errorHeaders[errorStatus])
+		if errorStatus == "429" {
+			maps.Copy(headers, rateLimitHeaders)
+		}
+
+		responses[errorStatus] = openAPIResponse{
+			Description: description,
+			Headers:     headers,
+			Content: map[string]openAPIMediaType{
+				"text/plain":               {Schema: stringSchema},
+				"application/json":         {Schema: problemSchema},
+				"application/problem+json": {Schema: problemSchema},
+			},
+		}
+	}
+
+	s.Paths[path] = openAPIPathItem{
+		Parameters: parameters,
+		Get: &openAPIOperation{
+			OperationID: operationID(name, parameters, extension),
+			Summary:     doc.summary,
+			Parameters:  doc.parameters,
+			Responses:   responses,
+		},
+	}
+
+	return nil
+}
+
+// imageResponse returns the response for the image routes of the api, depending on if they're resolved, proxied or redirected
+func (a *API) imageResponse(resolve bool) (string, openAPIResponse) {
+	if resolve {
+		return "200", openAPIResponse{
+			Description: "The signed image service URL and info about the image",
+			Content: map[string]openAPIMediaType{
+				"application/json": {Schema: &openAPISchema{Ref: "#/components/schemas/ResolvedImage"}},
+			},
+		}
+	}
+
+	if a.ImageProxy != nil {
+		return "200", imageContentResponse()
+	}
+
+	return "302", openAPIResponse{
+		Description: "Redirect to the image on the image service",
+		Headers: map[string]openAPIHeader{
+			"Location": {Description: "The signed image service URL", Schema: stringSchema},
+		},
+	}
+}
+
+func imageContentResponse() openAPIResponse {
+	return openAPIResponse{
+		Description: "The image",
+		Headers: map[string]openAPIHeader{
+			"Picsum-ID":         {Description: "The ID of the image", Schema: stringSchema},
+			"Picsum-Author":     {Description: "The author of the image, with the characters that aren't printable ASCII and % percent-encoded", Schema: stringSchema},
+			"Picsum-Author-URL": {Description: "The URL to credit the author of the image with", Schema: stringSchema},
+			"Link":              {Description: "The author URL, with rel=\"author\"", Schema: stringSchema},
+		},
+		Content: map[string]openAPIMediaType{
+			"image/jpeg": {Schema: binarySchema},
+			"image/webp": {Schema: binarySchema},
+			"image/avif": {Schema: binarySchema},
+		},
+	}
+}
+
+// operationID returns a unique operation ID for a route, from the route name, path parameters and file extension
+func operationID(name string, parameters []openAPIParameter, extension string) string {
+	parts := strings.Split(strings.TrimPrefix(name, "api."), ".")
+	if len(parameters) > 0 {
+		parts = append(parts, "by")
+	}
+
+	for _, parameter := range parameters {
+		parts = append(parts, parameter.Name)
+	}
+
+	if extension != "" {
+		parts = append(parts, "as", strings.TrimPrefix(extension, "."))
+	}
+
+	id := parts[0]
+	for _, part := range parts[1:] {
+		id += strings.ToUpper(part[:1]) + part[1:]
+	}
+
+	return id
+}
+
+// schema returns the schema for a type, adding named structs to the components
+func (s *openAPISpec) schema(t reflect.Type) (*openAPISchema, error) {
+	// Times are encoded as RFC 3339 strings
+	if t == reflect.TypeOf(time.Time{}) {
+		return &openAPISchema{Type: "string", Format: "date-time"}, nil
+	}
+
+	switch t.Kind() {
+	case reflect.Pointer:
+		return s.schema(t.Elem())
+	case reflect.Slice:
+		items, err := s.schema(t.Elem())
+		if err != nil {
+			return nil, err
+		}
+
+		return &openAPISchema{Type: "array", Items: items}, nil
+	case reflect.Map:
+		return &openAPISchema{Type: "object"}, nil
+	case reflect.String:
+		return stringSchema, nil
+	case reflect.Int, reflect.Int64:
+		return integerSchema, nil
+	case reflect.Float64:
+		return &openAPISchema{Type: "number"}, nil
+	case reflect.Bool:
+		return &openAPISchema{Type: "boolean"}, nil
+	case reflect.Struct:
+		if _, ok := s.Components.Schemas[t.Name()]; !ok {
+			schema := &openAPISchema{Type: "object", Properties: map[string]*openAPISchema{}}
+			s.Components.Schemas[t.Name()] = schema
+			if err := s.addProperties(schema, t); err != nil {
+				return nil, err
+			}
+		}
+
+		return &openAPISchema{Ref: "#/components/schemas/" + t.Name()}, nil
+	}
+
+	return nil, fmt.Errorf("unsupported type %s in the OpenAPI description", t)
+}
+
+// addProperties adds the JSON fields of a struct to the schema, including the fields of embedded structs
+func (s *openAPISpec) addProperties(schema *openAPISchema, t reflect.Type) error {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+
+		if field.Anonymous {
+			if err := s.addProperties(schema, field.Type); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if !field.IsExported() {
+			continue
+		}
+
+		name, options, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+
+		if name == "" {
+			name = field.Name
+		}
+
+		property, err := s.schema(field.Type)
+		if err != nil {
+			return fmt.Errorf("field %s of %s: %w", field.Name, t.Name(), err)
+		}
+
+		schema.Properties[name] = property
+		if !strings.Contains(options, "omitempty") {
+			schema.Required = append(schema.Required, name)
+		}
+	}
+
+	return nil
+}
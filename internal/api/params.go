@@ -2,28 +2,39 @@ package api
 
 import (
 	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
 
+	"github.com/DMarby/picsum-photos/internal/apikey"
 	"github.com/DMarby/picsum-photos/internal/database"
 	"github.com/DMarby/picsum-photos/internal/params"
+	"github.com/gorilla/mux"
 )
 
 // Errors
 var (
-	ErrInvalidBlurAmount = fmt.Errorf("Invalid blur amount")
+	ErrInvalidBlurAmount  = fmt.Errorf("Invalid blur amount")
+	ErrInvalidOrientation = fmt.Errorf("Invalid orientation")
+	ErrInvalidSort        = fmt.Errorf("Invalid sort")
+	ErrInvalidCursor      = fmt.Errorf("Invalid cursor")
+	ErrInvalidExclude     = fmt.Errorf("Too many excluded images")
 )
 
 const (
 	minBlurAmount = 1
 	maxBlurAmount = 10
-	maxImageSize  = 5000 // The max allowed image width/height that can be requested
+	maxImageSize  = 5000 // The max allowed image width/height that can be requested without an API key
+	maxExclude    = 100  // The max number of image IDs that can be excluded
 )
 
-func validateImageParams(p *params.Params) error {
-	if p.Width > maxImageSize {
+// validateImageParams validates the params against the limits of the API key, or the defaults if it's nil
+func validateImageParams(p *params.Params, key *apikey.Key) error {
+	if p.Width > getMaxImageSize(key) {
 		return params.ErrInvalidSize
 	}
 
-	if p.Height > maxImageSize {
+	if p.Height > getMaxImageSize(key) {
 		return params.ErrInvalidSize
 	}
 
@@ -35,7 +46,7 @@ func validateImageParams(p *params.Params) error {
 		return ErrInvalidBlurAmount
 	}
 
-	return nil
+	return validateFeatures(p, key)
 }
 
 func getImageDimensions(p *params.Params, databaseImage *database.Image) (width, height int) {
@@ -53,3 +64,70 @@ func getImageDimensions(p *params.Params, databaseImage *database.Image) (width,
 
 	return
 }
+
+// getFilter returns the filter for picking a random image, from the tag and author path parameters,
+// and the orientation and exclude query parameters
+func getFilter(r *http.Request) (database.Filter, error) {
+	orientation, err := getOrientation(r)
+	if err != nil {
+		return database.Filter{}, err
+	}
+
+	exclude, err := getExclude(r)
+	if err != nil {
+		return database.Filter{}, err
+	}
+
+	vars := mux.Vars(r)
+
+	return database.Filter{
+		Orientation: orientation,
+		Tag:         vars["tag"],
+		AuthorSlug:  vars["slug"],
+		Exclude:     exclude,
+	}, nil
+}
+
+// getExclude returns the image IDs to exclude from the exclude query parameter, e.g. ?exclude=1,5,42
+// The IDs are returned as a set, as they're checked against every image the random image is picked from
+func getExclude(r *http.Request) (database.IDSet, error) {
+	exclude := make(database.IDSet)
+	for _, value := range r.URL.Query()["exclude"] {
+		for _, id := range strings.Split(value, ",") {
+			if id = strings.TrimSpace(id); id == "" {
+				continue
+			}
+
+			exclude[id] = struct{}{}
+			if len(exclude) > maxExclude {
+				return nil, ErrInvalidExclude
+			}
+		}
+	}
+
+	return exclude, nil
+}
+
+// getOrientation returns the orientation given in the orientation query parameter, if any
+func getOrientation(r *http.Request) (database.Orientation, error) {
+	switch orientation := database.Orientation(r.URL.Query().Get("orientation")); orientation {
+	case "", database.Landscape, database.Portrait, database.Square:
+		return orientation, nil
+	default:
+		return "", ErrInvalidOrientation
+	}
+}
+
+// getQuerySize parses a width/height query parameter, returning 0 if it's not set
+func getQuerySize(value string) (int, error) {
+	if value == "" {
+		return 0, nil
+	}
+
+	size, err := strconv.Atoi(value)
+	if err != nil || size < 0 {
+		return 0, params.ErrInvalidSize
+	}
+
+	return size, nil
+}
@@ -0,0 +1,44 @@
+package api
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httputil"
+
+	"github.com/DMarby/picsum-photos/internal/handler"
+	"github.com/DMarby/picsum-photos/internal/logger"
+)
+
+// UnixSocketProxy returns a handler that proxies requests to the image service listening on a unix socket
+func UnixSocketProxy(socketPath string, log *logger.Logger) http.Handler {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = func(ctx context.Context, _, _ string) (net.Conn, error) {
+		var dialer net.Dialer
+		return dialer.DialContext(ctx, "unix", socketPath)
+	}
+
+	return &httputil.ReverseProxy{
+		Transport: transport,
+		Rewrite: func(r *httputil.ProxyRequest) {
+			r.Out.URL.Scheme = "http"
+			r.Out.URL.Host = "image-service"
+			r.Out.Host = "image-service"
+
+			// The CORS headers are already set by the api, don't let the image service set them again
+			r.Out.Header.Del("Origin")
+
+			// The API key was already checked by the api, and the image service mustn't receive it
+			r.Out.Header.Del("Authorization")
+		},
+		ModifyResponse: func(r *http.Response) error {
+			// The api sets the caching headers, as most image routes return a different image for every request
+			r.Header.Del("Cache-Control")
+			return nil
+		},
+		ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+			log.Errorw("error proxying image", handler.LogFields(r, "path", r.URL.Path, "error", err)...)
+			http.Error(w, "Something went wrong", http.StatusBadGateway)
+		},
+	}
+}
@@ -0,0 +1,135 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/DMarby/picsum-photos/internal/database"
+	"github.com/DMarby/picsum-photos/internal/handler"
+	"github.com/DMarby/picsum-photos/internal/params"
+	"github.com/twmb/murmur3"
+)
+
+const (
+	// Default number of random images to return
+	defaultCount = 1
+	// Max number of random images to return
+	maxCount = 100
+)
+
+// Returns a list of distinct random images, with signed image service URLs for the requested size
+func (a *API) randomHandler(w http.ResponseWriter, r *http.Request) *handler.Error {
+	p, err := getRandomParams(r)
+	if err != nil {
+		return errorCodes.BadRequest(err)
+	}
+
+	orientation, err := getOrientation(r)
+	if err != nil {
+		return errorCodes.BadRequest(err)
+	}
+
+	exclude, err := getExclude(r)
+	if err != nil {
+		return errorCodes.BadRequest(err)
+	}
+
+	query := r.URL.Query()
+	filter := database.Filter{
+		Orientation: orientation,
+		Tag:         query.Get("tag"),
+		AuthorSlug:  query.Get("author_slug"),
+		Exclude:     exclude,
+	}
+	count := getCount(r)
+
+	var databaseImages []database.Image
+	if seed, ok := query["seed"]; ok {
+		// Hash the seed using murmur3, like for the seed routes
+		databaseImages, err = a.Database.GetRandomSampleWithSeed(r.Context(), count, int64(murmur3.StringSum64(seed[0])), filter)
+	} else {
+		databaseImages, err = a.Database.GetRandomSample(r.Context(), count, filter)
+	}
+
+	if err != nil {
+		if err == database.ErrNotFound {
+			return errorCodes.NotFound(err)
+		}
+
+		a.logError(r, "error getting random images from database", err)
+		return handler.InternalServerError()
+	}
+
+	images := []ResolvedImage{}
+	for i := range databaseImages {
+		resolvedImage, handlerErr := a.resolveImage(r, p, &databaseImages[i])
+		if handlerErr != nil {
+			return handlerErr
+		}
+
+		images = append(images, *resolvedImage)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "private, no-cache, no-store, must-revalidate")
+
+	if err := json.NewEncoder(w).Encode(images); err != nil {
+		a.logError(r, "error encoding random images", err)
+		return handler.InternalServerError()
+	}
+
+	return nil
+}
+
+// getRandomParams returns the image params from the width, height, format, grayscale and blur query parameters
+// A missing width or height defaults to the size of each image
+func getRandomParams(r *http.Request) (*params.Params, error) {
+	query := r.URL.Query()
+
+	width, err := getQuerySize(query.Get("width"))
+	if err != nil {
+		return nil, err
+	}
+
+	height, err := getQuerySize(query.Get("height"))
+	if err != nil {
+		return nil, err
+	}
+
+	var extension string
+	switch query.Get("format") {
+	case "", "jpg":
+		extension = ".jpg"
+	case "webp":
+		extension = ".webp"
+	case "avif":
+		extension = ".avif"
+	default:
+		return nil, params.ErrInvalidFileExtension
+	}
+
+	grayscale, blur, blurAmount := params.GetQueryParams(r)
+
+	return &params.Params{
+		Width:      width,
+		Height:     height,
+		Blur:       blur,
+		BlurAmount: blurAmount,
+		Grayscale:  grayscale,
+		Extension:  extension,
+	}, nil
+}
+
+func getCount(r *http.Request) int {
+	count, err := strconv.Atoi(r.URL.Query().Get("count"))
+	if err != nil || count < 1 {
+		count = defaultCount
+	}
+
+	if count > maxCount {
+		count = maxCount
+	}
+
+	return count
+}
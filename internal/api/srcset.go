@@ -0,0 +1,196 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"html"
+	"math"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/DMarby/picsum-photos/internal/apikey"
+	"github.com/DMarby/picsum-photos/internal/database"
+	"github.com/DMarby/picsum-photos/internal/handler"
+	"github.com/DMarby/picsum-photos/internal/params"
+	"github.com/gorilla/mux"
+)
+
+const (
+	// Max number of widths in a srcset
+	maxSrcsetWidths = 10
+	// Default sizes attribute for the <img> tag
+	defaultSrcsetSizes = "100vw"
+)
+
+// Default widths in a srcset
+var defaultSrcsetWidths = []int{320, 640, 1280}
+
+// srcsetFormats are the formats in a srcset, in order of preference
+// The formats that need a feature are left out for API keys that aren't allowed to use it, JPEG is always included
+var srcsetFormats = []struct {
+	extension   string
+	contentType string
+	feature     apikey.Feature
+}{
+	{".avif", "image/avif", apikey.AVIF},
+	{".webp", "image/webp", apikey.WebP},
+	{".jpg", "image/jpeg", ""},
+}
+
+// ErrTooManyWidths is returned when a srcset is requested for too many widths
+var ErrTooManyWidths = fmt.Errorf("Too many widths")
+
+// Srcset contains the signed image service URLs of an image for a set of widths and formats, and a <picture> tag using them
+type Srcset struct {
+	Image   ListImage      `json:"image"`
+	Sources []SrcsetSource `json:"sources"`
+	HTML    string         `json:"html"`
+}
+
+// SrcsetSource contains the images of a srcset for a format
+type SrcsetSource struct {
+	Type   string        `json:"type"`
+	Srcset string        `json:"srcset"`
+	Images []SrcsetImage `json:"images"`
+}
+
+// SrcsetImage is an image in a srcset
+type SrcsetImage struct {
+	Width  int    `json:"width"`
+	Height int    `json:"height"`
+	URL    string `json:"url"`
+}
+
+// Returns a srcset for an image, with the `widths`, `ratio` and `sizes` query parameters
+func (a *API) srcsetHandler(w http.ResponseWriter, r *http.Request) *handler.Error {
+	widths, err := getSrcsetWidths(r)
+	if err != nil {
+		return errorCodes.BadRequest(err)
+	}
+
+	var ratio float64
+	if value := r.URL.Query().Get("ratio"); value != "" {
+		if ratio, err = params.ParseRatio(value); err != nil {
+			return errorCodes.BadRequest(err)
+		}
+	}
+
+	sizes := r.URL.Query().Get("sizes")
+	if sizes == "" {
+		sizes = defaultSrcsetSizes
+	}
+
+	vars := mux.Vars(r)
+	image, handlerErr := a.getImage(r, vars["id"])
+	if handlerErr != nil {
+		return handlerErr
+	}
+
+	grayscale, blur, blurAmount := params.GetQueryParams(r)
+
+	srcset := Srcset{
+		Image:   a.getListImage(*image),
+		Sources: []SrcsetSource{},
+	}
+
+	key := getAPIKey(r)
+	for _, format := range srcsetFormats {
+		if format.feature != "" && key != nil && !key.Allows(format.feature) {
+			continue
+		}
+
+		source := SrcsetSource{Type: format.contentType}
+		var candidates []string
+
+		for _, width := range widths {
+			p := &params.Params{
+				Width:      width,
+				Height:     getSrcsetHeight(image, width, ratio),
+				Blur:       blur,
+				BlurAmount: blurAmount,
+				Grayscale:  grayscale,
+				Extension:  format.extension,
+			}
+
+			resolvedImage, handlerErr := a.resolveImage(r, p, image)
+			if handlerErr != nil {
+				return handlerErr
+			}
+
+			source.Images = append(source.Images, SrcsetImage{Width: resolvedImage.Width, Height: resolvedImage.Height, URL: resolvedImage.URL})
+			candidates = append(candidates, fmt.Sprintf("%s %dw", resolvedImage.URL, resolvedImage.Width))
+		}
+
+		source.Srcset = strings.Join(candidates, ", ")
+		srcset.Sources = append(srcset.Sources, source)
+	}
+
+	srcset.HTML = getPictureHTML(image, srcset.Sources, sizes)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "private, no-cache, no-store, must-revalidate")
+
+	if err := json.NewEncoder(w).Encode(srcset); err != nil {
+		a.logError(r, "error encoding srcset", err)
+		return handler.InternalServerError()
+	}
+
+	return nil
+}
+
+// getSrcsetWidths returns the sorted and deduplicated comma separated widths from the `widths` query parameter
+func getSrcsetWidths(r *http.Request) ([]int, error) {
+	value := r.URL.Query().Get("widths")
+	if value == "" {
+		return defaultSrcsetWidths, nil
+	}
+
+	var widths []int
+	for _, widthValue := range strings.Split(value, ",") {
+		width, err := strconv.Atoi(strings.TrimSpace(widthValue))
+		if err != nil || width < 1 {
+			return nil, params.ErrInvalidSize
+		}
+
+		widths = append(widths, width)
+	}
+
+	slices.Sort(widths)
+	widths = slices.Compact(widths)
+
+	if len(widths) > maxSrcsetWidths {
+		return nil, ErrTooManyWidths
+	}
+
+	return widths, nil
+}
+
+// getSrcsetHeight returns the height for a width in a srcset, using the ratio if given, or the aspect ratio of the image
+func getSrcsetHeight(image *database.Image, width int, ratio float64) int {
+	if ratio == 0 {
+		ratio = float64(image.Width) / float64(image.Height)
+	}
+
+	return max(int(math.Round(float64(width)/ratio)), 1)
+}
+
+// getPictureHTML returns a <picture> tag for the sources, using the last source as the fallback <img> tag
+func getPictureHTML(image *database.Image, sources []SrcsetSource, sizes string) string {
+	var builder strings.Builder
+	builder.WriteString("<picture>")
+
+	for _, source := range sources[:len(sources)-1] {
+		fmt.Fprintf(&builder, `<source type="%s" srcset="%s" sizes="%s">`, source.Type, html.EscapeString(source.Srcset), html.EscapeString(sizes))
+	}
+
+	fallback := sources[len(sources)-1]
+	largest := fallback.Images[len(fallback.Images)-1]
+	fmt.Fprintf(&builder, `<img src="%s" srcset="%s" sizes="%s" width="%d" height="%d" alt="%s" loading="lazy">`,
+		html.EscapeString(largest.URL), html.EscapeString(fallback.Srcset), html.EscapeString(sizes), largest.Width, largest.Height, html.EscapeString("Photo by "+image.Author))
+
+	builder.WriteString("</picture>")
+
+	return builder.String()
+}
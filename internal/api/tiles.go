@@ -0,0 +1,73 @@
+package api
+
+import (
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/DMarby/picsum-photos/internal/dzi"
+	"github.com/DMarby/picsum-photos/internal/handler"
+	"github.com/gorilla/mux"
+)
+
+// Returns the Deep Zoom descriptor of an image
+func (a *API) dziHandler(w http.ResponseWriter, r *http.Request) *handler.Error {
+	vars := mux.Vars(r)
+	image, handlerErr := a.getImage(r, vars["id"])
+	if handlerErr != nil {
+		return handlerErr
+	}
+
+	descriptor := dzi.NewDescriptor(fmt.Sprintf("%s/id/%s/tiles/", a.RootURL, url.PathEscape(image.ID)), image.Width, image.Height)
+
+	data, err := xml.Marshal(descriptor)
+	if err != nil {
+		a.logError(r, "error encoding deep zoom descriptor", err)
+		return handler.InternalServerError()
+	}
+	data = append([]byte(xml.Header), append(data, '\n')...)
+
+	return a.writeVersioned(w, r, data, "application/xml", a.metadataCacheControl())
+}
+
+// Redirects to the signed image service URL of a tile of an image
+func (a *API) tileHandler(w http.ResponseWriter, r *http.Request) *handler.Error {
+	vars := mux.Vars(r)
+	image, handlerErr := a.getImage(r, vars["id"])
+	if handlerErr != nil {
+		return handlerErr
+	}
+
+	var tile [3]int
+	for i, name := range []string{"level", "col", "row"} {
+		value, err := strconv.Atoi(vars[name])
+		if err != nil {
+			return errorCodes.NotFound(dzi.ErrTileNotFound)
+		}
+
+		tile[i] = value
+	}
+
+	_, tileWidth, tileHeight, err := dzi.Tile(image.Width, image.Height, tile[0], tile[1], tile[2])
+	if err != nil {
+		return errorCodes.NotFound(err)
+	}
+
+	// The image service crops the tile from the original using the size of the image
+	path := fmt.Sprintf("/id/%s/tiles/%d/%d/%d/%d_%d.jpg", image.ID, image.Width, image.Height, tile[0], tile[1], tile[2])
+	signedPath, expires, err := a.signURL(path, url.Values{})
+	if err != nil {
+		return handler.InternalServerError()
+	}
+
+	return a.writeResolvedImage(w, r, &ResolvedImage{
+		Image:   a.getListImage(*image),
+		Width:   tileWidth,
+		Height:  tileHeight,
+		URL:     fmt.Sprintf("%s%s", a.ImageServiceURL, signedPath),
+		Expires: expires,
+		path:    signedPath,
+	})
+}
@@ -0,0 +1,154 @@
+package apikey
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/DMarby/picsum-photos/internal/handler"
+)
+
+// Feature is an image feature that a key can be allowed to use
+type Feature string
+
+// Features
+const (
+	Blur      Feature = "blur"
+	Grayscale Feature = "grayscale"
+	WebP      Feature = "webp"
+	AVIF      Feature = "avif"
+)
+
+// Limit is a rate limit of requests per second, allowing bursts of Burst requests
+type Limit struct {
+	Rate  float64 `json:"rate"`
+	Burst int     `json:"burst"`
+}
+
+// Key is an API key, with its own limits
+type Key struct {
+	// Name identifies the key in the metrics, and isn't secret
+	Name string `json:"name"`
+	// Key is the secret that clients authenticate with
+	Key        string `json:"key"`
+	RateLimits struct {
+		// Redirects is the rate limit of routes that redirect or return metadata, or nil to not limit them
+		Redirects *Limit `json:"redirects,omitempty"`
+		// Images is the rate limit of routes that process images, or nil to not limit them
+		Images *Limit `json:"images,omitempty"`
+	} `json:"rate_limits"`
+	// MaxImageSize is the max width/height of the images the key can request, or zero for the default
+	MaxImageSize int `json:"max_image_size,omitempty"`
+	// Features are the image features the key can use, or empty to allow all of them
+	Features []Feature `json:"features,omitempty"`
+
+	redirects *handler.Budget
+	images    *handler.Budget
+}
+
+// Budgets returns the rate limit budgets of the key, shared by all of its clients
+func (k *Key) Budgets() (redirects, images *handler.Budget) {
+	return k.redirects, k.images
+}
+
+// budget returns the shared budget of the limit, or nil to not limit the requests
+func (k *Key) budget(name string, limit *Limit) *handler.Budget {
+	if limit == nil {
+		return nil
+	}
+
+	budget := handler.NewBudget(fmt.Sprintf("%s:%s", name, k.Name), limit.Rate, limit.Burst)
+	if budget != nil {
+		budget.Shared = true
+	}
+
+	return budget
+}
+
+// Allows returns whether the key can use the feature
+func (k *Key) Allows(feature Feature) bool {
+	if len(k.Features) == 0 {
+		return true
+	}
+
+	for _, f := range k.Features {
+		if f == feature {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Keys are the API keys from a key file
+type Keys struct {
+	// The keys by the hash of their secret, so that looking them up doesn't leak the secrets through timing
+	keys map[[sha256.Size]byte]*Key
+}
+
+// Load reads the keys from a JSON key file, containing a list of keys
+func Load(path string) (*Keys, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var keys []*Key
+	if err := json.Unmarshal(data, &keys); err != nil {
+		return nil, err
+	}
+
+	return New(keys)
+}
+
+// New returns the keys, validating that they have unique names and secrets
+func New(keys []*Key) (*Keys, error) {
+	k := &Keys{keys: map[[sha256.Size]byte]*Key{}}
+	names := map[string]bool{}
+
+	for i, key := range keys {
+		if key.Name == "" {
+			return nil, fmt.Errorf("key %d has no name", i)
+		}
+
+		if names[key.Name] {
+			return nil, fmt.Errorf("duplicate key name %s", key.Name)
+		}
+		names[key.Name] = true
+
+		if key.Key == "" {
+			return nil, fmt.Errorf("key %s has no secret", key.Name)
+		}
+
+		hash := sha256.Sum256([]byte(key.Key))
+		if _, ok := k.keys[hash]; ok {
+			return nil, fmt.Errorf("key %s has the same secret as another key", key.Name)
+		}
+
+		if key.MaxImageSize < 0 {
+			return nil, fmt.Errorf("key %s has an invalid max image size", key.Name)
+		}
+
+		for _, feature := range key.Features {
+			switch feature {
+			case Blur, Grayscale, WebP, AVIF:
+			default:
+				return nil, fmt.Errorf("key %s has an unknown feature %s", key.Name, feature)
+			}
+		}
+
+		key.redirects = key.budget("redirects", key.RateLimits.Redirects)
+		key.images = key.budget("images", key.RateLimits.Images)
+
+		k.keys[hash] = key
+	}
+
+	return k, nil
+}
+
+// Get returns the key with the secret
+func (k *Keys) Get(secret string) (*Key, bool) {
+	key, ok := k.keys[sha256.Sum256([]byte(secret))]
+	return key, ok
+}
@@ -0,0 +1,68 @@
+package apikey_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/DMarby/picsum-photos/internal/apikey"
+)
+
+func TestLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keys.json")
+	data := `[
+		{"name": "partner", "key": "partner-secret", "rate_limits": {"images": {"rate": 10, "burst": 50}}, "max_image_size": 8000, "features": ["grayscale"]},
+		{"name": "basic", "key": "basic-secret"}
+	]`
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	keys, err := apikey.Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	partner, ok := keys.Get("partner-secret")
+	if !ok || partner.Name != "partner" || partner.MaxImageSize != 8000 {
+		t.Fatalf("wrong key %#v", partner)
+	}
+
+	if !partner.Allows(apikey.Grayscale) || partner.Allows(apikey.Blur) {
+		t.Error("wrong partner features")
+	}
+
+	redirects, images := partner.Budgets()
+	if redirects != nil || images == nil || images.Name != "images:partner" || images.Rate != 10 || images.Burst != 50 || !images.Shared {
+		t.Errorf("wrong partner budgets %#v %#v", redirects, images)
+	}
+
+	basic, ok := keys.Get("basic-secret")
+	if !ok || !basic.Allows(apikey.Blur) || !basic.Allows(apikey.WebP) {
+		t.Errorf("wrong basic key %#v", basic)
+	}
+
+	if _, ok := keys.Get("partner"); ok {
+		t.Error("expected no key for a name")
+	}
+}
+
+func TestNewErrors(t *testing.T) {
+	tests := []struct {
+		Name string
+		Keys []*apikey.Key
+	}{
+		{"no name", []*apikey.Key{{Key: "secret"}}},
+		{"no secret", []*apikey.Key{{Name: "partner"}}},
+		{"duplicate name", []*apikey.Key{{Name: "partner", Key: "a"}, {Name: "partner", Key: "b"}}},
+		{"duplicate secret", []*apikey.Key{{Name: "a", Key: "secret"}, {Name: "b", Key: "secret"}}},
+		{"invalid max image size", []*apikey.Key{{Name: "partner", Key: "secret", MaxImageSize: -1}}},
+		{"unknown feature", []*apikey.Key{{Name: "partner", Key: "secret", Features: []apikey.Feature{"sepia"}}}},
+	}
+
+	for _, test := range tests {
+		if _, err := apikey.New(test.Keys); err == nil {
+			t.Errorf("%s: expected an error", test.Name)
+		}
+	}
+}
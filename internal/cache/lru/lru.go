@@ -0,0 +1,81 @@
+package lru
+
+import (
+	"container/list"
+	"context"
+	"sync"
+
+	"github.com/DMarby/picsum-photos/internal/cache"
+)
+
+// Provider implements an in-memory cache limited to a max size in bytes, evicting the least recently used objects
+type Provider struct {
+	maxBytes int64
+	bytes    int64
+	entries  *list.List
+	items    map[string]*list.Element
+	mutex    sync.Mutex
+}
+
+type entry struct {
+	key  string
+	data []byte
+}
+
+// New returns a new Provider instance, caching up to maxBytes of data
+func New(maxBytes int64) *Provider {
+	return &Provider{
+		maxBytes: maxBytes,
+		entries:  list.New(),
+		items:    make(map[string]*list.Element),
+	}
+}
+
+// Get returns an object from the cache if it exists
+func (p *Provider) Get(ctx context.Context, key string) (data []byte, err error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	element, exists := p.items[key]
+	if !exists {
+		return nil, cache.ErrNotFound
+	}
+
+	p.entries.MoveToFront(element)
+	return element.Value.(*entry).data, nil
+}
+
+// Set adds an object to the cache, evicting the least recently used objects to stay within the max size
+// Objects larger than the max size aren't cached
+func (p *Provider) Set(ctx context.Context, key string, data []byte) (err error) {
+	size := int64(len(data))
+	if size > p.maxBytes {
+		return nil
+	}
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if element, exists := p.items[key]; exists {
+		p.remove(element)
+	}
+
+	for p.bytes+size > p.maxBytes {
+		p.remove(p.entries.Back())
+	}
+
+	p.items[key] = p.entries.PushFront(&entry{key: key, data: data})
+	p.bytes += size
+
+	return nil
+}
+
+// remove removes an element from the cache
+func (p *Provider) remove(element *list.Element) {
+	entry := p.entries.Remove(element).(*entry)
+	delete(p.items, entry.key)
+	p.bytes -= int64(len(entry.data))
+}
+
+// Shutdown shuts down the cache
+func (p *Provider) Shutdown() {}
@@ -0,0 +1,86 @@
+package lru_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/DMarby/picsum-photos/internal/cache"
+	"github.com/DMarby/picsum-photos/internal/cache/lru"
+)
+
+func TestLRU(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	t.Run("get item", func(t *testing.T) {
+		provider := lru.New(10)
+		provider.Set(ctx, "foo", []byte("bar"))
+
+		data, err := provider.Get(ctx, "foo")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if string(data) != "bar" {
+			t.Fatal("wrong data")
+		}
+	})
+
+	t.Run("get nonexistant item", func(t *testing.T) {
+		provider := lru.New(10)
+		_, err := provider.Get(ctx, "notfound")
+		if err != cache.ErrNotFound {
+			t.Fatalf("wrong error %s", err)
+		}
+	})
+
+	t.Run("evicts the least recently used items", func(t *testing.T) {
+		provider := lru.New(10)
+		provider.Set(ctx, "a", []byte("aaaa"))
+		provider.Set(ctx, "b", []byte("bbbb"))
+
+		// Using a makes b the least recently used item
+		provider.Get(ctx, "a")
+		provider.Set(ctx, "c", []byte("cccc"))
+
+		if _, err := provider.Get(ctx, "b"); err != cache.ErrNotFound {
+			t.Errorf("b not evicted %s", err)
+		}
+
+		for _, key := range []string{"a", "c"} {
+			if _, err := provider.Get(ctx, key); err != nil {
+				t.Errorf("%s evicted %s", key, err)
+			}
+		}
+	})
+
+	t.Run("replaces items", func(t *testing.T) {
+		provider := lru.New(10)
+		provider.Set(ctx, "a", []byte("aaaa"))
+		provider.Set(ctx, "a", []byte("aaaaaaaa"))
+		provider.Set(ctx, "b", []byte("bb"))
+
+		data, err := provider.Get(ctx, "a")
+		if err != nil || string(data) != "aaaaaaaa" {
+			t.Errorf("wrong data %s %s", data, err)
+		}
+
+		if _, err := provider.Get(ctx, "b"); err != nil {
+			t.Errorf("b not cached %s", err)
+		}
+	})
+
+	t.Run("doesn't cache items larger than the max size", func(t *testing.T) {
+		provider := lru.New(10)
+		provider.Set(ctx, "a", []byte("aaaa"))
+		provider.Set(ctx, "large", []byte("larger than the max size"))
+
+		if _, err := provider.Get(ctx, "large"); err != cache.ErrNotFound {
+			t.Errorf("large item cached %s", err)
+		}
+
+		if _, err := provider.Get(ctx, "a"); err != nil {
+			t.Errorf("a evicted %s", err)
+		}
+	})
+}
@@ -3,15 +3,205 @@ package database
 import (
 	"context"
 	"errors"
+	"math"
+	"strings"
+	"time"
+	"unicode"
 )
 
 // Image contains metadata about an image
 type Image struct {
+	ID          string     `json:"id"`
+	Author      string     `json:"author"`
+	AuthorURL   string     `json:"author_url,omitempty"`
+	Width       int        `json:"width"`
+	Height      int        `json:"height"`
+	URL         string     `json:"url"`
+	Tags        []string   `json:"tags,omitempty"`
+	Title       string     `json:"title,omitempty"`
+	Description string     `json:"description,omitempty"`
+	License     string     `json:"license,omitempty"`
+	SourceURL   string     `json:"source_url,omitempty"` // Where the original image was downloaded from
+	CameraModel string     `json:"camera_model,omitempty"`
+	FocalLength float64    `json:"focal_length,omitempty"` // In millimeters
+	CapturedAt  *time.Time `json:"captured_at,omitempty"`
+}
+
+// HasTag returns whether the image has the given tag, ignoring case
+func (i *Image) HasTag(tag string) bool {
+	for _, t := range i.Tags {
+		if strings.EqualFold(t, tag) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Tag contains the name of a tag and how many images have it
+type Tag struct {
+	Name  string `json:"name"`
+	Count int    `json:"count"`
+}
+
+// Author contains information about an author and how many images they have
+type Author struct {
+	Name  string `json:"name"`
+	Slug  string `json:"slug"`
+	URL   string `json:"url,omitempty"`
+	Count int    `json:"count"`
+}
+
+// Slug returns a URL friendly version of a name, e.g. "Alejandro Escamilla" becomes "alejandro-escamilla"
+func Slug(name string) string {
+	var buf strings.Builder
+	separator := false
+
+	for _, r := range strings.ToLower(name) {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			separator = true
+			continue
+		}
+
+		if separator && buf.Len() > 0 {
+			buf.WriteByte('-')
+		}
+
+		separator = false
+		buf.WriteRune(r)
+	}
+
+	return buf.String()
+}
+
+// Orientation is the orientation of an image
+type Orientation string
+
+// Orientations
+const (
+	Landscape Orientation = "landscape"
+	Portrait  Orientation = "portrait"
+	Square    Orientation = "square"
+)
+
+// squareTolerance is how much the width and height can differ, relative to the largest side, to still be considered square
+const squareTolerance = 0.05
+
+// GetOrientation returns the orientation of the given dimensions
+func GetOrientation(width, height int) Orientation {
+	difference := math.Abs(float64(width-height)) / math.Max(float64(width), float64(height))
+
+	switch {
+	case difference <= squareTolerance:
+		return Square
+	case width > height:
+		return Landscape
+	default:
+		return Portrait
+	}
+}
+
+// Filter restricts which images can be picked or listed
+// The zero value matches all images
+type Filter struct {
+	Orientation Orientation
+	Tag         string
+	Author      string
+	AuthorSlug  string
+	MinWidth    int
+	MinHeight   int
+	Exclude     IDSet // IDs of images to exclude
+}
+
+// IDSet is a set of image IDs
+type IDSet map[string]struct{}
+
+// NewIDSet returns a set of the given image IDs
+func NewIDSet(ids ...string) IDSet {
+	set := make(IDSet, len(ids))
+	for _, id := range ids {
+		set[id] = struct{}{}
+	}
+
+	return set
+}
+
+// Contains returns whether the set contains the image ID
+func (s IDSet) Contains(id string) bool {
+	_, ok := s[id]
+	return ok
+}
+
+// IsZero returns whether the filter is the zero value, and matches all images
+func (f Filter) IsZero() bool {
+	return f.Orientation == "" && f.Tag == "" && f.Author == "" && f.AuthorSlug == "" &&
+		f.MinWidth == 0 && f.MinHeight == 0 && len(f.Exclude) == 0
+}
+
+// Matches returns whether the image matches the filter
+func (f Filter) Matches(image *Image) bool {
+	if f.Orientation != "" && GetOrientation(image.Width, image.Height) != f.Orientation {
+		return false
+	}
+
+	if f.Tag != "" && !image.HasTag(f.Tag) {
+		return false
+	}
+
+	if f.Author != "" && !strings.EqualFold(image.Author, f.Author) {
+		return false
+	}
+
+	if f.AuthorSlug != "" && Slug(image.Author) != f.AuthorSlug {
+		return false
+	}
+
+	if image.Width < f.MinWidth || image.Height < f.MinHeight {
+		return false
+	}
+
+	if f.Exclude.Contains(image.ID) {
+		return false
+	}
+
+	return true
+}
+
+// Sort is the order to list images in
+type Sort string
+
+// Sort orders
+const (
+	SortByID      Sort = "id"
+	SortByAuthor  Sort = "author"
+	SortByWidth   Sort = "width"
+	SortByShuffle Sort = "shuffle"
+)
+
+// ListOptions contains the filter and sort order to use when listing images
+// The zero value lists all images sorted by ID
+type ListOptions struct {
+	Filter Filter
+	Sort   Sort
+	Seed   int64   // The seed to shuffle the images with when using SortByShuffle
+	After  *Cursor // Only list the images after the cursor, instead of using an offset
+}
+
+// Cursor is a position in a sorted list of images
+// It contains the sort keys of the image rather than its index, so that it stays valid when images are added or removed
+type Cursor struct {
 	ID     string `json:"id"`
 	Author string `json:"author"`
 	Width  int    `json:"width"`
-	Height int    `json:"height"`
-	URL    string `json:"url"`
+}
+
+// NewCursor returns a cursor pointing at the given image
+func NewCursor(image Image) *Cursor {
+	return &Cursor{
+		ID:     image.ID,
+		Author: image.Author,
+		Width:  image.Width,
+	}
 }
 
 // Provider is an interface for listing and retrieving images
@@ -19,11 +209,22 @@ type Provider interface {
 	Get(ctx context.Context, id string) (i *Image, err error)
 	GetRandom(ctx context.Context) (i *Image, err error)
 	GetRandomWithSeed(ctx context.Context, seed int64) (i *Image, err error)
+	GetRandomWithRatio(ctx context.Context, ratio float64, filter Filter) (i *Image, err error)
+	GetRandomFiltered(ctx context.Context, filter Filter) (i *Image, err error)
+	GetRandomWithSeedFiltered(ctx context.Context, seed int64, filter Filter) (i *Image, err error)
+	GetRandomSample(ctx context.Context, count int, filter Filter) ([]Image, error)
+	GetRandomSampleWithSeed(ctx context.Context, count int, seed int64, filter Filter) ([]Image, error)
 	ListAll(ctx context.Context) ([]Image, error)
-	List(ctx context.Context, offset, limit int) ([]Image, error)
+	List(ctx context.Context, options ListOptions, offset, limit int) ([]Image, error)
+	Count(ctx context.Context, options ListOptions) (int, error)
+	ListTags(ctx context.Context) ([]Tag, error)
+	ListAuthors(ctx context.Context) ([]Author, error)
+	GetAuthor(ctx context.Context, slug string) (*Author, error)
+	Version(ctx context.Context) (string, error)
 }
 
 // Errors
 var (
-	ErrNotFound = errors.New("Image does not exist")
+	ErrNotFound       = errors.New("Image does not exist")
+	ErrAuthorNotFound = errors.New("Author does not exist")
 )
@@ -1,23 +1,42 @@
 package file
 
 import (
+	"cmp"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"math"
 	"math/rand"
 	"os"
+	"slices"
 	"sort"
 	"strconv"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/DMarby/picsum-photos/internal/database"
+	"github.com/twmb/murmur3"
 )
 
+// ratioTolerance is how much further from the requested aspect ratio than the closest match an image can be, and still be picked
+const ratioTolerance = 0.05
+
 // Provider implements a file-based image storage
 type Provider struct {
 	images       []database.Image
 	sortedImages []database.Image
 
+	// Indexes for picking random images without scanning all of them, in the order of images so that seeded selection is deterministic
+	all           []*database.Image
+	byOrientation map[database.Orientation][]*database.Image
+	byTag         map[string][]*database.Image
+
+	tags    []database.Tag
+	authors []database.Author
+	version string
+
 	random *rand.Rand
 	mu     sync.Mutex
 }
@@ -46,13 +65,108 @@ func New(path string) (*Provider, error) {
 	source := rand.NewSource(time.Now().UnixNano())
 	random := rand.New(source)
 
+	all, byOrientation, byTag := index(images)
+
 	return &Provider{
-		images:       images,
-		sortedImages: sortedImages,
-		random:       random,
+		images:        images,
+		sortedImages:  sortedImages,
+		all:           all,
+		byOrientation: byOrientation,
+		byTag:         byTag,
+		tags:          countTags(images),
+		authors:       countAuthors(sortedImages),
+		version:       getVersion(data),
+		random:        random,
 	}, nil
 }
 
+// index returns all the images, and the images by orientation and by lowercase tag
+func index(images []database.Image) (all []*database.Image, byOrientation map[database.Orientation][]*database.Image, byTag map[string][]*database.Image) {
+	all = make([]*database.Image, len(images))
+	byOrientation = make(map[database.Orientation][]*database.Image)
+	byTag = make(map[string][]*database.Image)
+
+	for i := range images {
+		image := &images[i]
+		all[i] = image
+
+		orientation := database.GetOrientation(image.Width, image.Height)
+		byOrientation[orientation] = append(byOrientation[orientation], image)
+
+		tags := make(map[string]bool)
+		for _, tag := range image.Tags {
+			tag = strings.ToLower(tag)
+			if !tags[tag] {
+				tags[tag] = true
+				byTag[tag] = append(byTag[tag], image)
+			}
+		}
+	}
+
+	return all, byOrientation, byTag
+}
+
+// getVersion returns the version of the catalogue, as a hash of the database file
+func getVersion(data []byte) string {
+	hash := sha256.Sum256(data)
+	return hex.EncodeToString(hash[:8])
+}
+
+// countTags returns all the tags used by the images, sorted by name
+func countTags(images []database.Image) []database.Tag {
+	counts := make(map[string]int)
+	for _, image := range images {
+		// Count each image once per tag, regardless of case, the same way index does
+		seen := make(map[string]bool)
+		for _, tag := range image.Tags {
+			tag = strings.ToLower(tag)
+			if !seen[tag] {
+				seen[tag] = true
+				counts[tag]++
+			}
+		}
+	}
+
+	tags := make([]database.Tag, 0, len(counts))
+	for name, count := range counts {
+		tags = append(tags, database.Tag{Name: name, Count: count})
+	}
+
+	sort.Slice(tags, func(i, j int) bool {
+		return tags[i].Name < tags[j].Name
+	})
+
+	return tags
+}
+
+// countAuthors returns all the authors of the images, sorted by name
+func countAuthors(images []database.Image) []database.Author {
+	authors := []database.Author{}
+	indexes := make(map[string]int)
+
+	for _, image := range images {
+		slug := database.Slug(image.Author)
+
+		i, ok := indexes[slug]
+		if !ok {
+			i = len(authors)
+			indexes[slug] = i
+			authors = append(authors, database.Author{Name: image.Author, Slug: slug})
+		}
+
+		authors[i].Count++
+		if authors[i].URL == "" {
+			authors[i].URL = image.AuthorURL
+		}
+	}
+
+	sort.Slice(authors, func(i, j int) bool {
+		return authors[i].Name < authors[j].Name
+	})
+
+	return authors
+}
+
 func (p *Provider) getImage(id string) (*database.Image, error) {
 	for _, image := range p.images {
 		if image.ID == id {
@@ -89,14 +203,148 @@ func (p *Provider) GetRandomWithSeed(ctx context.Context, seed int64) (i *databa
 	return &p.images[random.Intn(len(p.images))], nil
 }
 
+// GetRandomWithRatio returns a random image matching the filter, preferring the images with an aspect ratio closest to the given one
+func (p *Provider) GetRandomWithRatio(ctx context.Context, ratio float64, filter database.Filter) (i *database.Image, err error) {
+	images := p.filter(filter)
+	if len(images) == 0 {
+		return nil, database.ErrNotFound
+	}
+
+	closest := math.Inf(1)
+	for _, image := range images {
+		closest = math.Min(closest, ratioDistance(image, ratio))
+	}
+
+	var candidates []*database.Image
+	for _, image := range images {
+		if ratioDistance(image, ratio) <= closest+ratioTolerance {
+			candidates = append(candidates, image)
+		}
+	}
+
+	p.mu.Lock()
+	image := candidates[p.random.Intn(len(candidates))]
+	p.mu.Unlock()
+	return image, nil
+}
+
+// GetRandomFiltered returns a random image matching the filter
+func (p *Provider) GetRandomFiltered(ctx context.Context, filter database.Filter) (i *database.Image, err error) {
+	images := p.filter(filter)
+	if len(images) == 0 {
+		return nil, database.ErrNotFound
+	}
+
+	p.mu.Lock()
+	image := images[p.random.Intn(len(images))]
+	p.mu.Unlock()
+	return image, nil
+}
+
+// GetRandomWithSeedFiltered returns a random image matching the filter based on the given seed
+func (p *Provider) GetRandomWithSeedFiltered(ctx context.Context, seed int64, filter database.Filter) (i *database.Image, err error) {
+	images := p.filter(filter)
+	if len(images) == 0 {
+		return nil, database.ErrNotFound
+	}
+
+	source := rand.NewSource(seed)
+	random := rand.New(source)
+
+	return images[random.Intn(len(images))], nil
+}
+
+// GetRandomSample returns count distinct random images matching the filter
+// If fewer than count images match the filter, all of them are returned in a random order
+func (p *Provider) GetRandomSample(ctx context.Context, count int, filter database.Filter) ([]database.Image, error) {
+	images := p.filter(filter)
+	if len(images) == 0 {
+		return nil, database.ErrNotFound
+	}
+
+	p.mu.Lock()
+	result := sample(p.random, images, count)
+	p.mu.Unlock()
+	return result, nil
+}
+
+// GetRandomSampleWithSeed returns count distinct random images matching the filter based on the given seed
+func (p *Provider) GetRandomSampleWithSeed(ctx context.Context, count int, seed int64, filter database.Filter) ([]database.Image, error) {
+	images := p.filter(filter)
+	if len(images) == 0 {
+		return nil, database.ErrNotFound
+	}
+
+	source := rand.NewSource(seed)
+	random := rand.New(source)
+
+	return sample(random, images, count), nil
+}
+
+// sample picks count distinct images using a partial Fisher-Yates shuffle, on a copy of the images as they can be an index
+func sample(random *rand.Rand, images []*database.Image, count int) []database.Image {
+	if count > len(images) {
+		count = len(images)
+	}
+
+	images = slices.Clone(images)
+
+	result := make([]database.Image, count)
+	for i := 0; i < count; i++ {
+		j := i + random.Intn(len(images)-i)
+		images[i], images[j] = images[j], images[i]
+		result[i] = *images[i]
+	}
+
+	return result
+}
+
+// filter returns the images matching the filter, in a stable order so that seeded selection is deterministic
+// The images are picked from the index for the tag or orientation, and only scanned when the filter has other criteria,
+// so the returned slice can be an index and mustn't be modified
+func (p *Provider) filter(filter database.Filter) []*database.Image {
+	images, rest := p.all, filter
+	switch {
+	case filter.Tag != "":
+		images, rest.Tag = p.byTag[strings.ToLower(filter.Tag)], ""
+	case filter.Orientation != "":
+		images, rest.Orientation = p.byOrientation[filter.Orientation], ""
+	}
+
+	if rest.IsZero() {
+		return images
+	}
+
+	var matching []*database.Image
+	for _, image := range images {
+		if filter.Matches(image) {
+			matching = append(matching, image)
+		}
+	}
+
+	return matching
+}
+
+// ratioDistance returns how far the aspect ratio of an image is from the given ratio, on a logarithmic scale
+// so that e.g. 2:1 and 1:2 are equally far away from 1:1
+func ratioDistance(image *database.Image, ratio float64) float64 {
+	if image.Width < 1 || image.Height < 1 {
+		return math.Inf(1)
+	}
+
+	return math.Abs(math.Log(float64(image.Width)/float64(image.Height)) - math.Log(ratio))
+}
+
 // ListAll returns a list of all the images
 func (p *Provider) ListAll(ctx context.Context) ([]database.Image, error) {
 	return p.sortedImages, nil
 }
 
-// List returns a list of all the images with an offset/limit
-func (p *Provider) List(ctx context.Context, offset, limit int) ([]database.Image, error) {
-	images := len(p.sortedImages)
+// List returns a filtered and sorted list of the images with an offset/limit
+func (p *Provider) List(ctx context.Context, options database.ListOptions, offset, limit int) ([]database.Image, error) {
+	list := p.list(options)
+
+	images := len(list)
 	if offset > images {
 		offset = images
 	}
@@ -106,5 +354,98 @@ func (p *Provider) List(ctx context.Context, offset, limit int) ([]database.Imag
 		limit = images
 	}
 
-	return p.sortedImages[offset:limit], nil
+	return list[offset:limit], nil
+}
+
+// Count returns the number of images that would be listed
+func (p *Provider) Count(ctx context.Context, options database.ListOptions) (int, error) {
+	return len(p.list(options)), nil
+}
+
+// list returns all the images matching the filter, in the given sort order
+func (p *Provider) list(options database.ListOptions) []database.Image {
+	if options.Filter.IsZero() && options.Sort == "" && options.After == nil {
+		return p.sortedImages
+	}
+
+	var images []database.Image
+	for i := range p.sortedImages {
+		image := p.sortedImages[i]
+		if !options.Filter.Matches(&image) {
+			continue
+		}
+
+		if options.After != nil && compareCursors(database.NewCursor(image), options.After, options) <= 0 {
+			continue
+		}
+
+		images = append(images, image)
+	}
+
+	if options.Sort != "" && options.Sort != database.SortByID {
+		sort.Slice(images, func(i, j int) bool {
+			return compareCursors(database.NewCursor(images[i]), database.NewCursor(images[j]), options) < 0
+		})
+	}
+
+	return images
+}
+
+// compareCursors compares the position of two cursors in the sort order, breaking ties by ID
+func compareCursors(a, b *database.Cursor, options database.ListOptions) int {
+	var result int
+
+	switch options.Sort {
+	case database.SortByAuthor:
+		result = strings.Compare(a.Author, b.Author)
+	case database.SortByWidth:
+		result = cmp.Compare(a.Width, b.Width)
+	case database.SortByShuffle:
+		// Shuffle by hashing the IDs, so that the order of the remaining images doesn't change when images are added or removed
+		result = cmp.Compare(murmur3.SeedStringSum64(uint64(options.Seed), a.ID), murmur3.SeedStringSum64(uint64(options.Seed), b.ID))
+	}
+
+	if result != 0 {
+		return result
+	}
+
+	return compareIDs(a.ID, b.ID)
+}
+
+// compareIDs compares two image IDs numerically, falling back to comparing them as strings
+func compareIDs(a, b string) int {
+	aa, _ := strconv.Atoi(a)
+	bb, _ := strconv.Atoi(b)
+
+	if aa != bb {
+		return cmp.Compare(aa, bb)
+	}
+
+	return strings.Compare(a, b)
+}
+
+// ListTags returns a list of all the tags
+func (p *Provider) ListTags(ctx context.Context) ([]database.Tag, error) {
+	return p.tags, nil
+}
+
+// ListAuthors returns a list of all the authors
+func (p *Provider) ListAuthors(ctx context.Context) ([]database.Author, error) {
+	return p.authors, nil
+}
+
+// GetAuthor returns an author by slug
+func (p *Provider) GetAuthor(ctx context.Context, slug string) (*database.Author, error) {
+	for _, author := range p.authors {
+		if author.Slug == slug {
+			return &author, nil
+		}
+	}
+
+	return nil, database.ErrAuthorNotFound
+}
+
+// Version returns the version of the catalogue, which changes whenever the images change
+func (p *Provider) Version(ctx context.Context) (string, error) {
+	return p.version, nil
 }
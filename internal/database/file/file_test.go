@@ -87,7 +87,7 @@ func TestFile(t *testing.T) {
 	})
 
 	t.Run("Returns a list of images", func(t *testing.T) {
-		images, err := provider.List(ctx, 1, 1)
+		images, err := provider.List(ctx, database.ListOptions{}, 1, 1)
 		if err != nil {
 			t.Fatal(err)
 		}
@@ -98,13 +98,475 @@ func TestFile(t *testing.T) {
 	})
 
 	t.Run("Handles offset and limit larger then db", func(t *testing.T) {
-		_, err := provider.List(ctx, 10, 30)
+		_, err := provider.List(ctx, database.ListOptions{}, 10, 30)
 		if err != nil {
 			t.Fatal(err)
 		}
 	})
 }
 
+func TestRatio(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	provider, err := file.New("../../../test/fixtures/file/metadata_varied.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		Name       string
+		Ratio      float64
+		ExpectedID string
+	}{
+		{"landscape ratio", 16.0 / 9.0, "3"},
+		{"wide ratio", 21.0 / 9.0, "3"},
+		{"square ratio", 1, "4"},
+	}
+
+	for _, test := range tests {
+		for i := 0; i < 10; i++ {
+			image, err := provider.GetRandomWithRatio(ctx, test.Ratio, database.Filter{})
+			if err != nil {
+				t.Fatalf("%s: %s", test.Name, err)
+			}
+
+			if image.ID != test.ExpectedID {
+				t.Errorf("%s: wrong image %s", test.Name, image.ID)
+			}
+		}
+	}
+
+	t.Run("Returns the closest image matching the filter", func(t *testing.T) {
+		image, err := provider.GetRandomWithRatio(ctx, 16.0/9.0, database.Filter{Exclude: database.NewIDSet("3")})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if image.ID != "4" {
+			t.Errorf("wrong image %s", image.ID)
+		}
+	})
+
+	t.Run("Returns ErrNotFound when no images match the filter", func(t *testing.T) {
+		if _, err := provider.GetRandomWithRatio(ctx, 16.0/9.0, database.Filter{Exclude: database.NewIDSet("1", "2", "3", "4")}); err != database.ErrNotFound {
+			t.Errorf("wrong error %v", err)
+		}
+	})
+
+	t.Run("Returns any of the closest images", func(t *testing.T) {
+		image, err := provider.GetRandomWithRatio(ctx, 3.0/4.0, database.Filter{})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if image.ID != "1" && image.ID != "2" {
+			t.Error("wrong image")
+		}
+	})
+}
+
+func TestFilter(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	provider, err := file.New("../../../test/fixtures/file/metadata_varied.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		Name       string
+		Filter     database.Filter
+		ExpectedID string
+	}{
+		{"landscape", database.Filter{Orientation: database.Landscape}, "3"},
+		{"square", database.Filter{Orientation: database.Square}, "4"},
+		{"tag and orientation", database.Filter{Orientation: database.Landscape, Tag: "city"}, "3"},
+		{"tag ignores case", database.Filter{Orientation: database.Portrait, Tag: "City"}, "2"},
+		{"exclude", database.Filter{Exclude: database.NewIDSet("1", "2", "3")}, "4"},
+		{"exclude and orientation", database.Filter{Orientation: database.Portrait, Exclude: database.NewIDSet("1")}, "2"},
+	}
+
+	for _, test := range tests {
+		image, err := provider.GetRandomFiltered(ctx, test.Filter)
+		if err != nil {
+			t.Fatalf("%s: %s", test.Name, err)
+		}
+
+		if image.ID != test.ExpectedID {
+			t.Errorf("%s: wrong image %s", test.Name, image.ID)
+		}
+
+		image, err = provider.GetRandomWithSeedFiltered(ctx, 0, test.Filter)
+		if err != nil {
+			t.Fatalf("%s: %s", test.Name, err)
+		}
+
+		if image.ID != test.ExpectedID {
+			t.Errorf("%s: wrong image with seed %s", test.Name, image.ID)
+		}
+	}
+
+	t.Run("Returns the same image as without a filter for an empty filter", func(t *testing.T) {
+		for seed := int64(0); seed < 10; seed++ {
+			image, err := provider.GetRandomWithSeed(ctx, seed)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			filteredImage, err := provider.GetRandomWithSeedFiltered(ctx, seed, database.Filter{})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if image.ID != filteredImage.ID {
+				t.Errorf("wrong image for seed %d", seed)
+			}
+		}
+	})
+
+	t.Run("Returns error when no images match", func(t *testing.T) {
+		provider, err := file.New("../../../test/fixtures/file/metadata_multiple.json")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		filter := database.Filter{Orientation: database.Landscape}
+
+		if _, err := provider.GetRandomFiltered(ctx, filter); err != database.ErrNotFound {
+			t.Errorf("wrong error %s", err)
+		}
+
+		if _, err := provider.GetRandomWithSeedFiltered(ctx, 0, filter); err != database.ErrNotFound {
+			t.Errorf("wrong error %s", err)
+		}
+	})
+}
+
+func TestSample(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	provider, err := file.New("../../../test/fixtures/file/metadata_varied.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		Name          string
+		Count         int
+		Filter        database.Filter
+		ExpectedCount int
+	}{
+		{"fewer than all images", 3, database.Filter{}, 3},
+		{"more than all images", 10, database.Filter{}, 4},
+		{"filtered", 10, database.Filter{Tag: "nature"}, 2},
+		{"excluded", 10, database.Filter{Exclude: database.NewIDSet("1", "4")}, 2},
+	}
+
+	for _, test := range tests {
+		images, err := provider.GetRandomSample(ctx, test.Count, test.Filter)
+		if err != nil {
+			t.Fatalf("%s: %s", test.Name, err)
+		}
+
+		seededImages, err := provider.GetRandomSampleWithSeed(ctx, test.Count, 1, test.Filter)
+		if err != nil {
+			t.Fatalf("%s: %s", test.Name, err)
+		}
+
+		for _, sample := range [][]database.Image{images, seededImages} {
+			ids := map[string]bool{}
+			for _, image := range sample {
+				if !test.Filter.Matches(&image) {
+					t.Errorf("%s: image %s doesn't match the filter", test.Name, image.ID)
+				}
+
+				ids[image.ID] = true
+			}
+
+			if len(sample) != test.ExpectedCount || len(ids) != test.ExpectedCount {
+				t.Errorf("%s: wrong images %v", test.Name, imageIDs(sample))
+			}
+		}
+	}
+
+	t.Run("Returns the same images for a seed", func(t *testing.T) {
+		images, err := provider.GetRandomSampleWithSeed(ctx, 2, 1, database.Filter{})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		sameImages, err := provider.GetRandomSampleWithSeed(ctx, 2, 1, database.Filter{})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !reflect.DeepEqual(images, sameImages) {
+			t.Error("images don't match")
+		}
+	})
+
+	t.Run("Doesn't change the order of the indexes", func(t *testing.T) {
+		for _, filter := range []database.Filter{{}, {Tag: "nature"}, {Orientation: database.Portrait}} {
+			image, err := provider.GetRandomWithSeedFiltered(ctx, 1, filter)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for i := 0; i < 10; i++ {
+				provider.GetRandomSample(ctx, 2, filter)
+			}
+
+			if sameImage, _ := provider.GetRandomWithSeedFiltered(ctx, 1, filter); sameImage.ID != image.ID {
+				t.Errorf("%#v: wrong image %s", filter, sameImage.ID)
+			}
+		}
+	})
+
+	t.Run("Returns error when no images match", func(t *testing.T) {
+		if _, err := provider.GetRandomSample(ctx, 1, database.Filter{Exclude: database.NewIDSet("1", "2", "3", "4")}); err != database.ErrNotFound {
+			t.Errorf("wrong error %s", err)
+		}
+
+		if _, err := provider.GetRandomSample(ctx, 1, database.Filter{Tag: "food"}); err != database.ErrNotFound {
+			t.Errorf("wrong error %s", err)
+		}
+	})
+}
+
+func TestTags(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	provider, err := file.New("../../../test/fixtures/file/metadata_varied.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tags, err := provider.ListTags(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expectedTags := []database.Tag{{Name: "city", Count: 2}, {Name: "nature", Count: 2}}
+	if !reflect.DeepEqual(tags, expectedTags) {
+		t.Errorf("wrong tags %#v", tags)
+	}
+
+	image, err := provider.GetRandomFiltered(ctx, database.Filter{Tag: "nature"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !image.HasTag("nature") {
+		t.Errorf("wrong image %s", image.ID)
+	}
+
+	if _, err := provider.GetRandomFiltered(ctx, database.Filter{Tag: "food"}); err != database.ErrNotFound {
+		t.Errorf("wrong error %s", err)
+	}
+}
+
+func TestListOptions(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	provider, err := file.New("../../../test/fixtures/file/metadata_varied.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		Name        string
+		Options     database.ListOptions
+		ExpectedIDs []string
+	}{
+		{"no options", database.ListOptions{}, []string{"1", "2", "3", "4"}},
+		{"sort by id", database.ListOptions{Sort: database.SortByID}, []string{"1", "2", "3", "4"}},
+		{"author", database.ListOptions{Filter: database.Filter{Author: "jane doe"}}, []string{"3", "4"}},
+		{"min width", database.ListOptions{Filter: database.Filter{MinWidth: 400}}, []string{"3", "4"}},
+		{"min height", database.ListOptions{Filter: database.Filter{MinHeight: 450}}, []string{"3", "4"}},
+		{"orientation", database.ListOptions{Filter: database.Filter{Orientation: database.Portrait}}, []string{"1", "2"}},
+		{"exclude", database.ListOptions{Filter: database.Filter{Exclude: database.NewIDSet("2", "3")}}, []string{"1", "4"}},
+		{"sort by author", database.ListOptions{Sort: database.SortByAuthor}, []string{"3", "4", "1", "2"}},
+		{"sort by width", database.ListOptions{Sort: database.SortByWidth}, []string{"1", "2", "4", "3"}},
+		{"filter and sort", database.ListOptions{Filter: database.Filter{Author: "Jane Doe"}, Sort: database.SortByWidth}, []string{"4", "3"}},
+		{"after cursor", database.ListOptions{After: &database.Cursor{ID: "2"}}, []string{"3", "4"}},
+		{"after cursor for removed image", database.ListOptions{After: &database.Cursor{ID: "10"}}, []string{}},
+		{"after cursor sorted by author", database.ListOptions{Sort: database.SortByAuthor, After: &database.Cursor{ID: "4", Author: "Jane Doe"}}, []string{"1", "2"}},
+		{"after cursor sorted by width", database.ListOptions{Sort: database.SortByWidth, After: &database.Cursor{ID: "2", Width: 300}}, []string{"4", "3"}},
+	}
+
+	for _, test := range tests {
+		images, err := provider.List(ctx, test.Options, 0, 10)
+		if err != nil {
+			t.Fatalf("%s: %s", test.Name, err)
+		}
+
+		if ids := imageIDs(images); !reflect.DeepEqual(ids, test.ExpectedIDs) {
+			t.Errorf("%s: wrong images %v", test.Name, ids)
+		}
+
+		count, err := provider.Count(ctx, test.Options)
+		if err != nil {
+			t.Fatalf("%s: %s", test.Name, err)
+		}
+
+		if count != len(test.ExpectedIDs) {
+			t.Errorf("%s: wrong count %d", test.Name, count)
+		}
+	}
+
+	t.Run("Shuffles the images based on the seed", func(t *testing.T) {
+		options := database.ListOptions{Sort: database.SortByShuffle, Seed: 1}
+
+		images, err := provider.List(ctx, options, 0, 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		page, err := provider.List(ctx, options, 2, 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(images) != 4 {
+			t.Fatalf("wrong number of images %d", len(images))
+		}
+
+		if !reflect.DeepEqual(imageIDs(page), imageIDs(images[2:])) {
+			t.Error("shuffle is not stable between pages")
+		}
+
+		options.After = database.NewCursor(images[1])
+		page, err = provider.List(ctx, options, 0, 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !reflect.DeepEqual(imageIDs(page), imageIDs(images[2:])) {
+			t.Error("shuffle is not stable with a cursor")
+		}
+	})
+}
+
+func imageIDs(images []database.Image) []string {
+	ids := []string{}
+	for _, image := range images {
+		ids = append(ids, image.ID)
+	}
+
+	return ids
+}
+
+func TestAuthors(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	provider, err := file.New("../../../test/fixtures/file/metadata_varied.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	authors, err := provider.ListAuthors(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expectedAuthors := []database.Author{
+		{Name: "Jane Doe", Slug: "jane-doe", URL: "https://picsum.photos/authors/jane-doe", Count: 2},
+		{Name: "John Doe", Slug: "john-doe", Count: 2},
+	}
+	if !reflect.DeepEqual(authors, expectedAuthors) {
+		t.Errorf("wrong authors %#v", authors)
+	}
+
+	author, err := provider.GetAuthor(ctx, "john-doe")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(author, &expectedAuthors[1]) {
+		t.Errorf("wrong author %#v", author)
+	}
+
+	if _, err := provider.GetAuthor(ctx, "nobody"); err != database.ErrAuthorNotFound {
+		t.Errorf("wrong error %s", err)
+	}
+
+	images, err := provider.List(ctx, database.ListOptions{Filter: database.Filter{AuthorSlug: "jane-doe"}}, 0, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if ids := imageIDs(images); !reflect.DeepEqual(ids, []string{"3", "4"}) {
+		t.Errorf("wrong images %v", ids)
+	}
+}
+
+func TestVersion(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	versions := map[string]bool{}
+	for _, path := range []string{"metadata.json", "metadata.json", "metadata_varied.json"} {
+		provider, err := file.New("../../../test/fixtures/file/" + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		version, err := provider.Version(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		versions[version] = true
+	}
+
+	if len(versions) != 2 {
+		t.Errorf("wrong versions %v", versions)
+	}
+}
+
+func TestSlug(t *testing.T) {
+	tests := []struct {
+		Name         string
+		ExpectedSlug string
+	}{
+		{"Alejandro Escamilla", "alejandro-escamilla"},
+		{"  Paul   Jarvis ", "paul-jarvis"},
+		{"Jerry Adney (Ð)", "jerry-adney-ð"},
+		{"O'Neil & Co.", "o-neil-co"},
+	}
+
+	for _, test := range tests {
+		if slug := database.Slug(test.Name); slug != test.ExpectedSlug {
+			t.Errorf("%s: wrong slug %s", test.Name, slug)
+		}
+	}
+}
+
+func TestOrientation(t *testing.T) {
+	tests := []struct {
+		Width               int
+		Height              int
+		ExpectedOrientation database.Orientation
+	}{
+		{1600, 900, database.Landscape},
+		{300, 400, database.Portrait},
+		{500, 500, database.Square},
+		{500, 490, database.Square},
+	}
+
+	for _, test := range tests {
+		if orientation := database.GetOrientation(test.Width, test.Height); orientation != test.ExpectedOrientation {
+			t.Errorf("%dx%d: wrong orientation %s", test.Width, test.Height, orientation)
+		}
+	}
+}
+
 func TestMissingMetadata(t *testing.T) {
 	_, err := file.New("")
 	if err == nil {
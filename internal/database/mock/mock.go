@@ -26,12 +26,62 @@ func (p *Provider) GetRandomWithSeed(ctx context.Context, seed int64) (i *databa
 	return nil, fmt.Errorf("random error")
 }
 
+// GetRandomWithRatio returns a random image matching the filter, preferring images close to the given aspect ratio
+func (p *Provider) GetRandomWithRatio(ctx context.Context, ratio float64, filter database.Filter) (i *database.Image, err error) {
+	return nil, fmt.Errorf("random error")
+}
+
+// GetRandomFiltered returns a random image matching the filter
+func (p *Provider) GetRandomFiltered(ctx context.Context, filter database.Filter) (i *database.Image, err error) {
+	return nil, fmt.Errorf("random error")
+}
+
+// GetRandomWithSeedFiltered returns a random image matching the filter based on the given seed
+func (p *Provider) GetRandomWithSeedFiltered(ctx context.Context, seed int64, filter database.Filter) (i *database.Image, err error) {
+	return nil, fmt.Errorf("random error")
+}
+
+// GetRandomSample returns count distinct random images matching the filter
+func (p *Provider) GetRandomSample(ctx context.Context, count int, filter database.Filter) ([]database.Image, error) {
+	return nil, fmt.Errorf("random error")
+}
+
+// GetRandomSampleWithSeed returns count distinct random images matching the filter based on the given seed
+func (p *Provider) GetRandomSampleWithSeed(ctx context.Context, count int, seed int64, filter database.Filter) ([]database.Image, error) {
+	return nil, fmt.Errorf("random error")
+}
+
 // ListAll returns a list of all the images
 func (p *Provider) ListAll(ctx context.Context) ([]database.Image, error) {
 	return nil, fmt.Errorf("list error")
 }
 
 // List returns a list of all the images with an offset/limit
-func (p *Provider) List(ctx context.Context, offset, limit int) ([]database.Image, error) {
+func (p *Provider) List(ctx context.Context, options database.ListOptions, offset, limit int) ([]database.Image, error) {
+	return nil, fmt.Errorf("list error")
+}
+
+// Count returns the number of images that would be listed
+func (p *Provider) Count(ctx context.Context, options database.ListOptions) (int, error) {
+	return 0, fmt.Errorf("count error")
+}
+
+// ListTags returns a list of all the tags
+func (p *Provider) ListTags(ctx context.Context) ([]database.Tag, error) {
+	return nil, fmt.Errorf("list error")
+}
+
+// ListAuthors returns a list of all the authors
+func (p *Provider) ListAuthors(ctx context.Context) ([]database.Author, error) {
 	return nil, fmt.Errorf("list error")
 }
+
+// GetAuthor returns an author by slug
+func (p *Provider) GetAuthor(ctx context.Context, slug string) (*database.Author, error) {
+	return nil, fmt.Errorf("get error")
+}
+
+// Version returns the version of the catalogue
+func (p *Provider) Version(ctx context.Context) (string, error) {
+	return "", fmt.Errorf("version error")
+}
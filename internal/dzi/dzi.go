@@ -0,0 +1,111 @@
+package dzi
+
+import (
+	"encoding/xml"
+	"fmt"
+	"math"
+
+	"github.com/DMarby/picsum-photos/internal/image"
+)
+
+// ErrTileNotFound is returned for tiles outside the tile pyramid of an image
+var ErrTileNotFound = fmt.Errorf("Tile does not exist")
+
+const (
+	// TileSize is the width and height of the tiles, without the overlap
+	TileSize = 256
+	// Overlap is the number of pixels a tile overlaps with its neighbours on each side
+	Overlap = 1
+	// Format is the file format of the tiles
+	Format = "jpg"
+	// Namespace is the XML namespace of a Deep Zoom descriptor
+	Namespace = "http://schemas.microsoft.com/deepzoom/2008"
+)
+
+// Descriptor is a Deep Zoom Image descriptor
+type Descriptor struct {
+	XMLName  xml.Name `xml:"Image"`
+	Xmlns    string   `xml:"xmlns,attr"`
+	URL      string   `xml:"Url,attr"`
+	Format   string   `xml:"Format,attr"`
+	Overlap  int      `xml:"Overlap,attr"`
+	TileSize int      `xml:"TileSize,attr"`
+	Size     Size     `xml:"Size"`
+}
+
+// Size is the size of the image in a Deep Zoom descriptor
+type Size struct {
+	Width  int `xml:"Width,attr"`
+	Height int `xml:"Height,attr"`
+}
+
+// NewDescriptor returns the Deep Zoom descriptor of an image, with the tiles at url
+func NewDescriptor(url string, width, height int) *Descriptor {
+	return &Descriptor{
+		Xmlns:    Namespace,
+		URL:      url,
+		Format:   Format,
+		Overlap:  Overlap,
+		TileSize: TileSize,
+		Size:     Size{Width: width, Height: height},
+	}
+}
+
+// MaxLevel returns the level of the image at full size, where level 0 is 1x1 pixels
+func MaxLevel(width, height int) int {
+	return int(math.Ceil(math.Log2(float64(max(width, height)))))
+}
+
+// LevelSize returns the size of the image at a level, halving it for each level below the max level
+func LevelSize(width, height, level int) (int, int) {
+	scale := math.Exp2(float64(MaxLevel(width, height) - level))
+	return int(math.Ceil(float64(width) / scale)), int(math.Ceil(float64(height) / scale))
+}
+
+// Tile returns the region of the image covered by a tile, in pixels of the image, and the size of the tile
+func Tile(width, height, level, col, row int) (region image.Region, tileWidth, tileHeight int, err error) {
+	if level < 0 || level > MaxLevel(width, height) || col < 0 || row < 0 {
+		return image.Region{}, 0, 0, ErrTileNotFound
+	}
+
+	levelWidth, levelHeight := LevelSize(width, height, level)
+
+	left, right, ok := tileBounds(col, levelWidth)
+	if !ok {
+		return image.Region{}, 0, 0, ErrTileNotFound
+	}
+
+	top, bottom, ok := tileBounds(row, levelHeight)
+	if !ok {
+		return image.Region{}, 0, 0, ErrTileNotFound
+	}
+
+	// Scale the tile bounds at the level to the image
+	scaleX := float64(width) / float64(levelWidth)
+	scaleY := float64(height) / float64(levelHeight)
+
+	region.X = int(math.Round(float64(left) * scaleX))
+	region.Y = int(math.Round(float64(top) * scaleY))
+	region.Width = max(min(int(math.Round(float64(right)*scaleX)), width)-region.X, 1)
+	region.Height = max(min(int(math.Round(float64(bottom)*scaleY)), height)-region.Y, 1)
+
+	return region, right - left, bottom - top, nil
+}
+
+// tileBounds returns the start and end of a tile along an axis of a level, including the overlap
+func tileBounds(index, levelSize int) (start, end int, ok bool) {
+	// Check the index against the number of tiles before multiplying, as huge indexes overflow int
+	if index >= (levelSize+TileSize-1)/TileSize {
+		return 0, 0, false
+	}
+
+	start = index * TileSize
+
+	if index > 0 {
+		start -= Overlap
+	}
+
+	end = min((index+1)*TileSize+Overlap, levelSize)
+
+	return start, end, true
+}
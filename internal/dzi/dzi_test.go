@@ -0,0 +1,67 @@
+package dzi_test
+
+import (
+	"testing"
+
+	"github.com/DMarby/picsum-photos/internal/dzi"
+	"github.com/DMarby/picsum-photos/internal/image"
+)
+
+func TestLevels(t *testing.T) {
+	if level := dzi.MaxLevel(1, 1); level != 0 {
+		t.Errorf("wrong max level %d for 1x1", level)
+	}
+
+	if level := dzi.MaxLevel(5000, 3333); level != 13 {
+		t.Errorf("wrong max level %d for 5000x3333", level)
+	}
+
+	if width, height := dzi.LevelSize(5000, 3333, 13); width != 5000 || height != 3333 {
+		t.Errorf("wrong size %dx%d for the max level", width, height)
+	}
+
+	if width, height := dzi.LevelSize(5000, 3333, 11); width != 1250 || height != 834 {
+		t.Errorf("wrong size %dx%d for level 11", width, height)
+	}
+
+	if width, height := dzi.LevelSize(5000, 3333, 0); width != 1 || height != 1 {
+		t.Errorf("wrong size %dx%d for level 0", width, height)
+	}
+}
+
+func TestTile(t *testing.T) {
+	tests := []struct {
+		Name            string
+		Level, Col, Row int
+		ExpectedRegion  image.Region
+		ExpectedWidth   int
+		ExpectedHeight  int
+		ExpectedError   error
+	}{
+		{"first tile at the max level", 13, 0, 0, image.Region{Width: 257, Height: 257}, 257, 257, nil},
+		{"inner tile at the max level", 13, 1, 2, image.Region{X: 255, Y: 511, Width: 258, Height: 258}, 258, 258, nil},
+		{"last tile at the max level", 13, 19, 13, image.Region{X: 4863, Y: 3327, Width: 137, Height: 6}, 137, 6, nil},
+		{"tile at a lower level", 11, 1, 0, image.Region{X: 1020, Width: 1032, Height: 1027}, 258, 257, nil},
+		{"single tile at the lowest level", 0, 0, 0, image.Region{Width: 5000, Height: 3333}, 1, 1, nil},
+
+		// Errors
+		{"level above the max level", 14, 0, 0, image.Region{}, 0, 0, dzi.ErrTileNotFound},
+		{"column outside the level", 13, 20, 0, image.Region{}, 0, 0, dzi.ErrTileNotFound},
+		{"row outside the level", 11, 0, 4, image.Region{}, 0, 0, dzi.ErrTileNotFound},
+		{"negative level", -1, 0, 0, image.Region{}, 0, 0, dzi.ErrTileNotFound},
+		{"column overflowing the tile position", 13, 36028797018963968, 0, image.Region{}, 0, 0, dzi.ErrTileNotFound},
+		{"row overflowing the tile position", 13, 0, 36028797018963968, image.Region{}, 0, 0, dzi.ErrTileNotFound},
+	}
+
+	for _, test := range tests {
+		region, width, height, err := dzi.Tile(5000, 3333, test.Level, test.Col, test.Row)
+		if err != test.ExpectedError {
+			t.Errorf("%s: wrong error %v", test.Name, err)
+			continue
+		}
+
+		if region != test.ExpectedRegion || width != test.ExpectedWidth || height != test.ExpectedHeight {
+			t.Errorf("%s: wrong tile %#v %dx%d", test.Name, region, width, height)
+		}
+	}
+}
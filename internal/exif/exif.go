@@ -0,0 +1,292 @@
+package exif
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"strings"
+	"time"
+	"unicode/utf16"
+)
+
+// Errors
+var (
+	ErrNotJPEG = errors.New("Not a JPEG image")
+	ErrNoEXIF  = errors.New("Image has no EXIF metadata")
+	ErrInvalid = errors.New("Invalid EXIF metadata")
+)
+
+// Metadata contains the EXIF metadata of an image
+type Metadata struct {
+	Title       string
+	Description string
+	CameraModel string
+	FocalLength float64 // In millimeters
+	CapturedAt  time.Time
+}
+
+// EXIF tags
+const (
+	tagImageDescription   = 0x010e
+	tagModel              = 0x0110
+	tagExifIFD            = 0x8769
+	tagXPTitle            = 0x9c9b
+	tagDateTimeOriginal   = 0x9003
+	tagOffsetTimeOriginal = 0x9011
+	tagFocalLength        = 0x920a
+)
+
+// EXIF types
+const (
+	typeByte      = 1
+	typeASCII     = 2
+	typeShort     = 3
+	typeLong      = 4
+	typeRational  = 5
+	typeUndefined = 7
+)
+
+var typeSizes = map[uint16]uint32{
+	typeByte:      1,
+	typeASCII:     1,
+	typeShort:     2,
+	typeLong:      4,
+	typeRational:  8,
+	typeUndefined: 1,
+}
+
+// dateTimeLayout is the layout of EXIF dates, which don't have a time zone
+const dateTimeLayout = "2006:01:02 15:04:05"
+
+// JPEG markers
+const (
+	markerSOI  = 0xd8
+	markerAPP1 = 0xe1
+	markerSOS  = 0xda
+)
+
+var exifHeader = []byte("Exif\x00\x00")
+
+// Decode reads the EXIF metadata of a JPEG image
+func Decode(r io.Reader) (*Metadata, error) {
+	segment, err := findEXIFSegment(bufio.NewReader(r))
+	if err != nil {
+		return nil, err
+	}
+
+	return parseTIFF(segment)
+}
+
+// findEXIFSegment returns the TIFF structure of the APP1 EXIF segment of a JPEG image
+func findEXIFSegment(r *bufio.Reader) ([]byte, error) {
+	var soi [2]byte
+	if _, err := io.ReadFull(r, soi[:]); err != nil || soi[0] != 0xff || soi[1] != markerSOI {
+		return nil, ErrNotJPEG
+	}
+
+	for {
+		var marker [4]byte
+		if _, err := io.ReadFull(r, marker[:]); err != nil {
+			return nil, ErrNoEXIF
+		}
+
+		if marker[0] != 0xff || marker[1] == markerSOS {
+			return nil, ErrNoEXIF
+		}
+
+		length := int(binary.BigEndian.Uint16(marker[2:]))
+		if length < 2 {
+			return nil, ErrInvalid
+		}
+
+		segment := make([]byte, length-2)
+		if _, err := io.ReadFull(r, segment); err != nil {
+			return nil, ErrInvalid
+		}
+
+		if marker[1] == markerAPP1 && bytes.HasPrefix(segment, exifHeader) {
+			return segment[len(exifHeader):], nil
+		}
+	}
+}
+
+// entry is an IFD entry
+type entry struct {
+	typ   uint16
+	count uint32
+	value []byte
+}
+
+// parser reads IFD entries from a TIFF structure
+type parser struct {
+	data  []byte
+	order binary.ByteOrder
+}
+
+func parseTIFF(data []byte) (*Metadata, error) {
+	if len(data) < 8 {
+		return nil, ErrInvalid
+	}
+
+	p := &parser{data: data}
+	switch string(data[:2]) {
+	case "II":
+		p.order = binary.LittleEndian
+	case "MM":
+		p.order = binary.BigEndian
+	default:
+		return nil, ErrInvalid
+	}
+
+	if p.order.Uint16(data[2:]) != 42 {
+		return nil, ErrInvalid
+	}
+
+	entries, err := p.readIFD(p.order.Uint32(data[4:]))
+	if err != nil {
+		return nil, err
+	}
+
+	// The capture date and camera settings are in the EXIF sub-IFD
+	if e, ok := entries[tagExifIFD]; ok {
+		offset, ok := p.uint(e)
+		if !ok {
+			return nil, ErrInvalid
+		}
+
+		exifEntries, err := p.readIFD(offset)
+		if err != nil {
+			return nil, err
+		}
+
+		for tag, e := range exifEntries {
+			entries[tag] = e
+		}
+	}
+
+	m := &Metadata{
+		Description: p.string(entries[tagImageDescription]),
+		CameraModel: p.string(entries[tagModel]),
+		Title:       p.utf16String(entries[tagXPTitle]),
+		FocalLength: p.rational(entries[tagFocalLength]),
+	}
+
+	// Cameras without a clock write invalid dates such as 0000:00:00 00:00:00, which are left empty
+	if date := p.string(entries[tagDateTimeOriginal]); date != "" {
+		m.CapturedAt, _ = parseDateTime(date, p.string(entries[tagOffsetTimeOriginal]))
+	}
+
+	return m, nil
+}
+
+// readIFD reads the entries of the IFD at the offset, by tag
+func (p *parser) readIFD(offset uint32) (map[uint16]entry, error) {
+	if uint64(offset)+2 > uint64(len(p.data)) {
+		return nil, ErrInvalid
+	}
+
+	count := int(p.order.Uint16(p.data[offset:]))
+	start := int(offset) + 2
+	if start+count*12 > len(p.data) {
+		return nil, ErrInvalid
+	}
+
+	entries := make(map[uint16]entry, count)
+	for i := 0; i < count; i++ {
+		raw := p.data[start+i*12 : start+(i+1)*12]
+		tag := p.order.Uint16(raw)
+		e := entry{typ: p.order.Uint16(raw[2:]), count: p.order.Uint32(raw[4:])}
+
+		size, ok := typeSizes[e.typ]
+		if !ok {
+			// Skip the types that aren't used
+			continue
+		}
+
+		// Values of up to 4 bytes are stored in the entry instead of the offset
+		length := uint64(size) * uint64(e.count)
+		if length <= 4 {
+			e.value = raw[8 : 8+length]
+		} else {
+			valueOffset := uint64(p.order.Uint32(raw[8:]))
+			if valueOffset+length > uint64(len(p.data)) {
+				return nil, ErrInvalid
+			}
+
+			e.value = p.data[valueOffset : valueOffset+length]
+		}
+
+		entries[tag] = e
+	}
+
+	return entries, nil
+}
+
+// string returns the value of an ASCII entry, without the NUL terminator and surrounding whitespace
+func (p *parser) string(e entry) string {
+	if e.typ != typeASCII {
+		return ""
+	}
+
+	value, _, _ := bytes.Cut(e.value, []byte{0})
+	return strings.TrimSpace(string(value))
+}
+
+// utf16String returns the value of a Windows XP entry, which are UTF-16LE encoded bytes regardless of the byte order
+func (p *parser) utf16String(e entry) string {
+	if e.typ != typeByte || len(e.value)%2 != 0 {
+		return ""
+	}
+
+	chars := make([]uint16, 0, len(e.value)/2)
+	for i := 0; i < len(e.value); i += 2 {
+		char := binary.LittleEndian.Uint16(e.value[i:])
+		if char == 0 {
+			break
+		}
+
+		chars = append(chars, char)
+	}
+
+	return strings.TrimSpace(string(utf16.Decode(chars)))
+}
+
+// uint returns the value of a short or long entry
+func (p *parser) uint(e entry) (uint32, bool) {
+	switch {
+	case e.typ == typeShort && len(e.value) >= 2:
+		return uint32(p.order.Uint16(e.value)), true
+	case e.typ == typeLong && len(e.value) >= 4:
+		return p.order.Uint32(e.value), true
+	}
+
+	return 0, false
+}
+
+// rational returns the value of a rational entry, or 0 if it's missing or invalid
+func (p *parser) rational(e entry) float64 {
+	if e.typ != typeRational || len(e.value) < 8 {
+		return 0
+	}
+
+	numerator, denominator := p.order.Uint32(e.value), p.order.Uint32(e.value[4:])
+	if denominator == 0 {
+		return 0
+	}
+
+	return float64(numerator) / float64(denominator)
+}
+
+// parseDateTime parses an EXIF date, in UTC unless the time zone offset is known
+func parseDateTime(date, offset string) (time.Time, error) {
+	if offset != "" {
+		t, err := time.Parse(dateTimeLayout+"-07:00", date+offset)
+		if err == nil {
+			return t, nil
+		}
+	}
+
+	return time.Parse(dateTimeLayout, date)
+}
@@ -0,0 +1,214 @@
+package exif_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/jpeg"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+	"unicode/utf16"
+
+	"github.com/DMarby/picsum-photos/internal/exif"
+)
+
+// ifdEntry is an entry of a test IFD, with the value encoded in the byte order of the test
+type ifdEntry struct {
+	tag   uint16
+	typ   uint16
+	count uint32
+	value []byte
+}
+
+// buildIFD encodes an IFD at the offset, with the values that don't fit in the entries stored after it
+func buildIFD(order binary.ByteOrder, offset uint32, entries []ifdEntry) []byte {
+	var ifd, values bytes.Buffer
+	valueOffset := offset + 2 + uint32(len(entries))*12 + 4
+
+	binary.Write(&ifd, order, uint16(len(entries)))
+	for _, e := range entries {
+		binary.Write(&ifd, order, e.tag)
+		binary.Write(&ifd, order, e.typ)
+		binary.Write(&ifd, order, e.count)
+
+		if len(e.value) <= 4 {
+			ifd.Write(append(e.value, make([]byte, 4-len(e.value))...))
+			continue
+		}
+
+		binary.Write(&ifd, order, valueOffset+uint32(values.Len()))
+		values.Write(e.value)
+	}
+	binary.Write(&ifd, order, uint32(0))
+
+	return append(ifd.Bytes(), values.Bytes()...)
+}
+
+func ascii(tag uint16, value string) ifdEntry {
+	return ifdEntry{tag: tag, typ: 2, count: uint32(len(value) + 1), value: append([]byte(value), 0)}
+}
+
+// buildJPEG returns a JPEG image with an EXIF segment containing the entries of IFD0 and the EXIF sub-IFD
+func buildJPEG(order binary.ByteOrder, ifd0, exifIFD []ifdEntry) []byte {
+	var tiff bytes.Buffer
+	if order == binary.LittleEndian {
+		tiff.WriteString("II")
+	} else {
+		tiff.WriteString("MM")
+	}
+	binary.Write(&tiff, order, uint16(42))
+	binary.Write(&tiff, order, uint32(8))
+
+	// The EXIF sub-IFD is stored after IFD0, which has one more entry pointing at it
+	ifd0Size := len(buildIFD(order, 8, append(ifd0, ifdEntry{})))
+	exifOffset := make([]byte, 4)
+	order.PutUint32(exifOffset, uint32(8+ifd0Size))
+
+	tiff.Write(buildIFD(order, 8, append(ifd0, ifdEntry{tag: 0x8769, typ: 4, count: 1, value: exifOffset})))
+	tiff.Write(buildIFD(order, uint32(8+ifd0Size), exifIFD))
+
+	segment := append([]byte("Exif\x00\x00"), tiff.Bytes()...)
+
+	var buf bytes.Buffer
+	buf.Write([]byte{0xff, 0xd8, 0xff, 0xe1})
+	binary.Write(&buf, binary.BigEndian, uint16(len(segment)+2))
+	buf.Write(segment)
+	jpeg.Encode(&buf, image.NewGray(image.Rect(0, 0, 1, 1)), nil)
+
+	return buf.Bytes()
+}
+
+func TestDecode(t *testing.T) {
+	for _, order := range []binary.ByteOrder{binary.LittleEndian, binary.BigEndian} {
+		var title []byte
+		for _, char := range utf16.Encode([]rune("Mountains ")) {
+			title = binary.LittleEndian.AppendUint16(title, char)
+		}
+		title = append(title, 0, 0)
+
+		focalLength := make([]byte, 8)
+		order.PutUint32(focalLength, 35)
+		order.PutUint32(focalLength[4:], 2)
+
+		ifd0 := []ifdEntry{
+			ascii(0x010e, "A lake in the mountains"),
+			ascii(0x0110, "Canon EOS 5D"),
+			{tag: 0x9c9b, typ: 1, count: uint32(len(title)), value: title},
+		}
+
+		exifIFD := []ifdEntry{
+			ascii(0x9003, "2015:06:02 14:30:00"),
+			ascii(0x9011, "+02:00"),
+			{tag: 0x920a, typ: 5, count: 1, value: focalLength},
+		}
+
+		metadata, err := exif.Decode(bytes.NewReader(buildJPEG(order, ifd0, exifIFD)))
+		if err != nil {
+			t.Fatalf("%s: %s", order, err)
+		}
+
+		expected := &exif.Metadata{
+			Title:       "Mountains",
+			Description: "A lake in the mountains",
+			CameraModel: "Canon EOS 5D",
+			FocalLength: 17.5,
+		}
+
+		if capturedAt := time.Date(2015, 6, 2, 12, 30, 0, 0, time.UTC); !metadata.CapturedAt.Equal(capturedAt) {
+			t.Errorf("%s: wrong capture date %s", order, metadata.CapturedAt)
+		}
+
+		metadata.CapturedAt = time.Time{}
+		if !reflect.DeepEqual(metadata, expected) {
+			t.Errorf("%s: wrong metadata %#v", order, metadata)
+		}
+	}
+}
+
+func TestDecodeWithoutTimezone(t *testing.T) {
+	exifIFD := []ifdEntry{ascii(0x9003, "2015:06:02 14:30:00")}
+
+	metadata, err := exif.Decode(bytes.NewReader(buildJPEG(binary.LittleEndian, nil, exifIFD)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if expected := time.Date(2015, 6, 2, 14, 30, 0, 0, time.UTC); !metadata.CapturedAt.Equal(expected) {
+		t.Errorf("wrong capture date %s", metadata.CapturedAt)
+	}
+}
+
+func TestDecodeFixture(t *testing.T) {
+	file, err := os.Open("../../test/fixtures/fixture.jpg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	metadata, err := exif.Decode(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(metadata, &exif.Metadata{}) {
+		t.Errorf("wrong metadata %#v", metadata)
+	}
+}
+
+func TestDecodeErrors(t *testing.T) {
+	var withoutEXIF bytes.Buffer
+	jpeg.Encode(&withoutEXIF, image.NewGray(image.Rect(0, 0, 1, 1)), nil)
+
+	truncated := buildJPEG(binary.LittleEndian, []ifdEntry{ascii(0x010e, "A lake in the mountains")}, nil)
+
+	tests := []struct {
+		Name          string
+		Data          []byte
+		ExpectedError error
+	}{
+		{"not a jpeg", []byte("GIF89a"), exif.ErrNotJPEG},
+		{"without exif", withoutEXIF.Bytes(), exif.ErrNoEXIF},
+		{"truncated", truncated[:40], exif.ErrInvalid},
+	}
+
+	for _, test := range tests {
+		if _, err := exif.Decode(bytes.NewReader(test.Data)); err != test.ExpectedError {
+			t.Errorf("%s: wrong error %v", test.Name, err)
+		}
+	}
+}
+
+func FuzzDecode(f *testing.F) {
+	fixture, err := os.ReadFile("../../test/fixtures/fixture.jpg")
+	if err != nil {
+		f.Fatal(err)
+	}
+	f.Add(fixture)
+
+	focalLength := make([]byte, 8)
+	binary.BigEndian.PutUint32(focalLength, 35)
+	binary.BigEndian.PutUint32(focalLength[4:], 2)
+
+	for _, order := range []binary.ByteOrder{binary.LittleEndian, binary.BigEndian} {
+		f.Add(buildJPEG(order, []ifdEntry{ascii(0x010e, "A lake in the mountains"), ascii(0x0110, "Canon EOS 5D")}, []ifdEntry{
+			ascii(0x9003, "2015:06:02 14:30:00"),
+			ascii(0x9011, "+02:00"),
+			{tag: 0x920a, typ: 5, count: 1, value: focalLength},
+		}))
+	}
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		metadata, err := exif.Decode(bytes.NewReader(data))
+		switch err {
+		case nil:
+			if metadata == nil {
+				t.Error("no metadata without an error")
+			}
+		case exif.ErrNotJPEG, exif.ErrNoEXIF, exif.ErrInvalid:
+		default:
+			t.Errorf("unexpected error %v", err)
+		}
+	})
+}
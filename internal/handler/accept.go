@@ -0,0 +1,91 @@
+package handler
+
+import (
+	"strconv"
+	"strings"
+)
+
+// mediaRange is a media range of an Accept header, e.g. text/* with its quality value
+type mediaRange struct {
+	mediaType string
+	subtype   string
+	quality   float64
+}
+
+// specificity returns how specific the media range is for the media type, or -1 if it doesn't match it
+// An exact match is more specific than type/*, which is more specific than */*
+func (m mediaRange) specificity(mediaType, subtype string) int {
+	switch {
+	case m.mediaType == mediaType && m.subtype == subtype:
+		return 2
+	case m.mediaType == mediaType && m.subtype == "*":
+		return 1
+	case m.mediaType == "*" && m.subtype == "*":
+		return 0
+	}
+
+	return -1
+}
+
+// parseAccept parses the media ranges of Accept header values, skipping invalid ones
+func parseAccept(values []string) []mediaRange {
+	var ranges []mediaRange
+	for _, value := range values {
+		for _, element := range strings.Split(value, ",") {
+			mediaType, parameters, _ := strings.Cut(element, ";")
+
+			typ, subtype, ok := strings.Cut(strings.ToLower(strings.TrimSpace(mediaType)), "/")
+			if !ok || typ == "" || subtype == "" || (typ == "*" && subtype != "*") {
+				continue
+			}
+
+			m := mediaRange{mediaType: typ, subtype: subtype, quality: 1}
+			valid := true
+			for _, parameter := range strings.Split(parameters, ";") {
+				name, value, _ := strings.Cut(strings.TrimSpace(parameter), "=")
+				if !strings.EqualFold(name, "q") {
+					continue
+				}
+
+				quality, err := strconv.ParseFloat(value, 64)
+				if err != nil || quality < 0 || quality > 1 {
+					valid = false
+					break
+				}
+
+				m.quality = quality
+			}
+
+			if valid {
+				ranges = append(ranges, m)
+			}
+		}
+	}
+
+	return ranges
+}
+
+// negotiate returns the offered media type the client prefers according to its Accept header values
+// Offers are preferred in order when the client accepts several equally, and the first offer is returned if it accepts none
+func negotiate(accept []string, offers []string) string {
+	ranges := parseAccept(accept)
+
+	best, bestQuality := offers[0], 0.0
+	for _, offer := range offers {
+		typ, subtype, _ := strings.Cut(offer, "/")
+
+		// The quality of the offer is that of the most specific media range matching it
+		quality, specificity := 0.0, -1
+		for _, m := range ranges {
+			if s := m.specificity(typ, subtype); s > specificity {
+				quality, specificity = m.quality, s
+			}
+		}
+
+		if quality > bestQuality {
+			best, bestQuality = offer, quality
+		}
+	}
+
+	return best
+}
@@ -3,12 +3,16 @@ package handler
 import (
 	"encoding/json"
 	"net/http"
+	"strings"
 )
 
 // Error is the message and http status code to return
 type Error struct {
 	Message string
 	Code    int
+	// The machine-readable code of the error that clients can match on, e.g. invalid_size
+	// Defaults to a code for the http status code, e.g. bad_request
+	ErrorCode string
 }
 
 // InternalServerError is a convenience function for returning an internal server error
@@ -27,7 +31,56 @@ func BadRequest(message string) *Error {
 	}
 }
 
-const jsonMediaType = "application/json"
+// ErrorCodes are the machine-readable codes of errors, that clients can match on instead of the messages
+type ErrorCodes map[error]string
+
+// New returns an error response with the http status code, and the message and code of the error
+func (c ErrorCodes) New(code int, err error) *Error {
+	return &Error{
+		Message:   err.Error(),
+		Code:      code,
+		ErrorCode: c[err],
+	}
+}
+
+// BadRequest returns a bad request error response for the error
+func (c ErrorCodes) BadRequest(err error) *Error {
+	return c.New(http.StatusBadRequest, err)
+}
+
+// NotFound returns a not found error response for the error
+func (c ErrorCodes) NotFound(err error) *Error {
+	return c.New(http.StatusNotFound, err)
+}
+
+// code returns the machine-readable code of the error
+func (e *Error) code() string {
+	if e.ErrorCode != "" {
+		return e.ErrorCode
+	}
+
+	return strings.ReplaceAll(strings.ToLower(http.StatusText(e.Code)), " ", "_")
+}
+
+// Problem is an RFC 9457 problem details object, describing an error
+type Problem struct {
+	Type   string `json:"type"`
+	Title  string `json:"title"`
+	Status int    `json:"status"`
+	Detail string `json:"detail"`
+	Code   string `json:"code"`
+	// The detail, for clients of the previous {"error": "..."} responses
+	Error string `json:"error"`
+}
+
+const (
+	textMediaType    = "text/plain"
+	jsonMediaType    = "application/json"
+	problemMediaType = "application/problem+json"
+)
+
+// errorMediaTypes are the media types errors can be returned as, in order of preference when the client accepts several equally
+var errorMediaTypes = []string{textMediaType, problemMediaType, jsonMediaType}
 
 // Handler wraps a http handler and deals with responding to errors
 type Handler func(w http.ResponseWriter, r *http.Request) *Error
@@ -37,19 +90,26 @@ func (h Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	if err != nil {
 		w.Header().Set("Cache-Control", "private, no-cache, no-store, must-revalidate")
 
-		if r.Header.Get("accept") == jsonMediaType {
-			var data = struct {
-				Error string `json:"error"`
-			}{err.Message}
-
-			w.Header().Set("Content-Type", "application/json")
-			w.WriteHeader(err.Code)
-			if err := json.NewEncoder(w).Encode(data); err != nil {
-				http.Error(w, "Something went wrong", http.StatusInternalServerError)
-				return
-			}
-		} else {
+		mediaType := negotiate(r.Header.Values("Accept"), errorMediaTypes)
+		if mediaType == textMediaType {
 			http.Error(w, err.Message, err.Code)
+			return
+		}
+
+		problem := Problem{
+			Type:   "about:blank",
+			Title:  http.StatusText(err.Code),
+			Status: err.Code,
+			Detail: err.Message,
+			Code:   err.code(),
+			Error:  err.Message,
+		}
+
+		w.Header().Set("Content-Type", mediaType)
+		w.WriteHeader(err.Code)
+		if err := json.NewEncoder(w).Encode(problem); err != nil {
+			http.Error(w, "Something went wrong", http.StatusInternalServerError)
+			return
 		}
 	}
 }
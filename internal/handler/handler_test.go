@@ -1,6 +1,7 @@
 package handler_test
 
 import (
+	"errors"
 	"io"
 	"net/http"
 	"net/http/httptest"
@@ -20,9 +21,23 @@ func TestHandler(t *testing.T) {
 		Handler             handler.Handler
 	}{
 		{"internal server error", "text/html", "text/plain; charset=utf-8", http.StatusInternalServerError, []byte("Something went wrong\n"), errorHandler},
-		{"internal server error json", "application/json", "application/json", http.StatusInternalServerError, []byte("{\"error\":\"Something went wrong\"}\n"), errorHandler},
+		{"internal server error json", "application/json", "application/json", http.StatusInternalServerError, []byte(`{"type":"about:blank","title":"Internal Server Error","status":500,"detail":"Something went wrong","code":"internal_server_error","error":"Something went wrong"}` + "\n"), errorHandler},
 		{"bad request", "text/html", "text/plain; charset=utf-8", http.StatusBadRequest, []byte("Bad request test\n"), badRequestHandler},
-		{"bad request json", "application/json", "application/json", http.StatusBadRequest, []byte("{\"error\":\"Bad request test\"}\n"), badRequestHandler},
+		{"bad request json", "application/json", "application/json", http.StatusBadRequest, []byte(`{"type":"about:blank","title":"Bad Request","status":400,"detail":"Bad request test","code":"bad_request","error":"Bad request test"}` + "\n"), badRequestHandler},
+		{"error code problem json", "application/problem+json", "application/problem+json", http.StatusBadRequest, []byte(`{"type":"about:blank","title":"Bad Request","status":400,"detail":"Invalid size","code":"invalid_size","error":"Invalid size"}` + "\n"), errorCodeHandler},
+
+		// Accept negotiation
+		{"no accept header", "", "text/plain; charset=utf-8", http.StatusBadRequest, []byte("Invalid size\n"), errorCodeHandler},
+		{"wildcard", "*/*", "text/plain; charset=utf-8", http.StatusBadRequest, []byte("Invalid size\n"), errorCodeHandler},
+		{"browser", "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8", "text/plain; charset=utf-8", http.StatusBadRequest, []byte("Invalid size\n"), errorCodeHandler},
+		{"json with parameters", "application/json; charset=utf-8", "application/json", http.StatusBadRequest, []byte(`{"type":"about:blank","title":"Bad Request","status":400,"detail":"Invalid size","code":"invalid_size","error":"Invalid size"}` + "\n"), errorCodeHandler},
+		{"json in a list", "text/html;q=0.5, application/json", "application/json", http.StatusBadRequest, []byte(`{"type":"about:blank","title":"Bad Request","status":400,"detail":"Invalid size","code":"invalid_size","error":"Invalid size"}` + "\n"), errorCodeHandler},
+		{"json with wildcard", "application/json, */*;q=0.1", "application/json", http.StatusBadRequest, []byte(`{"type":"about:blank","title":"Bad Request","status":400,"detail":"Invalid size","code":"invalid_size","error":"Invalid size"}` + "\n"), errorCodeHandler},
+		{"problem json preferred", "application/json;q=0.9, application/problem+json", "application/problem+json", http.StatusBadRequest, []byte(`{"type":"about:blank","title":"Bad Request","status":400,"detail":"Invalid size","code":"invalid_size","error":"Invalid size"}` + "\n"), errorCodeHandler},
+		{"application wildcard", "application/*", "application/problem+json", http.StatusBadRequest, []byte(`{"type":"about:blank","title":"Bad Request","status":400,"detail":"Invalid size","code":"invalid_size","error":"Invalid size"}` + "\n"), errorCodeHandler},
+		{"text excluded", "text/*;q=0, */*", "application/problem+json", http.StatusBadRequest, []byte(`{"type":"about:blank","title":"Bad Request","status":400,"detail":"Invalid size","code":"invalid_size","error":"Invalid size"}` + "\n"), errorCodeHandler},
+		{"invalid quality", "application/json;q=2, text/plain;q=0.1", "text/plain; charset=utf-8", http.StatusBadRequest, []byte("Invalid size\n"), errorCodeHandler},
+		{"nothing acceptable", "image/png", "text/plain; charset=utf-8", http.StatusBadRequest, []byte("Invalid size\n"), errorCodeHandler},
 	}
 
 	for _, test := range tests {
@@ -35,7 +50,9 @@ func TestHandler(t *testing.T) {
 			continue
 		}
 
-		req.Header.Set("Accept", test.AcceptHeader)
+		if test.AcceptHeader != "" {
+			req.Header.Set("Accept", test.AcceptHeader)
+		}
 
 		res, err := http.DefaultClient.Do(req)
 		if err != nil {
@@ -76,3 +93,12 @@ func errorHandler(rw http.ResponseWriter, req *http.Request) *handler.Error {
 func badRequestHandler(rw http.ResponseWriter, req *http.Request) *handler.Error {
 	return handler.BadRequest("Bad request test")
 }
+
+var (
+	errInvalidSize = errors.New("Invalid size")
+	errorCodes     = handler.ErrorCodes{errInvalidSize: "invalid_size"}
+)
+
+func errorCodeHandler(rw http.ResponseWriter, req *http.Request) *handler.Error {
+	return errorCodes.BadRequest(errInvalidSize)
+}
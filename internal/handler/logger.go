@@ -3,6 +3,7 @@ package handler
 import (
 	"fmt"
 	"net/http"
+	"net/url"
 
 	"github.com/DMarby/picsum-photos/internal/logger"
 	"github.com/DMarby/picsum-photos/internal/tracing"
@@ -25,7 +26,7 @@ func Logger(log *logger.Logger, h http.Handler) http.Handler {
 			"http-method", r.Method,
 			"remote-addr", r.RemoteAddr,
 			"user-agent", r.UserAgent(),
-			"uri", r.URL.String(),
+			"uri", redactURI(r.URL),
 			"status-code", respMetrics.Code,
 			"elapsed", fmt.Sprintf("%.9fs", respMetrics.Duration.Seconds()),
 		}
@@ -39,6 +40,29 @@ func Logger(log *logger.Logger, h http.Handler) http.Handler {
 	})
 }
 
+// redactedQueryParams are the query parameters that contain secrets, like API keys, that mustn't be logged
+var redactedQueryParams = []string{"key"}
+
+// redactURI returns the URI of the request, with the values of the query parameters containing secrets redacted
+func redactURI(u *url.URL) string {
+	query := u.Query()
+	redacted := false
+	for _, param := range redactedQueryParams {
+		if query.Has(param) {
+			query.Set(param, "REDACTED")
+			redacted = true
+		}
+	}
+
+	if !redacted {
+		return u.String()
+	}
+
+	redactedURL := *u
+	redactedURL.RawQuery = query.Encode()
+	return redactedURL.String()
+}
+
 // LogFields logs the given keys and values for a request
 func LogFields(r *http.Request, keysAndValues ...interface{}) []interface{} {
 	ctx := r.Context()
@@ -0,0 +1,39 @@
+package handler_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/DMarby/picsum-photos/internal/handler"
+	"github.com/DMarby/picsum-photos/internal/logger"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestLogger(t *testing.T) {
+	tests := []struct {
+		URL         string
+		ExpectedURI string
+	}{
+		{"/id/1/200/300?grayscale", "/id/1/200/300?grayscale"},
+		{"/id/1/200/300?grayscale&key=secret", "/id/1/200/300?grayscale=&key=REDACTED"},
+	}
+
+	for _, test := range tests {
+		core, logs := observer.New(zapcore.DebugLevel)
+		log := &logger.Logger{SugaredLogger: zap.New(core).Sugar()}
+
+		handler.Logger(log, http.NotFoundHandler()).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", test.URL, nil))
+
+		entries := logs.All()
+		if len(entries) != 1 {
+			t.Fatalf("%s: wrong log entries %#v", test.URL, entries)
+		}
+
+		if uri := entries[0].ContextMap()["uri"]; uri != test.ExpectedURI {
+			t.Errorf("%s: wrong uri %#v", test.URL, uri)
+		}
+	}
+}
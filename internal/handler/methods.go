@@ -0,0 +1,54 @@
+package handler
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// methods are the methods checked when building the Allow header
+var methods = []string{http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete}
+
+// MethodNotAllowed returns a handler for requests with a method the route doesn't support
+// OPTIONS requests are answered with the allowed methods, and other requests with a 405 and the allowed methods in the Allow header
+// Requests for paths without any routes are passed to notFound
+// It's meant to be used as both the NotFoundHandler and MethodNotAllowedHandler, as mux reports method mismatches in subrouters as not found
+func MethodNotAllowed(router *mux.Router, notFound http.Handler) http.Handler {
+	return Handler(func(w http.ResponseWriter, r *http.Request) *Error {
+		allowed := allowedMethods(router, r)
+		if len(allowed) == 0 {
+			notFound.ServeHTTP(w, r)
+			return nil
+		}
+
+		w.Header().Set("Allow", strings.Join(append(allowed, http.MethodOptions), ", "))
+
+		if r.Method == http.MethodOptions {
+			w.Header().Set("Cache-Control", "private, no-cache, no-store, must-revalidate")
+			w.WriteHeader(http.StatusNoContent)
+			return nil
+		}
+
+		return &Error{
+			Message: "Method not allowed",
+			Code:    http.StatusMethodNotAllowed,
+		}
+	})
+}
+
+// allowedMethods returns the methods the router supports for the path of the request
+func allowedMethods(router *mux.Router, r *http.Request) []string {
+	var allowed []string
+	for _, method := range methods {
+		methodRequest := r.Clone(r.Context())
+		methodRequest.Method = method
+
+		var routeMatch mux.RouteMatch
+		if router.Match(methodRequest, &routeMatch) && routeMatch.MatchErr == nil {
+			allowed = append(allowed, method)
+		}
+	}
+
+	return allowed
+}
@@ -0,0 +1,58 @@
+package handler_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/DMarby/picsum-photos/internal/handler"
+	"github.com/gorilla/mux"
+)
+
+func TestMethodNotAllowed(t *testing.T) {
+	router := mux.NewRouter()
+	router.NotFoundHandler = handler.MethodNotAllowed(router, http.NotFoundHandler())
+	router.MethodNotAllowedHandler = router.NotFoundHandler
+
+	router.HandleFunc("/get", okHandler).Methods("GET", "HEAD")
+	router.HandleFunc("/post", okHandler).Methods("POST")
+
+	// Method mismatches in subrouters matching every path are reported as not found by mux
+	subrouter := router.PathPrefix("").Subrouter()
+	subrouter.HandleFunc("/subrouter", okHandler).Methods("GET")
+
+	tests := []struct {
+		Name           string
+		Method         string
+		URL            string
+		ExpectedStatus int
+		ExpectedAllow  string
+	}{
+		{"allowed method", "GET", "/get", http.StatusOK, ""},
+		{"options", "OPTIONS", "/get", http.StatusNoContent, "GET, HEAD, OPTIONS"},
+		{"method not allowed", "POST", "/get", http.StatusMethodNotAllowed, "GET, HEAD, OPTIONS"},
+		{"method not allowed", "GET", "/post", http.StatusMethodNotAllowed, "POST, OPTIONS"},
+		{"method not allowed in subrouter", "POST", "/subrouter", http.StatusMethodNotAllowed, "GET, OPTIONS"},
+		{"not found", "GET", "/nonexistant", http.StatusNotFound, ""},
+		{"not found", "OPTIONS", "/nonexistant", http.StatusNotFound, ""},
+	}
+
+	for _, test := range tests {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(test.Method, test.URL, nil)
+		router.ServeHTTP(w, req)
+
+		if w.Code != test.ExpectedStatus {
+			t.Errorf("%s %s: wrong status code %#v", test.Method, test.URL, w.Code)
+			continue
+		}
+
+		if allow := w.Header().Get("Allow"); allow != test.ExpectedAllow {
+			t.Errorf("%s %s: wrong Allow header %#v", test.Method, test.URL, allow)
+		}
+	}
+}
+
+func okHandler(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusOK)
+}
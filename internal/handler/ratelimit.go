@@ -0,0 +1,313 @@
+package handler
+
+import (
+	"expvar"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/felixge/httpsnoop"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	rateLimitBuckets = expvar.NewInt("gauge_rate_limit_buckets")
+
+	rateLimitedRequestsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Subsystem: "http",
+		Name:      "rate_limited_requests_total",
+	}, []string{"budget"})
+)
+
+func init() {
+	registry.MustRegister(rateLimitedRequestsTotal)
+}
+
+// How often buckets that have refilled are removed
+const rateLimitSweepInterval = time.Minute
+
+// Budget is a token bucket allowing bursts of Burst requests, refilled at Rate requests per second
+type Budget struct {
+	Name  string
+	Rate  float64
+	Burst int
+	// Shared budgets have a single bucket for all clients, e.g. the budget of an API key, instead of one per client IP
+	Shared bool
+}
+
+// NewBudget returns a budget, or nil to not limit requests if the rate or burst isn't positive
+func NewBudget(name string, rate float64, burst int) *Budget {
+	if rate <= 0 || burst <= 0 {
+		return nil
+	}
+
+	return &Budget{Name: name, Rate: rate, Burst: burst}
+}
+
+// RateLimits are the budgets of a service, with image processing limited separately from cheaper requests
+type RateLimits struct {
+	Limiter *RateLimiter
+	// Redirects is the budget of routes that redirect to images or return metadata, or nil to not limit them
+	Redirects *Budget
+	// Images is the budget of routes that process images, or nil to not limit them
+	Images *Budget
+}
+
+// bucketKey identifies the bucket of a client for a budget, with the zero client for shared budgets
+type bucketKey struct {
+	budget string
+	client netip.Prefix
+}
+
+type bucket struct {
+	budget  *Budget
+	tokens  float64
+	updated time.Time
+}
+
+// refill adds the tokens accumulated since the bucket was last updated
+func (b *bucket) refill(now time.Time) {
+	b.tokens = math.Min(b.tokens+now.Sub(b.updated).Seconds()*b.budget.Rate, float64(b.budget.Burst))
+	b.updated = now
+}
+
+// RateLimiter limits the requests of each client IP with a token bucket per budget
+type RateLimiter struct {
+	trustedProxies []netip.Prefix
+
+	mu        sync.Mutex
+	buckets   map[bucketKey]*bucket
+	lastSweep time.Time
+}
+
+// NewRateLimiter returns a rate limiter, trusting the proxies to set the client IP with the X-Forwarded-For header
+// Requests over unix sockets come from a local proxy, and are always trusted
+func NewRateLimiter(trustedProxies []netip.Prefix) *RateLimiter {
+	return &RateLimiter{
+		trustedProxies: trustedProxies,
+		buckets:        map[bucketKey]*bucket{},
+		lastSweep:      time.Now(),
+	}
+}
+
+// ParseTrustedProxies parses a comma separated list of IPs and CIDR prefixes
+func ParseTrustedProxies(value string) ([]netip.Prefix, error) {
+	var prefixes []netip.Prefix
+	for _, proxy := range strings.Split(value, ",") {
+		proxy = strings.TrimSpace(proxy)
+		if proxy == "" {
+			continue
+		}
+
+		if addr, err := netip.ParseAddr(proxy); err == nil {
+			prefixes = append(prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+			continue
+		}
+
+		prefix, err := netip.ParsePrefix(proxy)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %s", proxy)
+		}
+
+		prefixes = append(prefixes, prefix.Masked())
+	}
+
+	return prefixes, nil
+}
+
+// take takes a token from the bucket of the client, returning whether the request is allowed, the remaining tokens,
+// and how long until the bucket is full again or has a token
+func (l *RateLimiter) take(budget *Budget, client netip.Addr, now time.Time) (allowed bool, remaining int, reset, retryAfter time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.sweep(now)
+
+	key := bucketKey{budget: budget.Name, client: clientPrefix(client)}
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{budget: budget, tokens: float64(budget.Burst), updated: now}
+		l.buckets[key] = b
+		rateLimitBuckets.Add(1)
+	}
+
+	b.refill(now)
+
+	allowed = b.tokens >= 1
+	if allowed {
+		b.tokens--
+	}
+
+	reset = secondsToDuration((float64(budget.Burst) - b.tokens) / budget.Rate)
+	retryAfter = secondsToDuration((1 - b.tokens) / budget.Rate)
+
+	return allowed, int(b.tokens), reset, retryAfter
+}
+
+// sweep removes the buckets that have refilled, as they're the same as new buckets
+func (l *RateLimiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < rateLimitSweepInterval {
+		return
+	}
+	l.lastSweep = now
+
+	for key, b := range l.buckets {
+		if b.refill(now); b.tokens >= float64(b.budget.Burst) {
+			delete(l.buckets, key)
+			rateLimitBuckets.Add(-1)
+		}
+	}
+}
+
+// clientIP returns the IP of the client, from the X-Forwarded-For header if the request comes from a trusted proxy
+// The header is read from the right, as the proxies append the address they received the request from
+func (l *RateLimiter) clientIP(r *http.Request) (netip.Addr, bool) {
+	client, err := netip.ParseAddrPort(r.RemoteAddr)
+	isUnixSocket := err != nil
+	if !isUnixSocket && !l.isTrusted(client.Addr()) {
+		return client.Addr().Unmap(), true
+	}
+
+	forwardedFor := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(forwardedFor) - 1; i >= 0; i-- {
+		addr, err := netip.ParseAddr(strings.TrimSpace(forwardedFor[i]))
+		if err != nil {
+			break
+		}
+
+		if !l.isTrusted(addr) {
+			return addr.Unmap(), true
+		}
+	}
+
+	// The request is from a trusted proxy itself, or it didn't forward a valid client IP
+	if isUnixSocket {
+		return netip.Addr{}, false
+	}
+
+	return client.Addr().Unmap(), true
+}
+
+// clientPrefix returns the prefix of the addresses a client is limited by, with the zero prefix for the zero client
+// IPv6 clients are limited by their /64 prefix, as they're usually assigned all of its addresses and could rotate through them
+func clientPrefix(client netip.Addr) netip.Prefix {
+	if !client.IsValid() {
+		return netip.Prefix{}
+	}
+
+	bits := 32
+	if client.Is6() {
+		bits = 64
+	}
+
+	prefix, _ := client.Prefix(bits)
+	return prefix
+}
+
+func (l *RateLimiter) isTrusted(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	for _, prefix := range l.trustedProxies {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// RateLimit is a handler that limits the requests of each client to the budget of the route
+// budget returns the budget of a request to a route, or nil to not limit it
+// Requests over unix sockets without a forwarded client IP aren't limited by per-client budgets, so that the clients of the local proxy don't share a budget
+// Requests from a trusted proxy over TCP without a forwarded client IP are limited by the IP of the proxy, so all of its clients share its budget
+func RateLimit(limiter *RateLimiter, h http.Handler, routeMatcher RouteMatcher, budget func(r *http.Request, route string) *Budget) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		routeBudget := budget(r, routeMatcher.Match(r))
+		if routeBudget == nil {
+			h.ServeHTTP(w, r)
+			return
+		}
+
+		var client netip.Addr
+		if !routeBudget.Shared {
+			var ok bool
+			if client, ok = limiter.clientIP(r); !ok {
+				h.ServeHTTP(w, r)
+				return
+			}
+		}
+
+		allowed, remaining, reset, retryAfter := limiter.take(routeBudget, client, time.Now())
+
+		// The standard rate limit headers, from draft-ietf-httpapi-ratelimit-headers
+		w.Header().Set("RateLimit-Limit", strconv.Itoa(routeBudget.Burst))
+		w.Header().Set("RateLimit-Remaining", strconv.Itoa(remaining))
+		w.Header().Set("RateLimit-Reset", strconv.Itoa(ceilSeconds(reset)))
+		w.Header().Set("RateLimit-Policy", fmt.Sprintf("%d;w=%d", routeBudget.Burst, ceilSeconds(secondsToDuration(float64(routeBudget.Burst)/routeBudget.Rate))))
+
+		if allowed {
+			h.ServeHTTP(withoutPublicRateLimitHeaders(w), r)
+			return
+		}
+
+		rateLimitedRequestsTotal.WithLabelValues(routeBudget.Name).Inc()
+
+		Handler(func(w http.ResponseWriter, r *http.Request) *Error {
+			w.Header().Set("Retry-After", strconv.Itoa(ceilSeconds(retryAfter)))
+			return &Error{
+				Message:   "Too many requests",
+				Code:      http.StatusTooManyRequests,
+				ErrorCode: "rate_limited",
+			}
+		}).ServeHTTP(w, r)
+	})
+}
+
+// rateLimitHeaders are the headers describing the budget of the client
+var rateLimitHeaders = []string{"RateLimit-Limit", "RateLimit-Remaining", "RateLimit-Reset", "RateLimit-Policy"}
+
+// withoutPublicRateLimitHeaders removes the rate limit headers from responses that can be cached publicly,
+// as a shared cache would replay the budget of one client to every client
+func withoutPublicRateLimitHeaders(w http.ResponseWriter) http.ResponseWriter {
+	removeHeaders := func() {
+		if strings.HasPrefix(w.Header().Get("Cache-Control"), "public") {
+			for _, header := range rateLimitHeaders {
+				w.Header().Del(header)
+			}
+		}
+	}
+
+	return httpsnoop.Wrap(w, httpsnoop.Hooks{
+		WriteHeader: func(next httpsnoop.WriteHeaderFunc) httpsnoop.WriteHeaderFunc {
+			return func(code int) {
+				removeHeaders()
+				next(code)
+			}
+		},
+		Write: func(next httpsnoop.WriteFunc) httpsnoop.WriteFunc {
+			return func(b []byte) (int, error) {
+				removeHeaders()
+				return next(b)
+			}
+		},
+		ReadFrom: func(next httpsnoop.ReadFromFunc) httpsnoop.ReadFromFunc {
+			return func(src io.Reader) (int64, error) {
+				removeHeaders()
+				return next(src)
+			}
+		},
+	})
+}
+
+func secondsToDuration(seconds float64) time.Duration {
+	return time.Duration(math.Max(seconds, 0) * float64(time.Second))
+}
+
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
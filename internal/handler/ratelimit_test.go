@@ -0,0 +1,169 @@
+package handler_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"reflect"
+	"strconv"
+	"testing"
+
+	"github.com/DMarby/picsum-photos/internal/handler"
+)
+
+// pathRouteMatcher matches routes by their path
+type pathRouteMatcher struct{}
+
+func (pathRouteMatcher) Match(r *http.Request) string {
+	return r.URL.Path
+}
+
+func TestRateLimit(t *testing.T) {
+	trustedProxies, err := handler.ParseTrustedProxies("10.0.0.0/8, 2001:db8::1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Budgets that don't refill during the test
+	redirects := &handler.Budget{Name: "redirects", Rate: 0.001, Burst: 2}
+	images := &handler.Budget{Name: "images", Rate: 0.001, Burst: 1}
+
+	shared := &handler.Budget{Name: "shared", Rate: 0.001, Burst: 2, Shared: true}
+
+	budgets := map[string]*handler.Budget{"/redirect": redirects, "/image": images, "/shared": shared}
+	h := handler.RateLimit(handler.NewRateLimiter(trustedProxies), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}), pathRouteMatcher{}, func(r *http.Request, route string) *handler.Budget {
+		return budgets[route]
+	})
+
+	tests := []struct {
+		Name              string
+		Path              string
+		RemoteAddr        string
+		ForwardedFor      string
+		ExpectedStatus    int
+		ExpectedRemaining string
+	}{
+		{"first request", "/redirect", "192.0.2.1:1234", "", http.StatusOK, "1"},
+		{"second request", "/redirect", "192.0.2.1:1234", "", http.StatusOK, "0"},
+		{"limited", "/redirect", "192.0.2.1:1234", "", http.StatusTooManyRequests, "0"},
+		{"separate budget", "/image", "192.0.2.1:1234", "", http.StatusOK, "0"},
+		{"separate budget limited", "/image", "192.0.2.1:1234", "", http.StatusTooManyRequests, "0"},
+		{"other client", "/image", "192.0.2.2:1234", "", http.StatusOK, "0"},
+		{"ipv6 client", "/image", "[2001:db8::2]:1234", "", http.StatusOK, "0"},
+		{"ipv6 client limited", "/image", "[2001:db8::2]:1234", "", http.StatusTooManyRequests, "0"},
+		{"ipv6 client in the same /64 limited", "/image", "[2001:db8::3]:1234", "", http.StatusTooManyRequests, "0"},
+		{"ipv6 client in another /64", "/image", "[2001:db8:0:1::2]:1234", "", http.StatusOK, "0"},
+		{"unlimited route", "/info", "192.0.2.1:1234", "", http.StatusOK, ""},
+
+		// Forwarded client IPs
+		{"forwarded by trusted proxy", "/image", "10.0.0.1:1234", "192.0.2.3, 10.0.0.2", http.StatusOK, "0"},
+		{"forwarded by other trusted proxy", "/image", "10.0.0.3:1234", "192.0.2.3", http.StatusTooManyRequests, "0"},
+		{"forwarded by trusted ipv6 proxy", "/image", "[2001:db8::1]:1234", "192.0.2.4", http.StatusOK, "0"},
+		{"forwarded by untrusted proxy", "/image", "192.0.2.5:1234", "192.0.2.4", http.StatusOK, "0"},
+		{"spoofed forwarded ip", "/image", "10.0.0.1:1234", "192.0.2.6, 192.0.2.4", http.StatusTooManyRequests, "0"},
+		{"forwarded over unix socket", "/image", "@", "192.0.2.7", http.StatusOK, "0"},
+		{"forwarded over unix socket limited", "/image", "@", "192.0.2.7", http.StatusTooManyRequests, "0"},
+		{"unknown client over unix socket", "/image", "@", "", http.StatusOK, ""},
+		{"invalid forwarded ip over unix socket", "/image", "@", "unknown", http.StatusOK, ""},
+
+		// Shared budgets
+		{"shared budget", "/shared", "192.0.2.1:1234", "", http.StatusOK, "1"},
+		{"shared budget other client", "/shared", "192.0.2.2:1234", "", http.StatusOK, "0"},
+		{"shared budget limited", "/shared", "192.0.2.3:1234", "", http.StatusTooManyRequests, "0"},
+	}
+
+	for _, test := range tests {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", test.Path, nil)
+		req.RemoteAddr = test.RemoteAddr
+		if test.ForwardedFor != "" {
+			req.Header.Set("X-Forwarded-For", test.ForwardedFor)
+		}
+
+		h.ServeHTTP(w, req)
+
+		if w.Code != test.ExpectedStatus {
+			t.Errorf("%s: wrong response code, %#v", test.Name, w.Code)
+			continue
+		}
+
+		if remaining := w.Header().Get("RateLimit-Remaining"); remaining != test.ExpectedRemaining {
+			t.Errorf("%s: wrong remaining requests, %#v", test.Name, remaining)
+		}
+
+		if w.Code != http.StatusTooManyRequests {
+			continue
+		}
+
+		if retryAfter, err := strconv.Atoi(w.Header().Get("Retry-After")); err != nil || retryAfter < 1 {
+			t.Errorf("%s: wrong retry after, %#v", test.Name, w.Header().Get("Retry-After"))
+		}
+
+		if w.Body.String() != "Too many requests\n" || w.Header().Get("Cache-Control") != "private, no-cache, no-store, must-revalidate" {
+			t.Errorf("%s: wrong response %s", test.Name, w.Body.String())
+		}
+	}
+
+	t.Run("headers", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "/redirect", nil)
+		req.RemoteAddr = "192.0.2.100:1234"
+		h.ServeHTTP(w, req)
+
+		expectedHeaders := map[string]string{
+			"RateLimit-Limit":     "2",
+			"RateLimit-Remaining": "1",
+			"RateLimit-Reset":     "1000",
+			"RateLimit-Policy":    "2;w=2000",
+		}
+
+		for name, expected := range expectedHeaders {
+			if value := w.Header().Get(name); value != expected {
+				t.Errorf("wrong %s header %#v", name, value)
+			}
+		}
+	})
+
+	t.Run("no headers on public responses", func(t *testing.T) {
+		h := handler.RateLimit(handler.NewRateLimiter(nil), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Cache-Control", "public, max-age=60")
+			w.Write([]byte("public"))
+		}), pathRouteMatcher{}, func(r *http.Request, route string) *handler.Budget {
+			return redirects
+		})
+
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "/redirect", nil)
+		req.RemoteAddr = "192.0.2.101:1234"
+		h.ServeHTTP(w, req)
+
+		for _, name := range []string{"RateLimit-Limit", "RateLimit-Remaining", "RateLimit-Reset", "RateLimit-Policy"} {
+			if value := w.Header().Get(name); value != "" {
+				t.Errorf("unexpected %s header %#v", name, value)
+			}
+		}
+	})
+}
+
+func TestParseTrustedProxies(t *testing.T) {
+	prefixes, err := handler.ParseTrustedProxies("10.0.0.0/8,192.0.2.1, 2001:db8::/32,")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []netip.Prefix{
+		netip.MustParsePrefix("10.0.0.0/8"),
+		netip.MustParsePrefix("192.0.2.1/32"),
+		netip.MustParsePrefix("2001:db8::/32"),
+	}
+
+	if !reflect.DeepEqual(prefixes, expected) {
+		t.Errorf("wrong prefixes %v", prefixes)
+	}
+
+	if _, err := handler.ParseTrustedProxies("10.0.0.0/8,proxy"); err == nil {
+		t.Error("expected an error for an invalid proxy")
+	}
+}
@@ -4,16 +4,159 @@ import (
 	cryptoHMAC "crypto/hmac"
 	"crypto/sha256"
 	"encoding/base64"
+	"expvar"
+	"fmt"
+	"strings"
+)
+
+var (
+	keyValidations        = expvar.NewMap("counter_labelmap_kid_hmac_key_validations")
+	retiredKeyValidations = expvar.NewMap("counter_labelmap_kid_hmac_retired_key_validations")
 )
 
 // HMAC is a utility for creating and verifying HMACs
+// It holds a keyring of keys identified by a key ID, so that the key can be rotated without invalidating signed URLs
 type HMAC struct {
+	// Key is the key without a key ID, from before the keyring, used to sign when there's no active key
 	Key []byte
+	// Keys are the keys of the keyring, by their key ID
+	Keys map[string][]byte
+	// ActiveKeyID is the ID of the key to sign with, or empty to sign with Key
+	ActiveKeyID string
+	// Retired are the IDs of the keys that are no longer accepted, with the empty ID retiring Key
+	// Retired keys are kept in the keyring to count the requests that still use them
+	Retired map[string]bool
+}
+
+// New returns a HMAC with the keyring for signing and validating, returning an error if a key is missing, or the active key is retired
+// Either the key without a key ID or the active key ID has to be set, to have a key to sign with
+func New(key []byte, keys map[string][]byte, activeKeyID string, retired []string) (*HMAC, error) {
+	h, err := newKeyring(key, keys, retired)
+	if err != nil {
+		return nil, err
+	}
+	h.ActiveKeyID = activeKeyID
+
+	if _, ok := h.key(activeKeyID); !ok {
+		if activeKeyID == "" {
+			return nil, fmt.Errorf("no key to sign with, set either the key or the active key id")
+		}
+
+		return nil, fmt.Errorf("active key %s is missing from the keyring", activeKeyID)
+	}
+
+	if h.Retired[activeKeyID] {
+		return nil, fmt.Errorf("active key %s is retired", printableKeyID(activeKeyID))
+	}
+
+	return h, nil
+}
+
+// NewValidator returns a HMAC with the keyring for services that only validate, which can retire all the keys they don't accept
+// At least one key has to be set, returning an error if there are none, or a retired key is missing
+func NewValidator(key []byte, keys map[string][]byte, retired []string) (*HMAC, error) {
+	h, err := newKeyring(key, keys, retired)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(h.Key) == 0 && len(h.Keys) == 0 {
+		return nil, fmt.Errorf("no keys to validate with, set either the key or the keys")
+	}
+
+	return h, nil
+}
+
+// newKeyring returns a HMAC with the keyring and the retired keys, treating an empty key as no key
+func newKeyring(key []byte, keys map[string][]byte, retired []string) (*HMAC, error) {
+	h := &HMAC{
+		Key:     key,
+		Keys:    keys,
+		Retired: map[string]bool{},
+	}
+
+	for _, keyID := range retired {
+		if _, ok := h.key(keyID); !ok {
+			return nil, fmt.Errorf("retired key %s is missing from the keyring", printableKeyID(keyID))
+		}
+
+		h.Retired[keyID] = true
+	}
+
+	return h, nil
+}
+
+// ParseKeys parses a comma separated list of keys with their key ID, e.g. 2024-q1:secret,2024-q2:secret
+func ParseKeys(value string) (map[string][]byte, error) {
+	keys := map[string][]byte{}
+	for i, pair := range strings.Split(value, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+
+		// The error doesn't include the pair, to not log the key
+		keyID, key, ok := strings.Cut(pair, ":")
+		if !ok || keyID == "" || key == "" {
+			return nil, fmt.Errorf("invalid key %d, expected {key id}:{key}", i+1)
+		}
+
+		if _, ok := keys[keyID]; ok {
+			return nil, fmt.Errorf("duplicate key id %s", keyID)
+		}
+
+		keys[keyID] = []byte(key)
+	}
+
+	return keys, nil
 }
 
-// Create creates a HMAC based on the parameter values, encoded as urlsafe base64
+// ParseKeyIDs parses a comma separated list of key IDs, with none for Key
+func ParseKeyIDs(value string) []string {
+	var keyIDs []string
+	for _, keyID := range strings.Split(value, ",") {
+		keyID = strings.TrimSpace(keyID)
+		switch keyID {
+		case "":
+			continue
+		case "none":
+			keyID = ""
+		}
+
+		keyIDs = append(keyIDs, keyID)
+	}
+
+	return keyIDs
+}
+
+// key returns the key with the key ID, or Key for the empty key ID
+// Empty keys are treated as missing, so that nothing is signed or validated with them
+func (h *HMAC) key(keyID string) ([]byte, bool) {
+	key := h.Key
+	if keyID != "" {
+		key = h.Keys[keyID]
+	}
+
+	return key, len(key) > 0
+}
+
+// Create creates a HMAC based on the parameter values with the active key, encoded as urlsafe base64
+// The message should include the active key ID, so that it's validated with the same key
 func (h *HMAC) Create(message string) (string, error) {
-	mac := cryptoHMAC.New(sha256.New, h.Key)
+	key, ok := h.key(h.ActiveKeyID)
+	if !ok {
+		return "", fmt.Errorf("active key %s is missing from the keyring", printableKeyID(h.ActiveKeyID))
+	}
+
+	if h.Retired[h.ActiveKeyID] {
+		return "", fmt.Errorf("active key %s is retired", printableKeyID(h.ActiveKeyID))
+	}
+
+	return create(key, message)
+}
+
+func create(key []byte, message string) (string, error) {
+	mac := cryptoHMAC.New(sha256.New, key)
 
 	_, err := mac.Write([]byte(message))
 	if err != nil {
@@ -23,12 +166,38 @@ func (h *HMAC) Create(message string) (string, error) {
 	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil)), nil
 }
 
-// Validate validates that the parameter values matches a given HMAC
-func (h *HMAC) Validate(message, mac string) (bool, error) {
-	expectedMAC, err := h.Create(message)
+// Validate validates that the parameter values matches a given HMAC, created with the key with the key ID
+// HMACs created with keys that are unknown or retired aren't valid
+func (h *HMAC) Validate(keyID, message, mac string) (bool, error) {
+	key, ok := h.key(keyID)
+	if !ok {
+		return false, nil
+	}
+
+	expectedMAC, err := create(key, message)
 	if err != nil {
 		return false, err
 	}
 
-	return cryptoHMAC.Equal([]byte(mac), []byte(expectedMAC)), nil
+	if !cryptoHMAC.Equal([]byte(mac), []byte(expectedMAC)) {
+		return false, nil
+	}
+
+	// Count which keys are still in use, to know when a key can be retired, and if it was retired too soon
+	if h.Retired[keyID] {
+		retiredKeyValidations.Add(printableKeyID(keyID), 1)
+		return false, nil
+	}
+
+	keyValidations.Add(printableKeyID(keyID), 1)
+	return true, nil
+}
+
+// printableKeyID returns the key ID to use in the metrics and errors, with none for Key
+func printableKeyID(keyID string) string {
+	if keyID == "" {
+		return "none"
+	}
+
+	return keyID
 }
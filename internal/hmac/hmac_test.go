@@ -1,6 +1,11 @@
 package hmac_test
 
 import (
+	cryptoHMAC "crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"expvar"
+	"reflect"
 	"testing"
 
 	"github.com/DMarby/picsum-photos/internal/hmac"
@@ -19,7 +24,7 @@ func TestHMAC(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	matches, err := h.Validate(message, mac)
+	matches, err := h.Validate("", message, mac)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -28,7 +33,7 @@ func TestHMAC(t *testing.T) {
 		t.Error("hmac does not match")
 	}
 
-	matches, err = h.Validate("doesnotmatch", mac)
+	matches, err = h.Validate("", "doesnotmatch", mac)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -37,3 +42,134 @@ func TestHMAC(t *testing.T) {
 		t.Error("hmac matches when it should not")
 	}
 }
+
+func TestKeyring(t *testing.T) {
+	keys := map[string][]byte{"q1": []byte("q1-secret"), "q2": []byte("q2-secret")}
+
+	before := &hmac.HMAC{Key: key}
+	oldMAC, _ := before.Create(message)
+
+	first, err := hmac.New(key, keys, "q1", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	q1MAC, _ := first.Create(message)
+
+	// Rotate to q2, retiring the key from before the keyring
+	h, err := hmac.New(key, keys, "q2", []string{""})
+	if err != nil {
+		t.Fatal(err)
+	}
+	q2MAC, _ := h.Create(message)
+
+	tests := []struct {
+		Name     string
+		KeyID    string
+		MAC      string
+		Expected bool
+	}{
+		{"active key", "q2", q2MAC, true},
+		{"previous key", "q1", q1MAC, true},
+		{"wrong key id", "q2", q1MAC, false},
+		{"unknown key id", "q3", q2MAC, false},
+		{"retired key", "", oldMAC, false},
+	}
+
+	for _, test := range tests {
+		valid, err := h.Validate(test.KeyID, message, test.MAC)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if valid != test.Expected {
+			t.Errorf("%s: wrong validity %t", test.Name, valid)
+		}
+	}
+
+	if validations := expvar.Get("counter_labelmap_kid_hmac_key_validations").(*expvar.Map).Get("q1"); validations == nil || validations.String() != "1" {
+		t.Errorf("wrong validations of q1 %v", validations)
+	}
+
+	if validations := expvar.Get("counter_labelmap_kid_hmac_retired_key_validations").(*expvar.Map).Get("none"); validations == nil || validations.String() != "1" {
+		t.Errorf("wrong validations of the retired key %v", validations)
+	}
+}
+
+func TestNewErrors(t *testing.T) {
+	keys := map[string][]byte{"q1": []byte("q1-secret")}
+
+	tests := []struct {
+		Name        string
+		Key         []byte
+		ActiveKeyID string
+		Retired     []string
+	}{
+		{"missing active key", key, "q2", nil},
+		{"retired active key", key, "q1", []string{"q1"}},
+		{"missing retired key", key, "q1", []string{"q0"}},
+		{"retired key without a key id", key, "", []string{""}},
+		{"no key to sign with", nil, "", nil},
+		{"empty key to sign with", []byte{}, "", nil},
+		{"retired empty key", []byte{}, "q1", []string{""}},
+	}
+
+	for _, test := range tests {
+		if _, err := hmac.New(test.Key, keys, test.ActiveKeyID, test.Retired); err == nil {
+			t.Errorf("%s: expected an error", test.Name)
+		}
+	}
+}
+
+func TestNewValidator(t *testing.T) {
+	keys := map[string][]byte{"q1": []byte("q1-secret")}
+
+	// Services that only validate can retire the key without a key ID, but can't sign with it
+	h, err := hmac.NewValidator(key, keys, []string{""})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := h.Create(message); err == nil {
+		t.Error("expected an error signing with a retired key")
+	}
+
+	if _, err := hmac.NewValidator(nil, nil, nil); err == nil {
+		t.Error("expected an error without keys")
+	}
+
+	// An empty key without a key ID isn't used to validate
+	h, err = hmac.NewValidator([]byte{}, keys, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mac := cryptoHMAC.New(sha256.New, []byte{})
+	mac.Write([]byte(message))
+	emptyKeyMAC := base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+	if valid, err := h.Validate("", message, emptyKeyMAC); err != nil || valid {
+		t.Errorf("wrong validity with an empty key %t %v", valid, err)
+	}
+}
+
+func TestParseKeyIDs(t *testing.T) {
+	if keyIDs := hmac.ParseKeyIDs("q1, none,,q2"); !reflect.DeepEqual(keyIDs, []string{"q1", "", "q2"}) {
+		t.Errorf("wrong key ids %#v", keyIDs)
+	}
+}
+
+func TestParseKeys(t *testing.T) {
+	keys, err := hmac.ParseKeys("q1:secret, q2:other:secret,")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if expected := map[string][]byte{"q1": []byte("secret"), "q2": []byte("other:secret")}; !reflect.DeepEqual(keys, expected) {
+		t.Errorf("wrong keys %v", keys)
+	}
+
+	for _, value := range []string{"secret", "q1:", ":secret", "q1:a,q1:b"} {
+		if _, err := hmac.ParseKeys(value); err == nil {
+			t.Errorf("%s: expected an error", value)
+		}
+	}
+}
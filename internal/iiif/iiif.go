@@ -0,0 +1,319 @@
+package iiif
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/DMarby/picsum-photos/internal/image"
+)
+
+// Errors
+var (
+	ErrInvalidRegion   = fmt.Errorf("Invalid region")
+	ErrInvalidSize     = fmt.Errorf("Invalid size")
+	ErrInvalidRotation = fmt.Errorf("Invalid rotation")
+	ErrInvalidQuality  = fmt.Errorf("Invalid quality")
+	ErrInvalidFormat   = fmt.Errorf("Invalid format")
+)
+
+const (
+	// Context is the JSON-LD context of the IIIF Image API 3.0
+	Context = "http://iiif.io/api/image/3/context.json"
+	// Protocol is the protocol URI of the IIIF Image API
+	Protocol = "http://iiif.io/api/image"
+)
+
+// Info is the image information of an image, for info.json
+type Info struct {
+	Context        string   `json:"@context"`
+	ID             string   `json:"id"`
+	Type           string   `json:"type"`
+	Protocol       string   `json:"protocol"`
+	Profile        string   `json:"profile"`
+	Width          int      `json:"width"`
+	Height         int      `json:"height"`
+	MaxWidth       int      `json:"maxWidth"`
+	MaxHeight      int      `json:"maxHeight"`
+	ExtraQualities []string `json:"extraQualities"`
+	ExtraFormats   []string `json:"extraFormats"`
+	ExtraFeatures  []string `json:"extraFeatures"`
+}
+
+// NewInfo returns the image information for an image with the base URI id, limited to maxSize in each dimension
+func NewInfo(id string, width, height, maxSize int) *Info {
+	return &Info{
+		Context:        Context,
+		ID:             id,
+		Type:           "ImageService3",
+		Protocol:       Protocol,
+		Profile:        "level1",
+		Width:          width,
+		Height:         height,
+		MaxWidth:       maxSize,
+		MaxHeight:      maxSize,
+		ExtraQualities: []string{"color", "gray"},
+		ExtraFormats:   []string{"webp", "avif"},
+		// Level 2 also requires PNG, which isn't supported, so the level 2 features are listed instead
+		ExtraFeatures: []string{"regionByPct", "sizeByPct", "sizeByConfinedWh", "rotationBy90s", "mirroring", "sizeUpscaling"},
+	}
+}
+
+// Request is an IIIF image request, with the region and size resolved to pixels for an image
+type Request struct {
+	// The region of the image, in pixels of the image
+	Region image.Region
+	// Whether the region is the full image
+	Full bool
+	// The size of the returned image, before rotation
+	Width  int
+	Height int
+	// Clockwise rotation in degrees, one of 0, 90, 180 and 270
+	Rotation int
+	// Whether the image is mirrored before it's rotated
+	Mirror    bool
+	Grayscale bool
+	// The file extension of the format, .jpg, .webp or .avif
+	Extension string
+}
+
+// Parse parses the region, size, rotation, quality and format of an IIIF image request for an image of the given size
+// The size of the returned image is limited to maxSize in each dimension
+func Parse(region, size, rotation, quality, format string, imageWidth, imageHeight, maxSize int) (*Request, error) {
+	request := &Request{}
+
+	var err error
+	if request.Region, request.Full, err = parseRegion(region, imageWidth, imageHeight); err != nil {
+		return nil, err
+	}
+
+	if request.Width, request.Height, err = parseSize(size, request.Region.Width, request.Region.Height, maxSize); err != nil {
+		return nil, err
+	}
+
+	if request.Rotation, request.Mirror, err = parseRotation(rotation); err != nil {
+		return nil, err
+	}
+
+	switch quality {
+	case "default", "color":
+	case "gray":
+		request.Grayscale = true
+	default:
+		return nil, ErrInvalidQuality
+	}
+
+	switch format {
+	case "jpg", "webp", "avif":
+		request.Extension = "." + format
+	default:
+		return nil, ErrInvalidFormat
+	}
+
+	return request, nil
+}
+
+// Distorted returns whether the size of the request changes the aspect ratio of the region
+func (r *Request) Distorted() bool {
+	height := int(math.Round(float64(r.Region.Height) * float64(r.Width) / float64(r.Region.Width)))
+	return math.Abs(float64(r.Height-height)) > 1
+}
+
+// parseRegion parses a region of full, square, x,y,w,h or pct:x,y,w,h, and clips it to the image
+func parseRegion(value string, imageWidth, imageHeight int) (region image.Region, full bool, err error) {
+	switch {
+	case value == "full":
+		return image.Region{Width: imageWidth, Height: imageHeight}, true, nil
+	case value == "square":
+		side := min(imageWidth, imageHeight)
+		region = image.Region{X: (imageWidth - side) / 2, Y: (imageHeight - side) / 2, Width: side, Height: side}
+	case strings.HasPrefix(value, "pct:"):
+		values, ok := parseFloats(strings.TrimPrefix(value, "pct:"), 4)
+		if !ok {
+			return image.Region{}, false, ErrInvalidRegion
+		}
+
+		// Validate the percentages before converting them to pixels, so that they can't overflow
+		for _, v := range values {
+			if v > 100 {
+				return image.Region{}, false, ErrInvalidRegion
+			}
+		}
+
+		region = image.Region{
+			X:      int(math.Round(values[0] * float64(imageWidth) / 100)),
+			Y:      int(math.Round(values[1] * float64(imageHeight) / 100)),
+			Width:  int(math.Round(values[2] * float64(imageWidth) / 100)),
+			Height: int(math.Round(values[3] * float64(imageHeight) / 100)),
+		}
+	default:
+		values, ok := parseFloats(value, 4)
+		if !ok {
+			return image.Region{}, false, ErrInvalidRegion
+		}
+
+		for _, v := range values {
+			if v != math.Trunc(v) || v > math.MaxInt32 {
+				return image.Region{}, false, ErrInvalidRegion
+			}
+		}
+
+		region = image.Region{X: int(values[0]), Y: int(values[1]), Width: int(values[2]), Height: int(values[3])}
+	}
+
+	// Clip the region to the image
+	if region.X >= imageWidth || region.Y >= imageHeight || region.Width < 1 || region.Height < 1 {
+		return image.Region{}, false, ErrInvalidRegion
+	}
+
+	region.Width = min(region.Width, imageWidth-region.X)
+	region.Height = min(region.Height, imageHeight-region.Y)
+
+	full = region == image.Region{Width: imageWidth, Height: imageHeight}
+
+	return region, full, nil
+}
+
+// parseSize parses a size of max, w,, ,h, pct:n, w,h or !w,h, optionally prefixed by ^ to allow upscaling, for a region of the given size
+func parseSize(value string, regionWidth, regionHeight, maxSize int) (width, height int, err error) {
+	upscale := strings.HasPrefix(value, "^")
+	value = strings.TrimPrefix(value, "^")
+
+	switch {
+	case value == "max":
+		// Scale down to fit the max size, or up to it if upscaling is allowed
+		scale := float64(maxSize) / float64(max(regionWidth, regionHeight))
+		if !upscale {
+			scale = math.Min(scale, 1)
+		}
+
+		width, height, err = scaleDimensions(regionWidth, regionHeight, scale, maxSize)
+	case strings.HasPrefix(value, "pct:"):
+		values, ok := parseFloats(strings.TrimPrefix(value, "pct:"), 1)
+		if !ok || values[0] <= 0 || (values[0] > 100 && !upscale) {
+			return 0, 0, ErrInvalidSize
+		}
+
+		width, height, err = scaleDimensions(regionWidth, regionHeight, values[0]/100, maxSize)
+	case strings.HasPrefix(value, "!"):
+		values, ok := parseInts(strings.TrimPrefix(value, "!"))
+		if !ok || values[0] < 1 || values[1] < 1 {
+			return 0, 0, ErrInvalidSize
+		}
+
+		// Scale to fit within the width and height, without exceeding the region unless upscaling is allowed
+		scale := math.Min(float64(values[0])/float64(regionWidth), float64(values[1])/float64(regionHeight))
+		if !upscale {
+			scale = math.Min(scale, 1)
+		}
+
+		width, height, err = scaleDimensions(regionWidth, regionHeight, scale, maxSize)
+	default:
+		values, ok := parseInts(value)
+		if !ok {
+			return 0, 0, ErrInvalidSize
+		}
+
+		width, height = values[0], values[1]
+		switch {
+		case width > 0 && height > 0:
+		case width > 0 && height == -1:
+			_, height, err = scaleDimensions(regionWidth, regionHeight, float64(width)/float64(regionWidth), maxSize)
+		case width == -1 && height > 0:
+			width, _, err = scaleDimensions(regionWidth, regionHeight, float64(height)/float64(regionHeight), maxSize)
+		default:
+			return 0, 0, ErrInvalidSize
+		}
+	}
+
+	if err != nil {
+		return 0, 0, err
+	}
+
+	if !upscale && (width > regionWidth || height > regionHeight) {
+		return 0, 0, ErrInvalidSize
+	}
+
+	if width > maxSize || height > maxSize {
+		return 0, 0, ErrInvalidSize
+	}
+
+	return width, height, nil
+}
+
+// parseRotation parses a rotation of 0, 90, 180 or 270 degrees, optionally prefixed by ! to mirror the image
+func parseRotation(value string) (rotation int, mirror bool, err error) {
+	mirror = strings.HasPrefix(value, "!")
+
+	degrees, err := strconv.ParseFloat(strings.TrimPrefix(value, "!"), 64)
+	if err != nil {
+		return 0, false, ErrInvalidRotation
+	}
+
+	// Only rotation by multiples of 90 degrees is supported
+	switch degrees {
+	case 0, 90, 180, 270:
+		return int(degrees), mirror, nil
+	case 360:
+		return 0, mirror, nil
+	default:
+		return 0, false, ErrInvalidRotation
+	}
+}
+
+// scaleDimensions scales the width and height, to at least 1 pixel, returning an error if either exceeds the max size
+func scaleDimensions(width, height int, scale float64, maxSize int) (int, int, error) {
+	// Check the max size before converting, as huge scales overflow int
+	scaledWidth, scaledHeight := math.Round(float64(width)*scale), math.Round(float64(height)*scale)
+	if scaledWidth > float64(maxSize) || scaledHeight > float64(maxSize) {
+		return 0, 0, ErrInvalidSize
+	}
+
+	return max(int(scaledWidth), 1), max(int(scaledHeight), 1), nil
+}
+
+// parseFloats parses count comma separated non-negative finite numbers
+func parseFloats(value string, count int) ([]float64, bool) {
+	parts := strings.Split(value, ",")
+	if len(parts) != count {
+		return nil, false
+	}
+
+	values := make([]float64, count)
+	for i, part := range parts {
+		v, err := strconv.ParseFloat(part, 64)
+		if err != nil || v < 0 || math.IsInf(v, 0) || math.IsNaN(v) {
+			return nil, false
+		}
+
+		values[i] = v
+	}
+
+	return values, true
+}
+
+// parseInts parses a w,h pair of sizes, where either can be empty and is returned as -1
+func parseInts(value string) ([2]int, bool) {
+	width, height, ok := strings.Cut(value, ",")
+	if !ok {
+		return [2]int{}, false
+	}
+
+	var values [2]int
+	for i, part := range []string{width, height} {
+		if part == "" {
+			values[i] = -1
+			continue
+		}
+
+		v, err := strconv.Atoi(part)
+		if err != nil || v < 1 {
+			return [2]int{}, false
+		}
+
+		values[i] = v
+	}
+
+	return values, true
+}
@@ -0,0 +1,75 @@
+package iiif_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/DMarby/picsum-photos/internal/iiif"
+	"github.com/DMarby/picsum-photos/internal/image"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		Name             string
+		Region           string
+		Size             string
+		Rotation         string
+		Quality          string
+		Format           string
+		ExpectedRequest  *iiif.Request
+		ExpectedError    error
+		ExpectDistortion bool
+	}{
+		{"full max", "full", "max", "0", "default", "jpg", &iiif.Request{Region: image.Region{Width: 1200, Height: 800}, Full: true, Width: 1000, Height: 667, Extension: ".jpg"}, nil, false},
+		{"upscaled max", "full", "^max", "0", "default", "jpg", &iiif.Request{Region: image.Region{Width: 1200, Height: 800}, Full: true, Width: 1000, Height: 667, Extension: ".jpg"}, nil, false},
+		{"square", "square", "max", "0", "default", "jpg", &iiif.Request{Region: image.Region{X: 200, Width: 800, Height: 800}, Width: 800, Height: 800, Extension: ".jpg"}, nil, false},
+		{"pixel region", "100,100,200,100", "max", "0", "default", "jpg", &iiif.Request{Region: image.Region{X: 100, Y: 100, Width: 200, Height: 100}, Width: 200, Height: 100, Extension: ".jpg"}, nil, false},
+		{"clipped region", "1100,700,200,200", "max", "0", "default", "jpg", &iiif.Request{Region: image.Region{X: 1100, Y: 700, Width: 100, Height: 100}, Width: 100, Height: 100, Extension: ".jpg"}, nil, false},
+		{"full pixel region", "0,0,1200,800", "max", "0", "default", "jpg", &iiif.Request{Region: image.Region{Width: 1200, Height: 800}, Full: true, Width: 1000, Height: 667, Extension: ".jpg"}, nil, false},
+		{"percent region", "pct:25,25,50,50", "max", "0", "default", "jpg", &iiif.Request{Region: image.Region{X: 300, Y: 200, Width: 600, Height: 400}, Width: 600, Height: 400, Extension: ".jpg"}, nil, false},
+		{"width", "full", "600,", "0", "default", "jpg", &iiif.Request{Region: image.Region{Width: 1200, Height: 800}, Full: true, Width: 600, Height: 400, Extension: ".jpg"}, nil, false},
+		{"height", "full", ",400", "0", "default", "jpg", &iiif.Request{Region: image.Region{Width: 1200, Height: 800}, Full: true, Width: 600, Height: 400, Extension: ".jpg"}, nil, false},
+		{"percent size", "full", "pct:25", "0", "default", "jpg", &iiif.Request{Region: image.Region{Width: 1200, Height: 800}, Full: true, Width: 300, Height: 200, Extension: ".jpg"}, nil, false},
+		{"best fit", "full", "!300,300", "0", "default", "jpg", &iiif.Request{Region: image.Region{Width: 1200, Height: 800}, Full: true, Width: 300, Height: 200, Extension: ".jpg"}, nil, false},
+		{"distorted", "full", "300,300", "0", "default", "jpg", &iiif.Request{Region: image.Region{Width: 1200, Height: 800}, Full: true, Width: 300, Height: 300, Extension: ".jpg"}, nil, true},
+		{"upscaled", "10,10,100,100", "^200,", "0", "default", "jpg", &iiif.Request{Region: image.Region{X: 10, Y: 10, Width: 100, Height: 100}, Width: 200, Height: 200, Extension: ".jpg"}, nil, false},
+		{"mirrored rotation", "full", "600,", "!270", "gray", "webp", &iiif.Request{Region: image.Region{Width: 1200, Height: 800}, Full: true, Width: 600, Height: 400, Rotation: 270, Mirror: true, Grayscale: true, Extension: ".webp"}, nil, false},
+
+		// Errors
+		{"region outside image", "1200,0,10,10", "max", "0", "default", "jpg", nil, iiif.ErrInvalidRegion, false},
+		{"empty region", "0,0,0,10", "max", "0", "default", "jpg", nil, iiif.ErrInvalidRegion, false},
+		{"fractional region", "0.5,0,10,10", "max", "0", "default", "jpg", nil, iiif.ErrInvalidRegion, false},
+		{"invalid region", "0,0,10", "max", "0", "default", "jpg", nil, iiif.ErrInvalidRegion, false},
+		{"percent region over 100", "pct:0,0,101,50", "max", "0", "default", "jpg", nil, iiif.ErrInvalidRegion, false},
+		{"infinite percent region", "pct:0,0,Inf,50", "max", "0", "default", "jpg", nil, iiif.ErrInvalidRegion, false},
+		{"huge percent region", "pct:0,0,1e300,50", "max", "0", "default", "jpg", nil, iiif.ErrInvalidRegion, false},
+		{"huge region", "1e300,0,10,10", "max", "0", "default", "jpg", nil, iiif.ErrInvalidRegion, false},
+		{"upscaling without ^", "10,10,100,100", "200,", "0", "default", "jpg", nil, iiif.ErrInvalidSize, false},
+		{"larger then max size", "full", "^1200,", "0", "default", "jpg", nil, iiif.ErrInvalidSize, false},
+		{"percent size over 100", "full", "pct:101", "0", "default", "jpg", nil, iiif.ErrInvalidSize, false},
+		{"huge percent size", "full", "pct:1e300", "0", "default", "jpg", nil, iiif.ErrInvalidSize, false},
+		{"huge upscaled percent size", "full", "^pct:1e300", "0", "default", "jpg", nil, iiif.ErrInvalidSize, false},
+		{"upscaled percent size", "10,10,100,100", "^pct:200", "0", "default", "jpg", &iiif.Request{Region: image.Region{X: 10, Y: 10, Width: 100, Height: 100}, Width: 200, Height: 200, Extension: ".jpg"}, nil, false},
+		{"invalid size", "full", ",", "0", "default", "jpg", nil, iiif.ErrInvalidSize, false},
+		{"invalid rotation", "full", "max", "45", "default", "jpg", nil, iiif.ErrInvalidRotation, false},
+		{"invalid quality", "full", "max", "0", "bitonal", "jpg", nil, iiif.ErrInvalidQuality, false},
+		{"invalid format", "full", "max", "0", "default", "png", nil, iiif.ErrInvalidFormat, false},
+	}
+
+	for _, test := range tests {
+		request, err := iiif.Parse(test.Region, test.Size, test.Rotation, test.Quality, test.Format, 1200, 800, 1000)
+		if err != test.ExpectedError {
+			t.Errorf("%s: wrong error %v", test.Name, err)
+			continue
+		}
+
+		if !reflect.DeepEqual(request, test.ExpectedRequest) {
+			t.Errorf("%s: wrong request %#v", test.Name, request)
+			continue
+		}
+
+		if request != nil && request.Distorted() != test.ExpectDistortion {
+			t.Errorf("%s: wrong distortion %t", test.Name, request.Distorted())
+		}
+	}
+}
@@ -8,10 +8,22 @@ type Task struct {
 	ApplyBlur      bool
 	BlurAmount     int
 	ApplyGrayscale bool
+	Region         *Region
+	Rotation       int
+	ApplyMirror    bool
+	CacheKey       string
 	UserComment    string
 	OutputFormat   OutputFormat
 }
 
+// Region is a region of an image, in pixels of the original image
+type Region struct {
+	X      int
+	Y      int
+	Width  int
+	Height int
+}
+
 // OutputFormat is the image format to output to
 type OutputFormat int
 
@@ -20,6 +32,8 @@ const (
 	JPEG OutputFormat = iota
 	// WebP represents the WebP format
 	WebP
+	// AVIF represents the AVIF format
+	AVIF
 )
 
 // NewTask creates a new image processing task
@@ -45,3 +59,27 @@ func (t *Task) Grayscale() *Task {
 	t.ApplyGrayscale = true
 	return t
 }
+
+// Crop crops the original image to the region, before resizing it to the width and height of the task
+func (t *Task) Crop(region Region) *Task {
+	t.Region = &region
+	return t
+}
+
+// Mirror mirrors the image horizontally
+func (t *Task) Mirror() *Task {
+	t.ApplyMirror = true
+	return t
+}
+
+// Rotate rotates the image clockwise by a multiple of 90 degrees, after mirroring it
+func (t *Task) Rotate(degrees int) *Task {
+	t.Rotation = degrees
+	return t
+}
+
+// Cache caches the processed image under the key, for images that are requested repeatedly
+func (t *Task) Cache(key string) *Task {
+	t.CacheKey = key
+	return t
+}
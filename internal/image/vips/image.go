@@ -1,6 +1,9 @@
 package vips
 
-import "github.com/DMarby/picsum-photos/internal/vips"
+import (
+	"github.com/DMarby/picsum-photos/internal/image"
+	"github.com/DMarby/picsum-photos/internal/vips"
+)
 
 // resizedImage is a resized image
 type resizedImage struct {
@@ -21,6 +24,44 @@ func resizeImage(buffer []byte, width int, height int) (*resizedImage, error) {
 	}, nil
 }
 
+// cropImage loads an image from a byte buffer, crops it to the region and resizes the region to the width and height
+// Note that it does not use the processor worker queue, use ProcessImage for that
+func cropImage(buffer []byte, region image.Region, width int, height int) (*resizedImage, error) {
+	image, err := vips.CropImage(buffer, region.X, region.Y, region.Width, region.Height, width, height)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &resizedImage{
+		vipsImage: image,
+	}, nil
+}
+
+// mirror mirrors an image horizontally
+func (i *resizedImage) mirror() (*resizedImage, error) {
+	image, err := vips.Mirror(i.vipsImage)
+	if err != nil {
+		return nil, err
+	}
+
+	return &resizedImage{
+		vipsImage: image,
+	}, nil
+}
+
+// rotate rotates an image clockwise by a multiple of 90 degrees
+func (i *resizedImage) rotate(degrees int) (*resizedImage, error) {
+	image, err := vips.Rotate(i.vipsImage, degrees)
+	if err != nil {
+		return nil, err
+	}
+
+	return &resizedImage{
+		vipsImage: image,
+	}, nil
+}
+
 // grayscale turns an image into grayscale
 func (i *resizedImage) grayscale() (*resizedImage, error) {
 	image, err := vips.Grayscale(i.vipsImage)
@@ -61,6 +102,17 @@ func (i *resizedImage) saveToJpegBuffer() ([]byte, error) {
 	return imageBuffer, nil
 }
 
+// saveToAVIFBuffer returns the image as an AVIF byte buffer
+func (i *resizedImage) saveToAVIFBuffer() ([]byte, error) {
+	imageBuffer, err := vips.SaveToAVIFBuffer(i.vipsImage)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return imageBuffer, nil
+}
+
 // saveToWebPBuffer returns the image as a WebP byte buffer
 func (i *resizedImage) saveToWebPBuffer() ([]byte, error) {
 	imageBuffer, err := vips.SaveToWebPBuffer(i.vipsImage)
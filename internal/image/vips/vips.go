@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"math"
 
+	"github.com/DMarby/picsum-photos/internal/cache"
 	"github.com/DMarby/picsum-photos/internal/image"
 	"github.com/DMarby/picsum-photos/internal/logger"
 	"github.com/DMarby/picsum-photos/internal/queue"
@@ -18,7 +19,10 @@ import (
 // Processor is an image processor that uses vips to process images
 type Processor struct {
 	queue  *queue.Queue
+	log    *logger.Logger
 	tracer *tracing.Tracer
+	// processedCache caches the processed images of tasks with a cache key, such as tiles
+	processedCache cache.Provider
 }
 
 var (
@@ -26,8 +30,8 @@ var (
 	processedImages = expvar.NewMap("counter_labelmap_dimensions_image_processor_processed_images")
 )
 
-// New initializes a new processor instance
-func New(ctx context.Context, log *logger.Logger, tracer *tracing.Tracer, workers int, cache *image.Cache) (*Processor, error) {
+// New initializes a new processor instance, caching the processed images of tasks with a cache key in processedCache
+func New(ctx context.Context, log *logger.Logger, tracer *tracing.Tracer, workers int, cache *image.Cache, processedCache cache.Provider) (*Processor, error) {
 	err := vips.Initialize(log)
 	if err != nil {
 		return nil, err
@@ -35,8 +39,10 @@ func New(ctx context.Context, log *logger.Logger, tracer *tracing.Tracer, worker
 
 	workerQueue := queue.New(ctx, workers, taskProcessor(cache, tracer))
 	instance := &Processor{
-		queue:  workerQueue,
-		tracer: tracer,
+		queue:          workerQueue,
+		log:            log,
+		tracer:         tracer,
+		processedCache: processedCache,
 	}
 
 	go workerQueue.Run()
@@ -56,6 +62,19 @@ func (p *Processor) ProcessImage(ctx context.Context, task *image.Task) (process
 	)
 	defer span.End()
 
+	// Use the cached processed image if there is one
+	// The cache is an optimization, so the image is processed if it fails
+	if task.CacheKey != "" {
+		data, err := p.processedCache.Get(ctx, task.CacheKey)
+		if err == nil {
+			return data, nil
+		}
+
+		if err != cache.ErrNotFound {
+			p.log.Errorw("error getting processed image from cache", "key", task.CacheKey, "error", err)
+		}
+	}
+
 	queueSize.Add(1)
 	defer queueSize.Add(-1)
 
@@ -71,6 +90,12 @@ func (p *Processor) ProcessImage(ctx context.Context, task *image.Task) (process
 		return nil, fmt.Errorf("error getting result")
 	}
 
+	if task.CacheKey != "" {
+		if err := p.processedCache.Set(ctx, task.CacheKey, image); err != nil {
+			p.log.Errorw("error caching processed image", "key", task.CacheKey, "error", err)
+		}
+	}
+
 	return image, nil
 }
 
@@ -82,11 +107,12 @@ func taskProcessor(cache *image.Cache, tracer *tracing.Tracer) func(ctx context.
 		}
 
 		// Use a pre-processed source image closer to the desired size then the original
+		// Regions are in pixels of the original, so cropping always uses the original
 		imageKey := task.ImageID
 		width := math.Ceil(float64(task.Width)/500) * 500
 		height := math.Ceil(float64(task.Height)/500) * 500
 		size := math.Max(width, height)
-		if size <= 4500 { // Files larger then 4500 doesn't have a suffix
+		if size <= 4500 && task.Region == nil { // Files larger then 4500 doesn't have a suffix
 			imageKey = fmt.Sprintf("%s_%0.f", task.ImageID, size)
 		}
 
@@ -95,13 +121,38 @@ func taskProcessor(cache *image.Cache, tracer *tracing.Tracer) func(ctx context.
 			return nil, fmt.Errorf("error getting image from cache: %s", err)
 		}
 
-		_, span := tracer.Start(ctx, "image.resizeImage")
-		processedImage, err := resizeImage(imageBuffer, task.Width, task.Height)
-		span.End()
+		var processedImage *resizedImage
+		if task.Region != nil {
+			_, span := tracer.Start(ctx, "image.cropImage")
+			processedImage, err = cropImage(imageBuffer, *task.Region, task.Width, task.Height)
+			span.End()
+		} else {
+			_, span := tracer.Start(ctx, "image.resizeImage")
+			processedImage, err = resizeImage(imageBuffer, task.Width, task.Height)
+			span.End()
+		}
 		if err != nil {
 			return nil, err
 		}
 
+		if task.ApplyMirror {
+			_, span := tracer.Start(ctx, "image.mirror")
+			processedImage, err = processedImage.mirror()
+			span.End()
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		if task.Rotation != 0 {
+			_, span := tracer.Start(ctx, "image.rotate")
+			processedImage, err = processedImage.rotate(task.Rotation)
+			span.End()
+			if err != nil {
+				return nil, err
+			}
+		}
+
 		if task.ApplyBlur {
 			_, span := tracer.Start(ctx, "image.blur")
 			processedImage, err = processedImage.blur(task.BlurAmount)
@@ -132,6 +183,10 @@ func taskProcessor(cache *image.Cache, tracer *tracing.Tracer) func(ctx context.
 			_, span := tracer.Start(ctx, "image.saveToWebPBuffer")
 			buffer, err = processedImage.saveToWebPBuffer()
 			span.End()
+		case image.AVIF:
+			_, span := tracer.Start(ctx, "image.saveToAVIFBuffer")
+			buffer, err = processedImage.saveToAVIFBuffer()
+			span.End()
 		}
 
 		if err != nil {
@@ -46,6 +46,20 @@ func TestVips(t *testing.T) {
 			}
 		})
 
+		t.Run("process and cache a tile", func(t *testing.T) {
+			task := image.NewTask("1", 256, 256, "testing", image.JPEG).Crop(image.Region{X: 10, Y: 10, Width: 512, Height: 512}).Cache("1_tile_test")
+			tile, err := processor.ProcessImage(context.Background(), task)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// The second request uses the cached tile, even for a task that would fail to process
+			cachedTile, err := processor.ProcessImage(context.Background(), image.NewTask("foo", 256, 256, "testing", image.JPEG).Cache("1_tile_test"))
+			if err != nil || !reflect.DeepEqual(tile, cachedTile) {
+				t.Errorf("tile not cached %s", err)
+			}
+		})
+
 		t.Run("full test jpeg", func(t *testing.T) {
 			resultFixture, _ := os.ReadFile(jpegFixture)
 			testResult := fullTest(processor, buf, image.JPEG)
@@ -117,7 +131,7 @@ func setup() (context.CancelFunc, *vips.Processor, []byte, error) {
 
 	cache := image.NewCache(tracer, memory.New(), storage)
 
-	processor, err := vips.New(ctx, log, tracer, 3, cache)
+	processor, err := vips.New(ctx, log, tracer, 3, cache, memory.New())
 	if err != nil {
 		cancel()
 		return nil, nil, nil, err
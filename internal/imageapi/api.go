@@ -4,6 +4,7 @@ import (
 	"net/http"
 	"time"
 
+	"github.com/DMarby/picsum-photos/internal/database"
 	"github.com/DMarby/picsum-photos/internal/handler"
 	"github.com/DMarby/picsum-photos/internal/hmac"
 	"github.com/DMarby/picsum-photos/internal/tracing"
@@ -21,6 +22,8 @@ type API struct {
 	Tracer         *tracing.Tracer
 	HandlerTimeout time.Duration
 	HMAC           *hmac.HMAC
+	Database       database.Provider   // The image catalogue to look up the author of images in, or nil to not set the attribution headers
+	RateLimits     *handler.RateLimits // Limits the requests of each client to the images budget, if set
 }
 
 // Utility methods for logging
@@ -30,45 +33,71 @@ func (a *API) logError(r *http.Request, message string, err error) {
 
 // Router returns a http router
 func (a *API) Router() http.Handler {
+	router := a.Mux()
+
+	// Set up handlers
+	cors := cors.New(cors.Options{
+		AllowedMethods: []string{"GET", "HEAD"},
+		AllowedOrigins: []string{"*"},
+		ExposedHeaders: []string{"Content-Type", "Link", "Picsum-ID", "Picsum-Author", "Picsum-Author-URL", "RateLimit-Limit", "RateLimit-Remaining", "RateLimit-Reset", "RateLimit-Policy", "Retry-After"},
+	})
+
+	routeMatcher := &handler.MuxRouteMatcher{Router: router}
+
+	// Every route of the image service processes images
+	var httpHandler http.Handler = router
+	if a.RateLimits != nil {
+		httpHandler = handler.RateLimit(a.RateLimits.Limiter, httpHandler, routeMatcher, func(*http.Request, string) *handler.Budget {
+			return a.RateLimits.Images
+		})
+	}
+
+	httpHandler = cors.Handler(httpHandler)
+	httpHandler = handler.Recovery(a.Log, httpHandler)
+	httpHandler = http.TimeoutHandler(httpHandler, a.HandlerTimeout, "Something went wrong. Timed out.")
+	httpHandler = handler.Logger(a.Log, httpHandler)
+
+	httpHandler = handler.Tracer(a.Tracer, httpHandler, routeMatcher)
+	httpHandler = handler.Metrics(httpHandler, routeMatcher)
+
+	return httpHandler
+}
+
+// Mux returns the routes of the api, without the middleware
+func (a *API) Mux() *mux.Router {
 	router := mux.NewRouter()
 
-	router.NotFoundHandler = handler.Handler(a.notFoundHandler)
+	router.NotFoundHandler = handler.MethodNotAllowed(router, handler.Handler(a.notFoundHandler))
+	router.MethodNotAllowedHandler = router.NotFoundHandler
 
 	// Redirect trailing slashes
 	router.StrictSlash(true)
 
 	// Image by ID routes
-	router.Handle("/id/{id}/{width:[0-9]+}/{height:[0-9]+}{extension:\\..*}", handler.Handler(a.imageHandler)).Methods("GET").Name("imageapi.image")
+	router.Handle("/id/{id}/{width:[0-9]+}/{height:[0-9]+}{extension:\\..*}", handler.Handler(a.imageHandler)).Methods("GET", "HEAD").Name("imageapi.image")
 
 	// Query parameters:
 	// ?grayscale - Grayscale the image
 	// ?blur={amount} - Blur the image by {amount}
+	// ?region={x},{y},{width},{height} - Crop the original image to the region before resizing it
+	// ?mirror - Mirror the image horizontally
+	// ?rotate={degrees} - Rotate the image clockwise by 90, 180 or 270 degrees, after mirroring it
 
 	// ?hmac - HMAC signature of the path and URL parameters
 
-	// Set up handlers
-	cors := cors.New(cors.Options{
-		AllowedMethods: []string{"GET"},
-		AllowedOrigins: []string{"*"},
-		ExposedHeaders: []string{"Content-Type", "Picsum-ID"},
-	})
+	// Deep zoom tiles, for an image of {width}x{height}
+	router.Handle("/id/{id}/tiles/{width:[0-9]+}/{height:[0-9]+}/{level:[0-9]+}/{col:[0-9]+}_{row:[0-9]+}.jpg", handler.Handler(a.tileHandler)).Methods("GET", "HEAD").Name("imageapi.tile")
 
-	httpHandler := cors.Handler(router)
-	httpHandler = handler.Recovery(a.Log, httpHandler)
-	httpHandler = http.TimeoutHandler(httpHandler, a.HandlerTimeout, "Something went wrong. Timed out.")
-	httpHandler = handler.Logger(a.Log, httpHandler)
+	// ?hmac - HMAC signature of the path
 
-	routeMatcher := &handler.MuxRouteMatcher{Router: router}
-	httpHandler = handler.Tracer(a.Tracer, httpHandler, routeMatcher)
-	httpHandler = handler.Metrics(httpHandler, routeMatcher)
-
-	return httpHandler
+	return router
 }
 
 // Handle not found errors
 var notFoundError = &handler.Error{
-	Message: "page not found",
-	Code:    http.StatusNotFound,
+	Message:   "page not found",
+	Code:      http.StatusNotFound,
+	ErrorCode: "page_not_found",
 }
 
 func (a *API) notFoundHandler(w http.ResponseWriter, r *http.Request) *handler.Error {
@@ -28,6 +28,8 @@ import (
 
 	memoryCache "github.com/DMarby/picsum-photos/internal/cache/memory"
 
+	fileDatabase "github.com/DMarby/picsum-photos/internal/database/file"
+
 	"testing"
 )
 
@@ -37,11 +39,14 @@ func TestAPI(t *testing.T) {
 
 	log, tracer, imageProcessor, hmac := setup(t, ctx)
 
-	mockStorageImageProcessor, _ := vipsProcessor.New(ctx, log, tracer, 3, image.NewCache(tracer, memoryCache.New(), &mockStorage.Provider{}))
+	mockStorageImageProcessor, _ := vipsProcessor.New(ctx, log, tracer, 3, image.NewCache(tracer, memoryCache.New(), &mockStorage.Provider{}), memoryCache.New())
+
+	db, _ := fileDatabase.New("../../test/fixtures/file/metadata.json")
 
-	router := (&api.API{imageProcessor, log, tracer, time.Minute, hmac}).Router()
-	mockStorageRouter := (&api.API{mockStorageImageProcessor, log, tracer, time.Minute, hmac}).Router()
-	mockProcessorRouter := (&api.API{&mockProcessor.Processor{}, log, tracer, time.Minute, hmac}).Router()
+	router := (&api.API{ImageProcessor: imageProcessor, Log: log, Tracer: tracer, HandlerTimeout: time.Minute, HMAC: hmac, Database: db}).Router()
+	mockStorageRouter := (&api.API{ImageProcessor: mockStorageImageProcessor, Log: log, Tracer: tracer, HandlerTimeout: time.Minute, HMAC: hmac, Database: db}).Router()
+	mockProcessorRouter := (&api.API{ImageProcessor: &mockProcessor.Processor{}, Log: log, Tracer: tracer, HandlerTimeout: time.Minute, HMAC: hmac, Database: db}).Router()
+	noDatabaseRouter := (&api.API{ImageProcessor: &mockProcessor.Processor{}, Log: log, Tracer: tracer, HandlerTimeout: time.Minute, HMAC: hmac}).Router()
 
 	tests := []struct {
 		Name             string
@@ -156,11 +161,143 @@ func TestAPI(t *testing.T) {
 			t.Errorf("%s: wrong image id header, %#v", test.Name, imageID)
 		}
 
+		if author := w.Header().Get("Picsum-Author"); author != "John Doe" {
+			t.Errorf("%s: wrong author header, %#v", test.Name, author)
+		}
+
 		if !reflect.DeepEqual(w.Body.Bytes(), test.ExpectedResponse) {
 			t.Errorf("%s: wrong response/image data", test.Name)
 		}
 	}
 
+	t.Run("HEAD doesn't process the image", func(t *testing.T) {
+		url, err := params.HMAC(hmac, "/id/1/200/120.webp", url.Values{})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("HEAD", url, nil)
+		mockProcessorRouter.ServeHTTP(w, req)
+
+		if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "image/webp" || w.Header().Get("Picsum-ID") != "1" {
+			t.Errorf("wrong response %d %#v", w.Code, w.Header())
+		}
+	})
+
+	t.Run("expiring urls", func(t *testing.T) {
+		for _, path := range []string{"/id/1/200/120.jpg", "/id/1/tiles/300/400/9/0_0.jpg"} {
+			expiredURL, err := params.HMACWithExpiry(hmac, path, url.Values{}, time.Now().Add(-time.Minute))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", expiredURL, nil)
+			mockProcessorRouter.ServeHTTP(w, req)
+
+			if w.Code != http.StatusGone || w.Body.String() != "Link expired\n" {
+				t.Errorf("%s: wrong response %d %s", path, w.Code, w.Body.String())
+			}
+
+			// Images are cached until their url expires
+			expiringURL, err := params.HMACWithExpiry(hmac, path, url.Values{}, time.Now().Add(time.Hour))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			w = httptest.NewRecorder()
+			req, _ = http.NewRequest("HEAD", expiringURL, nil)
+			mockProcessorRouter.ServeHTTP(w, req)
+
+			var maxAge int
+			if _, err := fmt.Sscanf(w.Header().Get("Cache-Control"), "public, max-age=%d", &maxAge); w.Code != http.StatusOK || err != nil || maxAge > 60*60 || maxAge < 60*60-60 {
+				t.Errorf("%s: wrong response %d %#v", path, w.Code, w.Header())
+			}
+		}
+	})
+
+	t.Run("attribution headers", func(t *testing.T) {
+		for _, path := range []string{"/id/1/200/120.jpg", "/id/1/tiles/300/400/9/0_0.jpg"} {
+			url, err := params.HMAC(hmac, path, url.Values{})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("HEAD", url, nil)
+			mockProcessorRouter.ServeHTTP(w, req)
+
+			expectedHeaders := map[string]string{
+				"Picsum-Author":     "John Doe",
+				"Picsum-Author-URL": "https://picsum.photos",
+				"Link":              `<https://picsum.photos>; rel="author"`,
+			}
+
+			for name, expected := range expectedHeaders {
+				if value := w.Header().Get(name); value != expected {
+					t.Errorf("%s: wrong %s header %#v", path, name, value)
+				}
+			}
+		}
+
+		// Authors that aren't printable ASCII are percent-encoded, as header values are decoded as Latin-1 by browsers
+		unicodeDB, _ := fileDatabase.New("../../test/fixtures/file/metadata_unicode.json")
+		unicodeRouter := (&api.API{ImageProcessor: &mockProcessor.Processor{}, Log: log, Tracer: tracer, HandlerTimeout: time.Minute, HMAC: hmac, Database: unicodeDB}).Router()
+
+		unicodeURL, err := params.HMAC(hmac, "/id/1/200/120.jpg", url.Values{})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("HEAD", unicodeURL, nil)
+		unicodeRouter.ServeHTTP(w, req)
+
+		if author := w.Header().Get("Picsum-Author"); author != "Zo%C3%AB Doe" {
+			t.Errorf("wrong author header %#v", author)
+		}
+
+		// Images are still served without the attribution headers when there's no catalogue
+		url, err := params.HMAC(hmac, "/id/1/200/120.jpg", url.Values{})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		w = httptest.NewRecorder()
+		req, _ = http.NewRequest("HEAD", url, nil)
+		noDatabaseRouter.ServeHTTP(w, req)
+
+		if w.Code != http.StatusOK || w.Header().Get("Picsum-Author") != "" || w.Header().Get("Link") != "" {
+			t.Errorf("wrong response %d %#v", w.Code, w.Header())
+		}
+	})
+
+	methodTests := []struct {
+		Name           string
+		Method         string
+		URL            string
+		ExpectedStatus int
+		ExpectedAllow  string
+	}{
+		{"OPTIONS", "OPTIONS", "/id/1/200/120.jpg", http.StatusNoContent, "GET, HEAD, OPTIONS"},
+		{"POST", "POST", "/id/1/200/120.jpg", http.StatusMethodNotAllowed, "GET, HEAD, OPTIONS"},
+	}
+
+	for _, test := range methodTests {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(test.Method, test.URL, nil)
+		router.ServeHTTP(w, req)
+		if w.Code != test.ExpectedStatus {
+			t.Errorf("%s: wrong response code, %#v", test.Name, w.Code)
+			continue
+		}
+
+		if allow := w.Header().Get("Allow"); allow != test.ExpectedAllow {
+			t.Errorf("%s: wrong Allow header, %#v", test.Name, allow)
+		}
+	}
+
 	redirectTests := []struct {
 		Name        string
 		URL         string
@@ -201,7 +338,7 @@ func TestFixtures(t *testing.T) {
 
 	log, tracer, imageProcessor, hmac := setup(t, ctx)
 
-	router := (&api.API{imageProcessor, log, tracer, time.Minute, hmac}).Router()
+	router := (&api.API{ImageProcessor: imageProcessor, Log: log, Tracer: tracer, HandlerTimeout: time.Minute, HMAC: hmac}).Router()
 
 	// JPEG
 	createFixture(router, hmac, "/id/1/200/120.jpg", "width_height", "jpg")
@@ -227,7 +364,7 @@ func setup(t *testing.T, ctx context.Context) (*logger.Logger, *tracing.Tracer,
 	storage, _ := fileStorage.New("../../test/fixtures/file")
 	cache := memoryCache.New()
 	imageCache := image.NewCache(tracer, cache, storage)
-	imageProcessor, _ := vipsProcessor.New(ctx, log, tracer, 3, imageCache)
+	imageProcessor, _ := vipsProcessor.New(ctx, log, tracer, 3, imageCache, memoryCache.New())
 
 	hmac := &hmac.HMAC{
 		Key: []byte("test"),
@@ -0,0 +1,23 @@
+package imageapi
+
+import (
+	"fmt"
+
+	"github.com/DMarby/picsum-photos/internal/dzi"
+	"github.com/DMarby/picsum-photos/internal/handler"
+	"github.com/DMarby/picsum-photos/internal/params"
+)
+
+// ErrInvalidSignature is returned when the HMAC doesn't match the path and query parameters
+var ErrInvalidSignature = fmt.Errorf("Invalid parameters")
+
+// errorCodes are the machine-readable codes of the errors, that clients can match on instead of the messages
+var errorCodes = handler.ErrorCodes{
+	ErrInvalidSignature:            "invalid_signature",
+	params.ErrExpired:              "link_expired",
+	ErrInvalidRegion:               "invalid_region",
+	ErrInvalidRotation:             "invalid_rotation",
+	params.ErrInvalidSize:          "invalid_size",
+	params.ErrInvalidFileExtension: "invalid_file_extension",
+	dzi.ErrTileNotFound:            "tile_not_found",
+}
@@ -4,28 +4,39 @@ import (
 	"fmt"
 	"net/http"
 	"strconv"
+	"strings"
+	"time"
 
+	"github.com/DMarby/picsum-photos/internal/database"
 	"github.com/DMarby/picsum-photos/internal/handler"
 	"github.com/DMarby/picsum-photos/internal/image"
 	"github.com/DMarby/picsum-photos/internal/params"
 	"github.com/gorilla/mux"
 )
 
+// Errors
+var (
+	ErrInvalidRegion   = fmt.Errorf("Invalid region")
+	ErrInvalidRotation = fmt.Errorf("Invalid rotation")
+)
+
 func (a *API) imageHandler(w http.ResponseWriter, r *http.Request) *handler.Error {
 	// Validate the path and query parameters
 	valid, err := params.ValidateHMAC(a.HMAC, r)
-	if err != nil {
+	if err == params.ErrExpired {
+		return errorCodes.New(http.StatusGone, err)
+	} else if err != nil {
 		return handler.InternalServerError()
 	}
 
 	if !valid {
-		return handler.BadRequest("Invalid parameters")
+		return errorCodes.BadRequest(ErrInvalidSignature)
 	}
 
 	// Get the path and query parameters
 	p, err := params.GetParams(r)
 	if err != nil {
-		return handler.BadRequest(err.Error())
+		return errorCodes.BadRequest(err)
 	}
 
 	// Get the image ID from the path param
@@ -42,6 +53,37 @@ func (a *API) imageHandler(w http.ResponseWriter, r *http.Request) *handler.Erro
 		task.Grayscale()
 	}
 
+	// Get the optional region, mirroring and rotation, used for IIIF requests
+	t, err := getTransform(r)
+	if err != nil {
+		return errorCodes.BadRequest(err)
+	}
+
+	if t.region != nil {
+		task.Crop(*t.region)
+	}
+
+	if t.mirror {
+		task.Mirror()
+	}
+
+	if t.rotation != 0 {
+		task.Rotate(t.rotation)
+	}
+
+	// Set the headers
+	w.Header().Set("Content-Disposition", fmt.Sprintf("inline; filename=\"%s\"", buildFilename(imageID, p, t)))
+	w.Header().Set("Content-Type", getContentType(p.Extension))
+	w.Header().Set("Cache-Control", cacheControl(r))
+	w.Header().Set("Picsum-ID", imageID)
+	w.Header().Set("Timing-Allow-Origin", "*") // Allow all origins to see timing resources
+	a.setAttributionHeaders(w, r, imageID)
+
+	// The headers don't depend on the processed image, so don't process it for HEAD requests
+	if r.Method == http.MethodHead {
+		return nil
+	}
+
 	// Process the image
 	processedImage, err := a.ImageProcessor.ProcessImage(r.Context(), task)
 	if err != nil {
@@ -49,13 +91,7 @@ func (a *API) imageHandler(w http.ResponseWriter, r *http.Request) *handler.Erro
 		return handler.InternalServerError()
 	}
 
-	// Set the headers
-	w.Header().Set("Content-Disposition", fmt.Sprintf("inline; filename=\"%s\"", buildFilename(imageID, p)))
-	w.Header().Set("Content-Type", getContentType(p.Extension))
 	w.Header().Set("Content-Length", strconv.Itoa(len(processedImage)))
-	w.Header().Set("Cache-Control", "public, max-age=2592000, stale-while-revalidate=60, stale-if-error=43200, immutable") // Cache for a month
-	w.Header().Set("Picsum-ID", imageID)
-	w.Header().Set("Timing-Allow-Origin", "*") // Allow all origins to see timing resources
 
 	// Return the image
 	w.Write(processedImage)
@@ -63,10 +99,66 @@ func (a *API) imageHandler(w http.ResponseWriter, r *http.Request) *handler.Erro
 	return nil
 }
 
+// imageCacheMaxAge is how long images are cached for
+const imageCacheMaxAge = 30 * 24 * time.Hour
+
+// cacheControl returns the Cache-Control header of an image, cached for a month or until its signed URL expires
+func cacheControl(r *http.Request) string {
+	maxAge := imageCacheMaxAge
+	if expires, ok := params.Expiry(r); ok {
+		maxAge = min(maxAge, time.Until(expires))
+	}
+
+	return fmt.Sprintf("public, max-age=%d, stale-while-revalidate=60, stale-if-error=43200, immutable", int(maxAge.Seconds()))
+}
+
+// setAttributionHeaders sets the author of the image from the catalogue, so clients can credit it without requesting its info
+func (a *API) setAttributionHeaders(w http.ResponseWriter, r *http.Request, imageID string) {
+	if a.Database == nil {
+		return
+	}
+
+	// The image is still served when it's missing from the catalogue, as the URL is signed
+	img, err := a.Database.Get(r.Context(), imageID)
+	if err != nil {
+		if err != database.ErrNotFound {
+			a.logError(r, "error getting image from database", err)
+		}
+
+		return
+	}
+
+	authorURL := img.AuthorURL
+	if authorURL == "" {
+		authorURL = img.URL
+	}
+
+	w.Header().Set("Picsum-Author", percentEncode(img.Author))
+	w.Header().Set("Picsum-Author-URL", authorURL)
+	w.Header().Set("Link", fmt.Sprintf(`<%s>; rel="author"`, authorURL))
+}
+
+// percentEncode percent-encodes the bytes of a header value that aren't printable ASCII, and the percent sign
+// Browsers decode header values as Latin-1, so UTF-8 values are decoded with decodeURIComponent instead
+func percentEncode(value string) string {
+	var b strings.Builder
+	for i := 0; i < len(value); i++ {
+		if c := value[i]; c < 0x20 || c >= 0x7f || c == '%' {
+			fmt.Fprintf(&b, "%%%02X", c)
+		} else {
+			b.WriteByte(c)
+		}
+	}
+
+	return b.String()
+}
+
 func getOutputFormat(extension string) image.OutputFormat {
 	switch extension {
 	case ".webp":
 		return image.WebP
+	case ".avif":
+		return image.AVIF
 	default:
 		return image.JPEG
 	}
@@ -76,14 +168,64 @@ func getContentType(extension string) string {
 	switch extension {
 	case ".webp":
 		return "image/webp"
+	case ".avif":
+		return "image/avif"
 	default:
 		return "image/jpeg"
 	}
 }
 
-func buildFilename(imageID string, p *params.Params) string {
+// transform contains the optional region, mirroring and rotation of an image
+type transform struct {
+	region   *image.Region
+	mirror   bool
+	rotation int
+}
+
+// getTransform gets the region, mirror and rotate query parameters
+func getTransform(r *http.Request) (transform, error) {
+	query := r.URL.Query()
+	t := transform{
+		mirror: query.Has("mirror"),
+	}
+
+	if value := query.Get("region"); value != "" {
+		var region image.Region
+		if _, err := fmt.Sscanf(value, "%d,%d,%d,%d", &region.X, &region.Y, &region.Width, &region.Height); err != nil ||
+			region.X < 0 || region.Y < 0 || region.Width < 1 || region.Height < 1 {
+			return transform{}, ErrInvalidRegion
+		}
+
+		t.region = &region
+	}
+
+	if value := query.Get("rotate"); value != "" {
+		rotation, err := strconv.Atoi(value)
+		if err != nil || (rotation != 90 && rotation != 180 && rotation != 270) {
+			return transform{}, ErrInvalidRotation
+		}
+
+		t.rotation = rotation
+	}
+
+	return t, nil
+}
+
+func buildFilename(imageID string, p *params.Params, t transform) string {
 	filename := fmt.Sprintf("%s-%dx%d", imageID, p.Width, p.Height)
 
+	if t.region != nil {
+		filename += fmt.Sprintf("-region_%d_%d_%d_%d", t.region.X, t.region.Y, t.region.Width, t.region.Height)
+	}
+
+	if t.mirror {
+		filename += "-mirror"
+	}
+
+	if t.rotation != 0 {
+		filename += fmt.Sprintf("-rotate_%d", t.rotation)
+	}
+
 	if p.Blur {
 		filename += fmt.Sprintf("-blur_%d", p.BlurAmount)
 	}
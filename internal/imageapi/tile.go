@@ -0,0 +1,77 @@
+package imageapi
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/DMarby/picsum-photos/internal/dzi"
+	"github.com/DMarby/picsum-photos/internal/handler"
+	"github.com/DMarby/picsum-photos/internal/image"
+	"github.com/DMarby/picsum-photos/internal/params"
+	"github.com/gorilla/mux"
+)
+
+func (a *API) tileHandler(w http.ResponseWriter, r *http.Request) *handler.Error {
+	// Validate the path
+	valid, err := params.ValidateHMAC(a.HMAC, r)
+	if err == params.ErrExpired {
+		return errorCodes.New(http.StatusGone, err)
+	} else if err != nil {
+		return handler.InternalServerError()
+	}
+
+	if !valid {
+		return errorCodes.BadRequest(ErrInvalidSignature)
+	}
+
+	// Get the image ID, image size and tile from the path params
+	vars := mux.Vars(r)
+	imageID := vars["id"]
+
+	var values [5]int
+	for i, name := range []string{"width", "height", "level", "col", "row"} {
+		values[i], err = strconv.Atoi(vars[name])
+		if err != nil {
+			return errorCodes.BadRequest(params.ErrInvalidSize)
+		}
+	}
+	width, height, level, col, row := values[0], values[1], values[2], values[3], values[4]
+
+	region, tileWidth, tileHeight, err := dzi.Tile(width, height, level, col, row)
+	if err != nil {
+		return errorCodes.New(http.StatusNotFound, err)
+	}
+
+	// Build the image task, cropping the tile from the original and caching it
+	task := image.NewTask(imageID, tileWidth, tileHeight, fmt.Sprintf("Picsum ID: %s", imageID), image.JPEG).
+		Crop(region).
+		Cache(fmt.Sprintf("%s_tile_%d_%d_%d", imageID, level, col, row))
+
+	// Set the headers
+	w.Header().Set("Content-Disposition", fmt.Sprintf("inline; filename=\"%s-tile-%d-%d_%d.jpg\"", imageID, level, col, row))
+	w.Header().Set("Content-Type", "image/jpeg")
+	w.Header().Set("Cache-Control", cacheControl(r))
+	w.Header().Set("Picsum-ID", imageID)
+	w.Header().Set("Timing-Allow-Origin", "*") // Allow all origins to see timing resources
+	a.setAttributionHeaders(w, r, imageID)
+
+	// The headers don't depend on the processed tile, so don't process it for HEAD requests
+	if r.Method == http.MethodHead {
+		return nil
+	}
+
+	// Process the tile
+	processedImage, err := a.ImageProcessor.ProcessImage(r.Context(), task)
+	if err != nil {
+		a.logError(r, "error processing tile", err)
+		return handler.InternalServerError()
+	}
+
+	w.Header().Set("Content-Length", strconv.Itoa(len(processedImage)))
+
+	// Return the tile
+	w.Write(processedImage)
+
+	return nil
+}
@@ -1,14 +1,25 @@
 package params
 
 import (
+	"fmt"
 	"net/http"
 	"net/url"
+	"strconv"
+	"time"
 
 	"github.com/DMarby/picsum-photos/internal/hmac"
 )
 
+// ErrExpired is returned when a signed URL has expired
+var ErrExpired = fmt.Errorf("Link expired")
+
 // HMAC generates and appends an HMAC to a URL path + query params
+// The ID of the key it's created with is signed in a query parameter named kid, unless it's created without a key ID
 func HMAC(h *hmac.HMAC, path string, query url.Values) (string, error) {
+	if h.ActiveKeyID != "" {
+		query.Set("kid", h.ActiveKeyID)
+	}
+
 	hmac, err := h.Create(path + BuildQuery(query))
 	if err != nil {
 		return "", err
@@ -18,7 +29,31 @@ func HMAC(h *hmac.HMAC, path string, query url.Values) (string, error) {
 	return path + BuildQuery(query), nil
 }
 
+// HMACWithExpiry generates and appends an HMAC to a URL path + query params, like HMAC,
+// signing the expiry in a query parameter named exp so that the URL can't be used after it
+func HMACWithExpiry(h *hmac.HMAC, path string, query url.Values, expires time.Time) (string, error) {
+	query.Set("exp", strconv.FormatInt(expires.Unix(), 10))
+	return HMAC(h, path, query)
+}
+
+// Expiry returns when the signed URL of the request expires, if it has an exp query parameter
+// An invalid expiry is in the past, so that the URL is rejected
+func Expiry(r *http.Request) (time.Time, bool) {
+	exp, ok := r.URL.Query()["exp"]
+	if !ok {
+		return time.Time{}, false
+	}
+
+	seconds, err := strconv.ParseInt(exp[0], 10, 64)
+	if err != nil {
+		return time.Time{}, true
+	}
+
+	return time.Unix(seconds, 0), true
+}
+
 // ValidateHMAC validates the URL path/query params, given an hmac in a query parameter named hmac
+// Returns ErrExpired if the params are valid, but the URL has expired
 func ValidateHMAC(h *hmac.HMAC, r *http.Request) (bool, error) {
 	// Get the query params in the request
 	query := r.URL.Query()
@@ -28,5 +63,14 @@ func ValidateHMAC(h *hmac.HMAC, r *http.Request) (bool, error) {
 	query.Del("hmac")
 
 	encodedQuery := BuildQuery(query)
-	return h.Validate(r.URL.Path+encodedQuery, hmac)
+	valid, err := h.Validate(query.Get("kid"), r.URL.Path+encodedQuery, hmac)
+	if err != nil || !valid {
+		return valid, err
+	}
+
+	if expires, ok := Expiry(r); ok && !time.Now().Before(expires) {
+		return false, ErrExpired
+	}
+
+	return true, nil
 }
@@ -2,6 +2,7 @@ package params
 
 import (
 	"fmt"
+	"math"
 	"net/http"
 	"strconv"
 	"strings"
@@ -13,6 +14,7 @@ import (
 var (
 	ErrInvalidSize          = fmt.Errorf("Invalid size")
 	ErrInvalidFileExtension = fmt.Errorf("Invalid file extension")
+	ErrInvalidRatio         = fmt.Errorf("Invalid ratio")
 )
 
 const defaultBlurAmount = 5
@@ -21,6 +23,7 @@ const defaultBlurAmount = 5
 type Params struct {
 	Width      int
 	Height     int
+	Ratio      float64
 	Blur       bool
 	BlurAmount int
 	Grayscale  bool
@@ -30,7 +33,7 @@ type Params struct {
 // GetParams parses and returns all the path and query parameters
 func GetParams(r *http.Request) (*Params, error) {
 	// Get and validate the width and height from the path parameters
-	width, height, err := getSize(r)
+	width, height, ratio, err := getSize(r)
 	if err != nil {
 		return nil, err
 	}
@@ -42,11 +45,12 @@ func GetParams(r *http.Request) (*Params, error) {
 	}
 
 	// Get and validate the query parameters for grayscale and blur
-	grayscale, blur, blurAmount := getQueryParams(r)
+	grayscale, blur, blurAmount := GetQueryParams(r)
 
 	params := &Params{
 		Width:      width,
 		Height:     height,
+		Ratio:      ratio,
 		Blur:       blur,
 		BlurAmount: blurAmount,
 		Grayscale:  grayscale,
@@ -56,27 +60,64 @@ func GetParams(r *http.Request) (*Params, error) {
 	return params, nil
 }
 
-// getSize gets the image size from the size or the width/height path params, and validates it
-func getSize(r *http.Request) (width int, height int, err error) {
+// getSize gets the image size from the size, the width/ratio or the width/height path params, and validates it
+func getSize(r *http.Request) (width int, height int, ratio float64, err error) {
 	// Check for the size parameter first
 	if size, ok := intParam(r, "size"); ok {
 		width, height = size, size
+	} else if ratioValue, ok := mux.Vars(r)["ratio"]; ok {
+		// If a ratio is given, calculate the height from the width
+		// The width is required, as there's no height to keep the full size of the image for
+		width, ok = intParam(r, "width")
+		if !ok || width < 1 {
+			return -1, -1, 0, ErrInvalidSize
+		}
+
+		ratio, err = ParseRatio(ratioValue)
+		if err != nil {
+			return -1, -1, 0, err
+		}
+
+		height = int(math.Round(float64(width) / ratio))
+		if height < 1 {
+			height = 1
+		}
 	} else {
 		// If size doesn't exist, check for width/height
 		width, ok = intParam(r, "width")
 		if !ok {
-			return -1, -1, ErrInvalidSize
+			return -1, -1, 0, ErrInvalidSize
 		}
 
 		height, ok = intParam(r, "height")
 		if !ok {
-			return -1, -1, ErrInvalidSize
+			return -1, -1, 0, ErrInvalidSize
 		}
 	}
 
 	return
 }
 
+// ParseRatio parses an aspect ratio in the form of {width}:{height}
+func ParseRatio(value string) (float64, error) {
+	ratioWidth, ratioHeight, ok := strings.Cut(value, ":")
+	if !ok {
+		return 0, ErrInvalidRatio
+	}
+
+	w, err := strconv.Atoi(ratioWidth)
+	if err != nil || w < 1 {
+		return 0, ErrInvalidRatio
+	}
+
+	h, err := strconv.Atoi(ratioHeight)
+	if err != nil || h < 1 {
+		return 0, ErrInvalidRatio
+	}
+
+	return float64(w) / float64(h), nil
+}
+
 // intParam tries to get a param and convert it to an Integer
 func intParam(r *http.Request, name string) (int, bool) {
 	vars := mux.Vars(r)
@@ -93,7 +134,7 @@ func intParam(r *http.Request, name string) (int, bool) {
 func getFileExtension(r *http.Request) (extension string, err error) {
 	vars := mux.Vars(r)
 
-	// We only allow the .jpg and .webp extensions, as we only serve jpg and webp images
+	// We only allow the .jpg, .webp and .avif extensions, as we only serve jpg, webp and avif images
 	// We normalize having no extension since it's an optional path param
 	val := strings.ToLower(vars["extension"])
 
@@ -101,15 +142,15 @@ func getFileExtension(r *http.Request) (extension string, err error) {
 		val = ".jpg"
 	}
 
-	if val != ".jpg" && val != ".webp" {
+	if val != ".jpg" && val != ".webp" && val != ".avif" {
 		return "", ErrInvalidFileExtension
 	}
 
 	return val, nil
 }
 
-// getQueryParams returns whether the grayscale and blur queryparams are present
-func getQueryParams(r *http.Request) (grayscale bool, blur bool, blurAmount int) {
+// GetQueryParams returns whether the grayscale and blur queryparams are present
+func GetQueryParams(r *http.Request) (grayscale bool, blur bool, blurAmount int) {
 	if _, ok := r.URL.Query()["grayscale"]; ok {
 		grayscale = true
 	}
@@ -16,10 +16,52 @@ int save_image_to_webp_buffer(VipsImage *image, void **buf, size_t *len) {
   return vips_webpsave_buffer(image, buf, len, NULL);
 }
 
+int save_image_to_avif_buffer(VipsImage *image, void **buf, size_t *len) {
+  return vips_heifsave_buffer(image, buf, len, "compression", VIPS_FOREIGN_HEIF_COMPRESSION_AV1, NULL);
+}
+
 int resize_image(void *buf, size_t len, VipsImage **out, int width, int height, VipsInteresting interesting) {
   return vips_thumbnail_buffer(buf, len, out, width, "height", height, "crop", interesting, NULL);
 }
 
+int crop_image(void *buf, size_t len, VipsImage **out, int left, int top, int width, int height, int target_width, int target_height) {
+  VipsImage *base = vips_image_new_from_buffer(buf, len, "", "access", VIPS_ACCESS_RANDOM, NULL);
+  if (base == NULL) {
+    return -1;
+  }
+
+  VipsImage *region;
+  int err = vips_extract_area(base, &region, left, top, width, height, NULL);
+  g_object_unref(base);
+  if (err) {
+    return err;
+  }
+
+  VipsImage *resized;
+  err = vips_thumbnail_image(region, &resized, target_width, "height", target_height, "size", VIPS_SIZE_FORCE, NULL);
+  g_object_unref(region);
+  if (err) {
+    return err;
+  }
+
+  // Decode the image into memory, as the buffer is only kept alive for the duration of the call
+  *out = vips_image_copy_memory(resized);
+  g_object_unref(resized);
+  if (*out == NULL) {
+    return -1;
+  }
+
+  return 0;
+}
+
+int rotate_image(VipsImage *in, VipsImage **out, VipsAngle angle) {
+  return vips_rot(in, out, angle, NULL);
+}
+
+int mirror_image(VipsImage *in, VipsImage **out) {
+  return vips_flip(in, out, VIPS_DIRECTION_HORIZONTAL, NULL);
+}
+
 int change_colorspace(VipsImage *in, VipsImage **out, VipsInterpretation colorspace) {
   return vips_call("colourspace", in, out, colorspace, NULL);
 }
@@ -15,7 +15,11 @@ extern void log_callback(char* message);
 
 int save_image_to_jpeg_buffer(VipsImage *image, void **buf, size_t *len);
 int save_image_to_webp_buffer(VipsImage *image, void **buf, size_t *len);
+int save_image_to_avif_buffer(VipsImage *image, void **buf, size_t *len);
 int resize_image(void *buf, size_t len, VipsImage **out, int width, int height, VipsInteresting interesting);
+int crop_image(void *buf, size_t len, VipsImage **out, int left, int top, int width, int height, int target_width, int target_height);
+int rotate_image(VipsImage *in, VipsImage **out, VipsAngle angle);
+int mirror_image(VipsImage *in, VipsImage **out);
 int change_colorspace(VipsImage *in, VipsImage **out, VipsInterpretation colorspace);
 int blur_image(VipsImage *in, VipsImage **out, double blur);
 void set_user_comment(VipsImage *image, char const* comment);
@@ -108,6 +108,29 @@ func ResizeImage(buffer []byte, width int, height int) (Image, error) {
 	return image, nil
 }
 
+// CropImage loads an image from a buffer, crops it to a region and resizes the region to the target size
+func CropImage(buffer []byte, left int, top int, width int, height int, targetWidth int, targetHeight int) (Image, error) {
+	if len(buffer) == 0 {
+		return nil, fmt.Errorf("empty buffer")
+	}
+
+	imageBuffer := unsafe.Pointer(&buffer[0])
+	imageBufferSize := C.size_t(len(buffer))
+
+	var image *C.VipsImage
+
+	errCode := C.crop_image(imageBuffer, imageBufferSize, &image, C.int(left), C.int(top), C.int(width), C.int(height), C.int(targetWidth), C.int(targetHeight))
+
+	// Prevent buffer from being garbage collected until after crop_image has been called
+	runtime.KeepAlive(buffer)
+
+	if errCode != 0 {
+		return nil, fmt.Errorf("error cropping image from buffer %s", catchVipsError())
+	}
+
+	return image, nil
+}
+
 // SaveToJpegBuffer saves an image as JPEG to a buffer
 func SaveToJpegBuffer(image Image) ([]byte, error) {
 	defer UnrefImage(image)
@@ -148,6 +171,26 @@ func SaveToWebPBuffer(image Image) ([]byte, error) {
 	return buffer, nil
 }
 
+// SaveToAVIFBuffer saves an image as AVIF to a buffer
+func SaveToAVIFBuffer(image Image) ([]byte, error) {
+	defer UnrefImage(image)
+
+	var bufferPointer unsafe.Pointer
+	bufferLength := C.size_t(0)
+
+	err := C.save_image_to_avif_buffer(image, &bufferPointer, &bufferLength)
+
+	if err != 0 {
+		return nil, fmt.Errorf("error saving to avif buffer %s", catchVipsError())
+	}
+
+	buffer := C.GoBytes(bufferPointer, C.int(bufferLength))
+
+	C.g_free(C.gpointer(bufferPointer))
+
+	return buffer, nil
+}
+
 // Grayscale converts an image to grayscale
 func Grayscale(image Image) (Image, error) {
 	defer UnrefImage(image)
@@ -178,6 +221,48 @@ func Blur(image Image, blur int) (Image, error) {
 	return result, nil
 }
 
+// Rotate rotates an image clockwise by 90, 180 or 270 degrees
+func Rotate(image Image, degrees int) (Image, error) {
+	var angle C.VipsAngle
+	switch degrees {
+	case 90:
+		angle = C.VIPS_ANGLE_D90
+	case 180:
+		angle = C.VIPS_ANGLE_D180
+	case 270:
+		angle = C.VIPS_ANGLE_D270
+	default:
+		return nil, fmt.Errorf("unsupported rotation %d", degrees)
+	}
+
+	defer UnrefImage(image)
+
+	var result *C.VipsImage
+
+	err := C.rotate_image(image, &result, angle)
+
+	if err != 0 {
+		return nil, fmt.Errorf("error rotating image %s", catchVipsError())
+	}
+
+	return result, nil
+}
+
+// Mirror mirrors an image horizontally
+func Mirror(image Image) (Image, error) {
+	defer UnrefImage(image)
+
+	var result *C.VipsImage
+
+	err := C.mirror_image(image, &result)
+
+	if err != 0 {
+		return nil, fmt.Errorf("error mirroring image %s", catchVipsError())
+	}
+
+	return result, nil
+}
+
 // SetUserComment sets the UserComment field in the exif metadata for an image
 func SetUserComment(image Image, comment string) {
 	C.set_user_comment(image, C.CString(comment))
@@ -50,6 +50,22 @@ func TestVips(t *testing.T) {
 		})
 	})
 
+	t.Run("SaveToAVIFBuffer", func(t *testing.T) {
+		t.Run("saves an image to buffer", func(t *testing.T) {
+			_, err := vips.SaveToAVIFBuffer(resizeImage(t, imageBuffer))
+			if err != nil {
+				t.Error(err)
+			}
+		})
+
+		t.Run("errors on an invalid image", func(t *testing.T) {
+			_, err := vips.SaveToAVIFBuffer(vips.NewEmptyImage())
+			if err == nil || !strings.Contains(err.Error(), "error saving to avif buffer") {
+				t.Error(err)
+			}
+		})
+	})
+
 	t.Run("ResizeImage", func(t *testing.T) {
 		t.Run("loads and resizes an image as jpeg", func(t *testing.T) {
 			image, err := vips.ResizeImage(imageBuffer, 500, 500)
@@ -162,6 +178,70 @@ func TestVips(t *testing.T) {
 			}
 		})
 	})
+
+	t.Run("CropImage", func(t *testing.T) {
+		t.Run("loads, crops and resizes an image", func(t *testing.T) {
+			image, err := vips.CropImage(imageBuffer, 10, 10, 100, 50, 200, 100)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if _, err := vips.SaveToJpegBuffer(image); err != nil {
+				t.Error(err)
+			}
+		})
+
+		t.Run("errors when given an empty buffer", func(t *testing.T) {
+			var buf []byte
+			_, err := vips.CropImage(buf, 0, 0, 100, 100, 100, 100)
+			if err == nil || err.Error() != "empty buffer" {
+				t.Error(err)
+			}
+		})
+
+		t.Run("errors when the region is outside the image", func(t *testing.T) {
+			_, err := vips.CropImage(imageBuffer, 100000, 0, 100, 100, 100, 100)
+			if err == nil || !strings.Contains(err.Error(), "error cropping image from buffer") {
+				t.Error(err)
+			}
+		})
+	})
+
+	t.Run("Rotate", func(t *testing.T) {
+		t.Run("rotates an image", func(t *testing.T) {
+			image, err := vips.Rotate(resizeImage(t, imageBuffer), 90)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if _, err := vips.SaveToJpegBuffer(image); err != nil {
+				t.Error(err)
+			}
+		})
+
+		t.Run("errors when given an unsupported rotation", func(t *testing.T) {
+			image := resizeImage(t, imageBuffer)
+			defer vips.UnrefImage(image)
+
+			_, err := vips.Rotate(image, 45)
+			if err == nil || err.Error() != "unsupported rotation 45" {
+				t.Error(err)
+			}
+		})
+	})
+
+	t.Run("Mirror", func(t *testing.T) {
+		t.Run("mirrors an image", func(t *testing.T) {
+			image, err := vips.Mirror(resizeImage(t, imageBuffer))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if _, err := vips.SaveToJpegBuffer(image); err != nil {
+				t.Error(err)
+			}
+		})
+	})
 }
 
 // Utility function for regenerating the fixtures